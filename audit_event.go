@@ -0,0 +1,177 @@
+package passhash
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"net"
+	"slices"
+	"time"
+)
+
+// AuditReason describes why an audit event occurred. e.g. why authentication failed
+type AuditReason string
+
+const (
+	// ReasonWrongPassword means the password didn't match the Credential
+	ReasonWrongPassword AuditReason = "wrong_password"
+	// ReasonUnsupportedKdf means the Credential's Kdf isn't registered
+	ReasonUnsupportedKdf AuditReason = "unsupported_kdf"
+	// ReasonVerifyError means the Kdf was unable to verify the password. e.g. due to an invalid WorkFactor
+	ReasonVerifyError AuditReason = "verify_error"
+	// ReasonCredentialNotFound means the user's Credential wasn't found. e.g. the user doesn't exist
+	ReasonCredentialNotFound AuditReason = "credential_not_found"
+	// ReasonStoreError means the user's Credential couldn't be loaded from the CredentialStore
+	ReasonStoreError AuditReason = "store_error"
+	// ReasonPasswordPolicy means the password didn't meet the password policies
+	ReasonPasswordPolicy AuditReason = "password_policy"
+	// ReasonPasswordUnchanged means the new password is the old password
+	ReasonPasswordUnchanged AuditReason = "password_unchanged"
+	// ReasonTooManyFailures means the user's account was locked by the LockoutPolicy
+	ReasonTooManyFailures AuditReason = "too_many_failures"
+)
+
+// AuditEvent is a structured audit log entry.
+// The RequestID, UserAgent, ClientID, and Attributes are read from the context. See WithRequestID, WithUserAgent,
+// WithClientID, and WithAuditAttributes
+type AuditEvent struct {
+	UserID     UserID
+	Time       time.Time
+	Type       AuditType
+	IP         net.IP
+	Reason     AuditReason       // Why the event occurred, if known. e.g. why authentication failed
+	RequestID  string            // The ID of the request that caused the event
+	UserAgent  string            // The user agent of the client that caused the event
+	ClientID   string            // The ID of the client or application that caused the event
+	Attributes map[string]string // Any additional attributes
+}
+
+// ContextAuditLogger is an AuditLogger that records structured AuditEvents.
+// passhash calls LogEvent instead of Log for AuditLoggers that implement ContextAuditLogger
+type ContextAuditLogger interface {
+	AuditLogger
+	// LogEvent logs the audit event. The context is the context of the request that caused the event
+	LogEvent(ctx context.Context, event AuditEvent)
+}
+
+// AuditEventReader is implemented by AuditLoggers that can read back every AuditEvent they store, in the order they
+// were logged. e.g. MemoryAuditLogger and FileAuditLogger
+type AuditEventReader interface {
+	// ReadEvents calls fn with each stored AuditEvent, from oldest to newest, stopping at the first error.
+	// fn must not log to the AuditLogger
+	ReadEvents(fn func(AuditEvent) error) error
+}
+
+// AuditEventWriter is implemented by AuditLoggers that report whether an AuditEvent was stored. e.g. FileAuditLogger
+type AuditEventWriter interface {
+	// WriteEvent logs the audit event, returning an error if it wasn't stored
+	WriteEvent(ctx context.Context, event AuditEvent) error
+}
+
+// NewContextAuditLogger adapts the AuditLogger to a ContextAuditLogger. AuditLoggers that already implement
+// ContextAuditLogger are returned as-is. Otherwise, LogEvent calls Log with the event's UserID, Type, and IP
+func NewContextAuditLogger(al AuditLogger) ContextAuditLogger {
+	if cal, ok := al.(ContextAuditLogger); ok {
+		return cal
+	}
+	return auditLoggerAdapter{AuditLogger: al}
+}
+
+type auditLoggerAdapter struct {
+	AuditLogger
+}
+
+func (a auditLoggerAdapter) LogEvent(_ context.Context, event AuditEvent) {
+	a.Log(event.UserID, event.Type, event.IP)
+}
+
+type auditContextKey int
+
+const (
+	requestIDContextKey auditContextKey = iota
+	userAgentContextKey
+	clientIDContextKey
+	auditAttributesContextKey
+)
+
+// WithRequestID returns a copy of the context with the request ID to record in AuditEvents
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey, requestID)
+}
+
+// WithUserAgent returns a copy of the context with the user agent to record in AuditEvents
+func WithUserAgent(ctx context.Context, userAgent string) context.Context {
+	return context.WithValue(ctx, userAgentContextKey, userAgent)
+}
+
+// WithClientID returns a copy of the context with the client or application ID to record in AuditEvents
+func WithClientID(ctx context.Context, clientID string) context.Context {
+	return context.WithValue(ctx, clientIDContextKey, clientID)
+}
+
+// WithAuditAttributes returns a copy of the context with the attributes to record in AuditEvents.
+// The attributes are merged with any attributes already in the context, overriding existing keys
+func WithAuditAttributes(ctx context.Context, attributes map[string]string) context.Context {
+	merged := maps.Clone(auditAttributes(ctx))
+	if merged == nil {
+		merged = make(map[string]string, len(attributes))
+	}
+	maps.Copy(merged, attributes)
+	return context.WithValue(ctx, auditAttributesContextKey, merged)
+}
+
+func auditAttributes(ctx context.Context) map[string]string {
+	attributes, _ := ctx.Value(auditAttributesContextKey).(map[string]string)
+	return attributes
+}
+
+func contextString(ctx context.Context, key auditContextKey) string {
+	s, _ := ctx.Value(key).(string)
+	return s
+}
+
+// newAuditEvent creates an AuditEvent with the metadata in the context
+func newAuditEvent(ctx context.Context, userID UserID, at AuditType, ip net.IP, reason AuditReason) AuditEvent {
+	return AuditEvent{
+		UserID:     userID,
+		Time:       time.Now(),
+		Type:       at,
+		IP:         ip,
+		Reason:     reason,
+		RequestID:  contextString(ctx, requestIDContextKey),
+		UserAgent:  contextString(ctx, userAgentContextKey),
+		ClientID:   contextString(ctx, clientIDContextKey),
+		Attributes: maps.Clone(auditAttributes(ctx)),
+	}
+}
+
+// log returns the Log of the event
+func (e AuditEvent) log() Log {
+	return Log{UserID: e.UserID, Time: e.Time, Type: e.Type, IP: slices.Clone(e.IP), Reason: e.Reason}
+}
+
+func (e AuditEvent) clone() AuditEvent {
+	e.IP = slices.Clone(e.IP)
+	e.Attributes = maps.Clone(e.Attributes)
+	return e
+}
+
+// auditLog logs the audit event using the Config's AuditLogger, if any
+func (c Config) auditLog(ctx context.Context, userID UserID, at AuditType, ip net.IP, reason AuditReason) {
+	if c.AuditLogger == nil {
+		return
+	}
+	if cal, ok := c.AuditLogger.(ContextAuditLogger); ok {
+		cal.LogEvent(ctx, newAuditEvent(ctx, userID, at, ip, reason))
+		return
+	}
+	c.AuditLogger.Log(userID, at, ip)
+}
+
+// auditPolicyRejection logs PasswordPolicyRejected if err is due to unmet PasswordPolicies
+func (c Config) auditPolicyRejection(ctx context.Context, userID UserID, err error, ip net.IP) {
+	var policiesErr PasswordPoliciesNotMet
+	if errors.As(err, &policiesErr) {
+		c.auditLog(ctx, userID, PasswordPolicyRejected, ip, ReasonPasswordPolicy)
+	}
+}
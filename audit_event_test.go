@@ -0,0 +1,125 @@
+package passhash_test
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/dhui/passhash"
+)
+
+func TestAuditEventContextMetadata(t *testing.T) {
+	auditLogger := &fakeAuditLogger{}
+	config := passhash.DefaultConfig
+	config.AuditLogger = auditLogger
+	userID := passhash.UserID(1)
+	ip := net.ParseIP("192.0.2.1")
+	credential, err := config.NewCredential(userID, testPassword)
+	if err != nil {
+		t.Fatal("Unable to create new Credential", err)
+	}
+
+	ctx := passhash.WithRequestID(context.Background(), "request-1")
+	ctx = passhash.WithUserAgent(ctx, "test-agent/1.0")
+	ctx = passhash.WithClientID(ctx, "test-client")
+	ctx = passhash.WithAuditAttributes(ctx, map[string]string{"a": "1", "b": "2"})
+	ctx = passhash.WithAuditAttributes(ctx, map[string]string{"b": "3"})
+	if _, err := credential.Verify(ctx, config, "wrong password", passhash.WithIP(ip)); err != nil {
+		t.Fatal("Unable to verify password", err)
+	}
+
+	event := auditLogger.lastEvent(t)
+	if event.UserID != userID || event.Type != passhash.AuthnFailed || !event.IP.Equal(ip) {
+		t.Error("Unexpected AuditEvent", event)
+	}
+	if event.Reason != passhash.ReasonWrongPassword {
+		t.Errorf("Unexpected reason. %v != %v", event.Reason, passhash.ReasonWrongPassword)
+	}
+	if event.RequestID != "request-1" || event.UserAgent != "test-agent/1.0" || event.ClientID != "test-client" {
+		t.Error("AuditEvent missing context metadata", event)
+	}
+	if len(event.Attributes) != 2 || event.Attributes["a"] != "1" || event.Attributes["b"] != "3" {
+		t.Error("Unexpected attributes", event.Attributes)
+	}
+	if event.Time.IsZero() {
+		t.Error("AuditEvent time not set")
+	}
+	if logs := auditLogger.LastN(userID, 1); len(logs) != 1 || logs[0].Type != passhash.AuthnFailed {
+		t.Error("Unexpected audit logs", logs)
+	}
+}
+
+func TestAuditEventReasons(t *testing.T) {
+	auditLogger := &fakeAuditLogger{}
+	config := passhash.DefaultConfig
+	config.AuditLogger = auditLogger
+	userID := passhash.UserID(1)
+	ctx := context.Background()
+
+	if _, err := config.NewCredential(userID, "short"); err == nil {
+		t.Fatal("Created Credential with a password that fails the password policies")
+	}
+	if event := auditLogger.lastEvent(t); event.Type != passhash.PasswordPolicyRejected ||
+		event.Reason != passhash.ReasonPasswordPolicy {
+		t.Error("Unexpected AuditEvent", event)
+	}
+
+	credential := passhash.Credential{UserID: userID, Kdf: passhash.Kdf(999999)}
+	if _, err := credential.Verify(ctx, config, testPassword); err == nil {
+		t.Error("Verified a Credential with an unsupported Kdf")
+	}
+	if event := auditLogger.lastEvent(t); event.Type != passhash.AuthnFailed ||
+		event.Reason != passhash.ReasonUnsupportedKdf {
+		t.Error("Unexpected AuditEvent", event)
+	}
+
+	credential = passhash.Credential{UserID: userID, Kdf: passhash.Scrypt, WorkFactor: &passhash.BcryptWorkFactor{}}
+	if _, err := credential.Verify(ctx, config, testPassword); err == nil {
+		t.Error("Verified a Credential with an invalid WorkFactor")
+	}
+	if event := auditLogger.lastEvent(t); event.Type != passhash.AuthnFailed ||
+		event.Reason != passhash.ReasonVerifyError {
+		t.Error("Unexpected AuditEvent", event)
+	}
+}
+
+func TestAuditEventAuthenticatorUnknownUser(t *testing.T) {
+	auditLogger := &fakeAuditLogger{}
+	config := passhash.DefaultConfig
+	config.AuditLogger = auditLogger
+	config.Store = newMemoryCredentialStore()
+	authenticator, err := passhash.NewAuthenticator(config)
+	if err != nil {
+		t.Fatal("Unable to create Authenticator", err)
+	}
+	ctx := passhash.WithRequestID(context.Background(), "request-2")
+	if _, err := authenticator.Login(ctx, passhash.UserID(1), testPassword, passhash.EmptyIP); err == nil {
+		t.Fatal("Logged in unknown user")
+	}
+	event := auditLogger.lastEvent(t)
+	if event.Type != passhash.AuthnFailed || event.Reason != passhash.ReasonCredentialNotFound ||
+		event.RequestID != "request-2" {
+		t.Error("Unexpected AuditEvent", event)
+	}
+}
+
+func TestNewContextAuditLogger(t *testing.T) {
+	eventLogger := &fakeAuditLogger{}
+	if passhash.NewContextAuditLogger(eventLogger) != passhash.ContextAuditLogger(eventLogger) {
+		t.Error("ContextAuditLogger was adapted")
+	}
+
+	memoryLogger := &passhash.MemoryAuditLogger{}
+	adapted := passhash.NewContextAuditLogger(memoryLogger)
+	userID := passhash.UserID(1)
+	ip := net.ParseIP("192.0.2.1")
+	adapted.LogEvent(context.Background(), passhash.AuditEvent{UserID: userID, Type: passhash.AuthnSucceeded, IP: ip,
+		RequestID: "request-3"})
+	logs := memoryLogger.LastN(userID, 10)
+	if len(logs) != 1 || logs[0].Type != passhash.AuthnSucceeded || !logs[0].IP.Equal(ip) {
+		t.Error("Adapted AuditLogger did not log the AuditEvent", logs)
+	}
+	if l := len(adapted.LastN(userID, 10)); l != 1 {
+		t.Errorf("Adapted AuditLogger has %d logs instead of 1", l)
+	}
+}
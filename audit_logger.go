@@ -1,7 +1,12 @@
 package passhash
 
 import (
+	"cmp"
+	"context"
+	"fmt"
 	"net"
+	"slices"
+	"sync"
 	"time"
 )
 
@@ -18,14 +23,68 @@ const (
 	AuthnFailed
 	// UpgradedKdf means the key derivation function was updated
 	UpgradedKdf
+	// CredentialCreated means a new Credential was created. e.g. when a user registers
+	CredentialCreated
+	// PasswordChanged means the password was changed after the old password was verified
+	PasswordChanged
+	// PasswordReset means the password was reset without verifying the old password
+	PasswordReset
+	// PasswordPolicyRejected means a new password was rejected because it didn't meet the password policies
+	PasswordPolicyRejected
+	// PasswordUnchangedRejected means a password change was rejected because the new password is the old password
+	PasswordUnchangedRejected
+	// AccountLocked means the user's account was locked after too many failed authentication attempts
+	AccountLocked
 )
 
+var auditTypeNames = map[AuditType]string{
+	AuthnSucceeded:            "authn_succeeded",
+	AuthnFailed:               "authn_failed",
+	UpgradedKdf:               "upgraded_kdf",
+	CredentialCreated:         "credential_created",
+	PasswordChanged:           "password_changed",
+	PasswordReset:             "password_reset",
+	PasswordPolicyRejected:    "password_policy_rejected",
+	PasswordUnchangedRejected: "password_unchanged_rejected",
+	AccountLocked:             "account_locked",
+}
+
+// String returns the name of the AuditType. e.g. authn_failed
+func (at AuditType) String() string {
+	if name, ok := auditTypeNames[at]; ok {
+		return name
+	}
+	return fmt.Sprintf("AuditType(%d)", uint(at))
+}
+
+// MarshalText marshals the AuditType as its name
+func (at AuditType) MarshalText() ([]byte, error) {
+	return []byte(at.String()), nil
+}
+
+// UnmarshalText unmarshals an AuditType name returned by String
+func (at *AuditType) UnmarshalText(text []byte) error {
+	for t, name := range auditTypeNames {
+		if name == string(text) {
+			*at = t
+			return nil
+		}
+	}
+	var n uint
+	if _, err := fmt.Sscanf(string(text), "AuditType(%d)", &n); err != nil {
+		return fmt.Errorf("Invalid AuditType: %q", text)
+	}
+	*at = AuditType(n)
+	return nil
+}
+
 // Log is an audit log entry
 type Log struct {
 	UserID UserID
 	Time   time.Time
 	Type   AuditType
 	IP     net.IP
+	Reason AuditReason // Why the log occurred. Empty if unknown or not recorded by the AuditLogger
 }
 
 // AuditLogger is an interface for storing Specs with an audit trail
@@ -54,49 +113,217 @@ func (al *DummyAuditLogger) LastNWithTypes(userID UserID, n int, auditTypes ...A
 	return []Log{}
 }
 
-// MemoryAuditLogger is an AuditLogger that stores all of it's logs in memory
-// It is not recommended that you use this AuditLogger in production since the logs are not persisted and concurrent access is not supported
+const (
+	// DefaultMemoryAuditLoggerPerUser is the default maximum number of logs kept for each user by a MemoryAuditLogger
+	DefaultMemoryAuditLoggerPerUser = 100
+	// DefaultMemoryAuditLoggerMaxLogs is the default maximum number of logs kept by a MemoryAuditLogger
+	DefaultMemoryAuditLoggerMaxLogs = 100000
+)
+
+// MemoryAuditLogger is an AuditLogger that stores its logs in memory and is safe for concurrent use.
+// Each user's logs are kept in a ring buffer, so a user's oldest logs are evicted once they have perUser logs.
+// Once maxLogs logs are kept in total, the oldest logs across all users are evicted.
+// The zero value is ready to use with DefaultMemoryAuditLoggerPerUser and DefaultMemoryAuditLoggerMaxLogs.
+// It is not recommended that you use this AuditLogger in production since the logs are not persisted
 type MemoryAuditLogger struct {
-	allLogs map[UserID][]Log
+	mu      sync.Mutex
+	perUser int
+	maxLogs int
+	seq     uint64
+	size    int
+	users   map[UserID]*memoryAuditRing
+	// order tracks the logs from oldest to newest for global eviction. It may contain logs that have already been
+	// evicted from their user's ring buffer. These are skipped and periodically compacted.
+	order     []memoryAuditOrder
+	orderHead int
+}
+
+// NewMemoryAuditLogger creates a MemoryAuditLogger that keeps up to perUser logs for each user and up to maxLogs logs
+// in total. Non-positive values use the defaults
+func NewMemoryAuditLogger(perUser, maxLogs int) *MemoryAuditLogger {
+	return &MemoryAuditLogger{perUser: perUser, maxLogs: maxLogs}
+}
+
+type memoryAuditEntry struct {
+	seq   uint64
+	event AuditEvent
+}
+
+type memoryAuditOrder struct {
+	userID UserID
+	seq    uint64
+}
+
+// memoryAuditRing is a ring buffer of a user's logs. The buffer grows as needed up to the capacity
+type memoryAuditRing struct {
+	buf   []memoryAuditEntry
+	start int
+	count int
+}
+
+// push adds the entry to the ring buffer and returns true if the oldest entry was overwritten to make room
+func (r *memoryAuditRing) push(e memoryAuditEntry, capacity int) bool {
+	if r.count < len(r.buf) {
+		r.buf[(r.start+r.count)%len(r.buf)] = e
+		r.count++
+		return false
+	}
+	if len(r.buf) < capacity {
+		buf := make([]memoryAuditEntry, min(max(2*len(r.buf), 8), capacity))
+		for i := 0; i < r.count; i++ {
+			buf[i] = r.at(i)
+		}
+		r.buf, r.start = buf, 0
+		r.buf[r.count] = e
+		r.count++
+		return false
+	}
+	r.buf[r.start] = e
+	r.start = (r.start + 1) % len(r.buf)
+	return true
+}
+
+// at returns the i-th oldest entry
+func (r *memoryAuditRing) at(i int) memoryAuditEntry {
+	return r.buf[(r.start+i)%len(r.buf)]
+}
+
+func (r *memoryAuditRing) popOldest() {
+	r.buf[r.start] = memoryAuditEntry{}
+	r.start = (r.start + 1) % len(r.buf)
+	r.count--
+}
+
+// live determines if the log hasn't been evicted from its user's ring buffer
+func (al *MemoryAuditLogger) live(o memoryAuditOrder) bool {
+	r := al.users[o.userID]
+	return r != nil && r.count > 0 && o.seq >= r.at(0).seq
+}
+
+func (al *MemoryAuditLogger) evictOldest() {
+	for al.orderHead < len(al.order) {
+		o := al.order[al.orderHead]
+		al.orderHead++
+		if !al.live(o) {
+			continue
+		}
+		r := al.users[o.userID]
+		r.popOldest()
+		if r.count == 0 {
+			delete(al.users, o.userID)
+		}
+		al.size--
+		return
+	}
+}
+
+// compactOrder removes evicted logs from the order once they outnumber the live logs
+func (al *MemoryAuditLogger) compactOrder() {
+	if len(al.order)-al.orderHead <= 2*al.size+16 {
+		return
+	}
+	order := make([]memoryAuditOrder, 0, al.size)
+	for _, o := range al.order[al.orderHead:] {
+		if al.live(o) {
+			order = append(order, o)
+		}
+	}
+	al.order, al.orderHead = order, 0
 }
 
 // Log will log the AuditLog in memory
 func (al *MemoryAuditLogger) Log(userID UserID, at AuditType, ip net.IP) {
-	if al.allLogs == nil {
-		al.allLogs = make(map[UserID][]Log)
+	al.log(AuditEvent{UserID: userID, Time: time.Now(), Type: at, IP: ip})
+}
+
+// LogEvent will log the audit event in memory, including its Reason and metadata
+func (al *MemoryAuditLogger) LogEvent(_ context.Context, event AuditEvent) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
 	}
-	entry := al.allLogs[userID]
-	if entry == nil {
-		entry = []Log{}
+	al.log(event)
+}
+
+func (al *MemoryAuditLogger) log(event AuditEvent) {
+	userID := event.UserID
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	if al.users == nil {
+		al.users = make(map[UserID]*memoryAuditRing)
 	}
-	al.allLogs[userID] = append(entry, Log{UserID: userID, Time: time.Now(), Type: at, IP: ip})
+	if al.perUser <= 0 {
+		al.perUser = DefaultMemoryAuditLoggerPerUser
+	}
+	if al.maxLogs <= 0 {
+		al.maxLogs = DefaultMemoryAuditLoggerMaxLogs
+	}
+	r := al.users[userID]
+	if r == nil {
+		r = &memoryAuditRing{}
+		al.users[userID] = r
+	}
+	al.seq++
+	entry := memoryAuditEntry{seq: al.seq, event: event.clone()}
+	if !r.push(entry, al.perUser) {
+		al.size++
+	}
+	al.order = append(al.order, memoryAuditOrder{userID: userID, seq: al.seq})
+	for al.size > al.maxLogs {
+		al.evictOldest()
+	}
+	al.compactOrder()
 }
 
-// LastN gets the last N logs for a user
+// LastN gets the last N logs for a user, from oldest to newest
 func (al *MemoryAuditLogger) LastN(userID UserID, n int) []Log {
-	origLogs := al.allLogs[userID]
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	r := al.users[userID]
+	if r == nil || n <= 0 {
+		return []Log{}
+	}
+	n = min(n, r.count)
 	logs := make([]Log, 0, n)
-	if n >= len(origLogs) {
-		return origLogs
-	}
-	return append(logs, origLogs[len(origLogs)-n:]...)
-}
-
-// LastNWithTypes gets the last N logs for a user with the specified types
-func (al *MemoryAuditLogger) LastNWithTypes(userID UserID, n int, auditTypes ...AuditType) (logs []Log) {
-	origLogs := al.allLogs[userID]
-	logs = make([]Log, 0, n)
-	for i := len(origLogs) - 1; i >= 0; i-- {
-		log := al.allLogs[userID][i]
-		for _, auditType := range auditTypes {
-			if log.Type == auditType {
-				logs = append(logs, log)
-				continue
-			}
+	for i := r.count - n; i < r.count; i++ {
+		logs = append(logs, r.at(i).event.log())
+	}
+	return logs
+}
+
+// LastNWithTypes gets the last N logs for a user with the specified types, from newest to oldest
+func (al *MemoryAuditLogger) LastNWithTypes(userID UserID, n int, auditTypes ...AuditType) []Log {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	r := al.users[userID]
+	if r == nil || n <= 0 {
+		return []Log{}
+	}
+	logs := make([]Log, 0, min(n, r.count))
+	for i := r.count - 1; i >= 0 && len(logs) < n; i-- {
+		if event := r.at(i).event; slices.Contains(auditTypes, event.Type) {
+			logs = append(logs, event.log())
 		}
-		if len(logs) >= n {
-			return
+	}
+	return logs
+}
+
+// ReadEvents calls fn with each AuditEvent that hasn't been evicted, from oldest to newest
+func (al *MemoryAuditLogger) ReadEvents(fn func(AuditEvent) error) error {
+	al.mu.Lock()
+	entries := make([]memoryAuditEntry, 0, al.size)
+	for _, r := range al.users {
+		for i := 0; i < r.count; i++ {
+			entries = append(entries, r.at(i))
+		}
+	}
+	al.mu.Unlock()
+	slices.SortFunc(entries, func(a, b memoryAuditEntry) int {
+		return cmp.Compare(a.seq, b.seq)
+	})
+	for _, entry := range entries {
+		if err := fn(entry.event.clone()); err != nil {
+			return err
 		}
 	}
-	return
+	return nil
 }
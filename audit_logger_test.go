@@ -1,7 +1,12 @@
 package passhash_test
 
 import (
+	"context"
+	"net"
+	"slices"
+	"sync"
 	"testing"
+	"time"
 )
 
 import (
@@ -19,6 +24,104 @@ func setupAuditLoggerTestData(userID passhash.UserID, al passhash.AuditLogger) i
 	return numIters * 3
 }
 
+// fakeClock is a clock for the Now options that only moves when a test sets now
+type fakeClock struct {
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+// fakeAuditLogger is a ContextAuditLogger and AuditEventReader that keeps its AuditEvents in a slice that tests may
+// inspect or tamper with. If it has a fakeClock, the AuditEvents are timestamped by the clock
+type fakeAuditLogger struct {
+	*fakeClock
+	mu     sync.Mutex
+	events []passhash.AuditEvent
+}
+
+func (al *fakeAuditLogger) Log(userID passhash.UserID, at passhash.AuditType, ip net.IP) {
+	al.LogEvent(context.Background(), passhash.AuditEvent{UserID: userID, Type: at, IP: ip})
+}
+
+func (al *fakeAuditLogger) LogEvent(_ context.Context, event passhash.AuditEvent) {
+	if al.fakeClock != nil {
+		event.Time = al.now
+	} else if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	al.events = append(al.events, event)
+}
+
+func fakeLog(event passhash.AuditEvent) passhash.Log {
+	return passhash.Log{UserID: event.UserID, Time: event.Time, Type: event.Type, IP: event.IP, Reason: event.Reason}
+}
+
+func (al *fakeAuditLogger) LastN(userID passhash.UserID, n int) []passhash.Log {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	var logs []passhash.Log
+	for _, event := range al.events {
+		if event.UserID == userID {
+			logs = append(logs, fakeLog(event))
+		}
+	}
+	return logs[max(0, len(logs)-n):]
+}
+
+func (al *fakeAuditLogger) LastNWithTypes(userID passhash.UserID, n int,
+	auditTypes ...passhash.AuditType) []passhash.Log {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	var logs []passhash.Log
+	for i := len(al.events) - 1; i >= 0 && len(logs) < n; i-- {
+		if event := al.events[i]; event.UserID == userID && slices.Contains(auditTypes, event.Type) {
+			logs = append(logs, fakeLog(event))
+		}
+	}
+	return logs
+}
+
+func (al *fakeAuditLogger) ReadEvents(fn func(passhash.AuditEvent) error) error {
+	al.mu.Lock()
+	events := slices.Clone(al.events)
+	al.mu.Unlock()
+	for _, event := range events {
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// count returns the number of logs with the AuditType
+func (al *fakeAuditLogger) count(at passhash.AuditType) int {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	n := 0
+	for _, event := range al.events {
+		if event.Type == at {
+			n++
+		}
+	}
+	return n
+}
+
+func (al *fakeAuditLogger) lastEvent(t *testing.T) passhash.AuditEvent {
+	t.Helper()
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	if len(al.events) == 0 {
+		t.Fatal("No AuditEvents logged")
+	}
+	return al.events[len(al.events)-1]
+}
+
 func TestDummyAuditLoggerLog(t *testing.T) {
 	al := passhash.DummyAuditLogger{}
 	userID := passhash.UserID(0)
@@ -124,3 +227,136 @@ func TestMemoryAuditLoggerLastNWithTypesMore(t *testing.T) {
 		t.Log(lastN)
 	}
 }
+
+func TestMemoryAuditLoggerLastNWithTypesNoDuplicates(t *testing.T) {
+	al := &passhash.MemoryAuditLogger{}
+	userID := passhash.UserID(0)
+	n := setupAuditLoggerTestData(userID, al)
+	lastN := al.LastNWithTypes(userID, n, passhash.AuthnSucceeded, passhash.AuthnSucceeded, passhash.AuthnFailed)
+	if l := len(lastN); l != 2*n/3 {
+		t.Errorf("Did not retrieve expected number of logs. Have %d logs instead of %d", l, 2*n/3)
+	}
+	if lastN[0].Type != passhash.AuthnFailed || lastN[1].Type != passhash.AuthnSucceeded {
+		t.Error("Logs not ordered from newest to oldest", lastN[:2])
+	}
+}
+
+func TestMemoryAuditLoggerLastNNonPositive(t *testing.T) {
+	al := &passhash.MemoryAuditLogger{}
+	userID := passhash.UserID(0)
+	setupAuditLoggerTestData(userID, al)
+	if l := len(al.LastN(userID, 0)); l != 0 {
+		t.Errorf("Got %d logs for n = 0", l)
+	}
+	if l := len(al.LastNWithTypes(userID, 0, passhash.AuthnSucceeded)); l != 0 {
+		t.Errorf("Got %d logs for n = 0", l)
+	}
+	if l := len(al.LastN(passhash.UserID(1), 10)); l != 0 {
+		t.Errorf("Got %d logs for a user without logs", l)
+	}
+}
+
+func TestMemoryAuditLoggerPerUserCapacity(t *testing.T) {
+	al := passhash.NewMemoryAuditLogger(10, 0)
+	userID := passhash.UserID(0)
+	for i := 0; i < 25; i++ {
+		al.Log(userID, passhash.AuditType(i+1), passhash.EmptyIP)
+	}
+	lastN := al.LastN(userID, 100)
+	if l := len(lastN); l != 10 {
+		t.Fatalf("Per user capacity not enforced. Have %d logs instead of 10", l)
+	}
+	for i, log := range lastN {
+		if log.Type != passhash.AuditType(16+i) {
+			t.Errorf("Unexpected log at %d. %v != %v", i, log.Type, passhash.AuditType(16+i))
+		}
+	}
+}
+
+func TestMemoryAuditLoggerGlobalEviction(t *testing.T) {
+	al := passhash.NewMemoryAuditLogger(10, 15)
+	for i := 0; i < 10; i++ {
+		al.Log(passhash.UserID(0), passhash.AuthnSucceeded, passhash.EmptyIP)
+	}
+	for i := 0; i < 10; i++ {
+		al.Log(passhash.UserID(1), passhash.AuthnFailed, passhash.EmptyIP)
+	}
+	if l := len(al.LastN(passhash.UserID(0), 100)); l != 5 {
+		t.Errorf("Oldest logs not evicted. Have %d logs instead of 5", l)
+	}
+	if l := len(al.LastN(passhash.UserID(1), 100)); l != 10 {
+		t.Errorf("Newest logs evicted. Have %d logs instead of 10", l)
+	}
+	for i := 0; i < 10; i++ {
+		al.Log(passhash.UserID(2), passhash.UpgradedKdf, passhash.EmptyIP)
+	}
+	if l := len(al.LastN(passhash.UserID(0), 100)); l != 0 {
+		t.Errorf("Oldest logs not evicted. Have %d logs instead of 0", l)
+	}
+	if l := len(al.LastN(passhash.UserID(1), 100)); l != 5 {
+		t.Errorf("Oldest logs not evicted. Have %d logs instead of 5", l)
+	}
+}
+
+func TestMemoryAuditLoggerGlobalEvictionAfterPerUserEviction(t *testing.T) {
+	al := passhash.NewMemoryAuditLogger(2, 3)
+	for i := 0; i < 100; i++ {
+		al.Log(passhash.UserID(0), passhash.AuditType(i+1), passhash.EmptyIP)
+	}
+	al.Log(passhash.UserID(1), passhash.AuthnSucceeded, passhash.EmptyIP)
+	al.Log(passhash.UserID(1), passhash.AuthnSucceeded, passhash.EmptyIP)
+	lastN := al.LastN(passhash.UserID(0), 100)
+	if len(lastN) != 1 || lastN[0].Type != passhash.AuditType(100) {
+		t.Error("Unexpected logs after eviction", lastN)
+	}
+	if l := len(al.LastN(passhash.UserID(1), 100)); l != 2 {
+		t.Errorf("Newest logs evicted. Have %d logs instead of 2", l)
+	}
+}
+
+func TestMemoryAuditLoggerReturnsCopies(t *testing.T) {
+	al := &passhash.MemoryAuditLogger{}
+	userID := passhash.UserID(0)
+	ip := net.ParseIP("192.0.2.1")
+	al.Log(userID, passhash.AuthnSucceeded, ip)
+	ip[len(ip)-1] = 2
+	lastN := al.LastN(userID, 1)
+	lastN[0].IP[len(lastN[0].IP)-1] = 3
+	if logged := al.LastN(userID, 1)[0].IP; !logged.Equal(net.ParseIP("192.0.2.1")) {
+		t.Error("Logged IP was modified", logged)
+	}
+}
+
+func TestMemoryAuditLoggerLogEventReason(t *testing.T) {
+	al := &passhash.MemoryAuditLogger{}
+	al.LogEvent(context.Background(), passhash.AuditEvent{UserID: passhash.UserID(1), Type: passhash.AuthnFailed,
+		Reason: passhash.ReasonStoreError})
+	logs := al.LastNWithTypes(passhash.UserID(1), 1, passhash.AuthnFailed)
+	if len(logs) != 1 || logs[0].Reason != passhash.ReasonStoreError || logs[0].Time.IsZero() {
+		t.Error("Unexpected logs", logs)
+	}
+}
+
+func TestMemoryAuditLoggerConcurrent(t *testing.T) {
+	al := passhash.NewMemoryAuditLogger(50, 500)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(userID passhash.UserID) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				al.Log(userID, passhash.AuthnSucceeded, passhash.EmptyIP)
+				al.LastN(userID, 10)
+				al.LastNWithTypes(userID, 10, passhash.AuthnSucceeded)
+			}
+		}(passhash.UserID(i))
+	}
+	wg.Wait()
+	total := 0
+	for i := 0; i < 8; i++ {
+		total += len(al.LastN(passhash.UserID(i), 1000))
+	}
+	if total != 400 {
+		t.Errorf("Unexpected number of logs. Have %d logs instead of 400", total)
+	}
+}
@@ -0,0 +1,154 @@
+package passhash
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+// Authenticator manages users' Credentials using a Config.
+// Credentials are loaded from and persisted to the Config's Store and audited using the Config's AuditLogger.
+// An Authenticator is safe for concurrent use if the Config's Store, AuditLogger, and PasswordPolicies are.
+type Authenticator struct {
+	config      Config
+	missingUser *Credential // The dummy Credential verified by Login for unknown users
+}
+
+// NewAuthenticator creates an Authenticator using the Config.
+// Unless ExpertOverride is set, the Config must pass Validate. The dummy Credential used by Login to verify passwords of
+// unknown users is created up front so that the first login of an unknown user isn't slower than other logins.
+func NewAuthenticator(config Config) (*Authenticator, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	missingUser, err := config.missingUserCredential()
+	if err != nil {
+		return nil, err
+	}
+	return &Authenticator{config: config, missingUser: missingUser}, nil
+}
+
+// Config returns the Config used by the Authenticator
+func (a *Authenticator) Config() Config {
+	return a.config
+}
+
+// Register creates a new Credential for the user and stores it. ErrUserExists is returned if the user already has a
+// Credential. Use ResetPassword to replace an existing user's password. The check isn't atomic with storing the
+// Credential, so the CredentialStore should also reject concurrent registrations of the same user.
+// UserPasswordPolicies check the password against the UserAttributes from the context. See WithUserAttributes
+func (a *Authenticator) Register(ctx context.Context, userID UserID, password string) error {
+	if _, err := a.load(ctx, userID); err == nil {
+		return ErrUserExists
+	} else if !errors.Is(err, ErrCredentialNotFound) {
+		return err
+	}
+	credential, err := a.config.createCredential(ctx, userID, password)
+	if err != nil {
+		return err
+	}
+	return a.store(ctx, credential)
+}
+
+// Login checks if the password matches the user's stored Credential. Credentials that are upgraded to meet the Config
+// are persisted. ErrAuthenticationFailed is returned if the password doesn't match.
+// Since the user is authenticated before the Credential is upgraded and stored, a Matched result may accompany an
+// UpgradeError or StoreError. A Matched result's PolicyError is set if the upgraded password doesn't meet the
+// PasswordPolicies.
+// If the user's Credential can't be loaded, AuthnFailed is logged and the password is verified using
+// Config.VerifyMissingUser before the StoreError is returned so that unknown users can't be enumerated via timing.
+// Don't reveal the difference between a StoreError and ErrAuthenticationFailed to the user.
+// An AccountLockedError or RateLimitedError is returned before any password is hashed for both known and unknown users.
+func (a *Authenticator) Login(ctx context.Context, userID UserID, password string, ip net.IP) (VerifyResult, error) {
+	credential, err := a.load(ctx, userID)
+	if err != nil {
+		if lockErr := a.config.checkLockout(userID); lockErr != nil {
+			return VerifyResult{}, lockErr
+		}
+		if ctx.Err() == nil {
+			release, limitErr := a.config.acquireRateLimit(ctx, ip)
+			if limitErr != nil {
+				return VerifyResult{}, limitErr
+			}
+			defer release()
+			_ = verifyMissingUser(a.missingUser, password)
+			reason := ReasonStoreError
+			if errors.Is(err, ErrCredentialNotFound) {
+				reason = ReasonCredentialNotFound
+			}
+			a.config.auditLog(ctx, userID, AuthnFailed, ip, reason)
+			if reason == ReasonCredentialNotFound {
+				a.config.lockoutAfterFailure(ctx, userID, ip)
+			}
+		}
+		return VerifyResult{}, err
+	}
+	result, err := credential.Verify(ctx, a.config, password, WithIP(ip))
+	if err != nil {
+		return result, err
+	}
+	if !result.Matched {
+		return result, ErrAuthenticationFailed
+	}
+	if result.Upgraded {
+		return result, a.store(ctx, credential)
+	}
+	return result, nil
+}
+
+// ChangePassword changes the user's password and stores the updated Credential.
+// ErrAuthenticationFailed is returned if the old password doesn't match the user's stored Credential.
+func (a *Authenticator) ChangePassword(ctx context.Context, userID UserID, oldPassword, newPassword string,
+	ip net.IP) error {
+	credential, err := a.load(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := credential.changePassword(ctx, a.config, oldPassword, newPassword, ip); err != nil {
+		if err == ErrOldPasswordMismatch {
+			return ErrAuthenticationFailed
+		}
+		return err
+	}
+	return a.store(ctx, credential)
+}
+
+// ResetPassword resets the password of an existing user without checking their old password and stores the updated
+// Credential. e.g. after the user has been verified using a password reset email
+func (a *Authenticator) ResetPassword(ctx context.Context, userID UserID, newPassword string, ip net.IP) error {
+	credential, err := a.load(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := credential.replace(ctx, a.config, newPassword, PasswordReset, ip); err != nil {
+		return err
+	}
+	return a.store(ctx, credential)
+}
+
+func (a *Authenticator) load(ctx context.Context, userID UserID) (*Credential, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	credential, err := a.config.Store.LoadContext(ctx, userID)
+	if err != nil {
+		return nil, StoreError{Op: "load", UserID: userID, Err: err}
+	}
+	if credential == nil {
+		return nil, StoreError{Op: "load", UserID: userID, Err: ErrCredentialNotFound}
+	}
+	return credential, nil
+}
+
+func (a *Authenticator) store(ctx context.Context, credential *Credential) error {
+	if err := a.config.Store.StoreContext(ctx, credential); err != nil {
+		return StoreError{Op: "store", UserID: credential.UserID, Err: err}
+	}
+	return nil
+}
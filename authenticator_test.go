@@ -0,0 +1,305 @@
+package passhash_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/dhui/passhash"
+)
+
+// memoryCredentialStore is a CredentialStore that stores copies of Credentials in memory
+type memoryCredentialStore struct {
+	mu          sync.Mutex
+	credentials map[passhash.UserID]passhash.Credential
+	stores      int
+	storeErr    error
+	loadErr     error
+}
+
+func newMemoryCredentialStore() *memoryCredentialStore {
+	return &memoryCredentialStore{credentials: map[passhash.UserID]passhash.Credential{}}
+}
+
+func copyCredential(credential passhash.Credential) (*passhash.Credential, error) {
+	params, err := credential.WorkFactor.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	credential.WorkFactor, err = passhash.NewWorkFactorForKdf(credential.Kdf)
+	if err != nil {
+		return nil, err
+	}
+	if err := credential.WorkFactor.Unmarshal(params); err != nil {
+		return nil, err
+	}
+	credential.Salt = slices.Clone(credential.Salt)
+	credential.Hash = slices.Clone(credential.Hash)
+	return &credential, nil
+}
+
+func (s *memoryCredentialStore) Store(credential *passhash.Credential) error {
+	return s.StoreContext(context.Background(), credential)
+}
+
+func (s *memoryCredentialStore) StoreContext(_ context.Context, credential *passhash.Credential) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.storeErr != nil {
+		return s.storeErr
+	}
+	stored, err := copyCredential(*credential)
+	if err != nil {
+		return err
+	}
+	s.credentials[credential.UserID] = *stored
+	s.stores++
+	return nil
+}
+
+func (s *memoryCredentialStore) Load(userID passhash.UserID) (*passhash.Credential, error) {
+	return s.LoadContext(context.Background(), userID)
+}
+
+func (s *memoryCredentialStore) LoadContext(_ context.Context, userID passhash.UserID) (*passhash.Credential, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.loadErr != nil {
+		return nil, s.loadErr
+	}
+	credential, ok := s.credentials[userID]
+	if !ok {
+		return nil, passhash.ErrCredentialNotFound
+	}
+	return copyCredential(credential)
+}
+
+func newTestAuthenticator(t *testing.T) (*passhash.Authenticator, *memoryCredentialStore, *passhash.MemoryAuditLogger) {
+	t.Helper()
+	store := newMemoryCredentialStore()
+	auditLogger := &passhash.MemoryAuditLogger{}
+	config := passhash.DefaultConfig
+	config.Store = store
+	config.AuditLogger = auditLogger
+	authenticator, err := passhash.NewAuthenticator(config)
+	if err != nil {
+		t.Fatal("Unable to create Authenticator", err)
+	}
+	return authenticator, store, auditLogger
+}
+
+func TestNewAuthenticatorInvalidConfig(t *testing.T) {
+	config := passhash.DefaultConfig
+	config.Store = nil
+	if _, err := passhash.NewAuthenticator(config); !errors.Is(err, passhash.ErrNilStore) {
+		t.Error("Expected ErrNilStore. Got:", err)
+	}
+}
+
+func TestAuthenticatorRegisterAndLogin(t *testing.T) {
+	ctx := context.Background()
+	authenticator, _, auditLogger := newTestAuthenticator(t)
+	userID := passhash.UserID(1)
+	ip := net.ParseIP("192.0.2.1")
+	if err := authenticator.Register(ctx, userID, testPassword); err != nil {
+		t.Fatal("Unable to register user", err)
+	}
+
+	result, err := authenticator.Login(ctx, userID, testPassword, ip)
+	if err != nil {
+		t.Fatal("Unable to login", err)
+	}
+	if !result.Matched || result.Upgraded {
+		t.Error("Unexpected login result", result)
+	}
+	if _, err := authenticator.Login(ctx, userID, "wrong password", ip); !errors.Is(err,
+		passhash.ErrAuthenticationFailed) {
+		t.Error("Expected ErrAuthenticationFailed. Got:", err)
+	}
+	logs := auditLogger.LastN(userID, 2)
+	if len(logs) != 2 || logs[0].Type != passhash.AuthnSucceeded || logs[1].Type != passhash.AuthnFailed {
+		t.Error("Unexpected audit logs", logs)
+	}
+}
+
+func TestAuthenticatorRegisterExistingUser(t *testing.T) {
+	ctx := context.Background()
+	authenticator, store, _ := newTestAuthenticator(t)
+	userID := passhash.UserID(1)
+	if err := authenticator.Register(ctx, userID, testPassword); err != nil {
+		t.Fatal("Unable to register user", err)
+	}
+	if err := authenticator.Register(ctx, userID, "another password"); !errors.Is(err, passhash.ErrUserExists) {
+		t.Error("Expected ErrUserExists. Got:", err)
+	}
+	if store.stores != 1 {
+		t.Errorf("Existing Credential replaced. %d stores", store.stores)
+	}
+	if result, err := authenticator.Login(ctx, userID, testPassword, passhash.EmptyIP); err != nil || !result.Matched {
+		t.Errorf("Unexpected login result %+v. Error: %v", result, err)
+	}
+
+	store.loadErr = errors.New("store unavailable")
+	var storeErr passhash.StoreError
+	if err := authenticator.Register(ctx, passhash.UserID(2), testPassword); !errors.As(err, &storeErr) {
+		t.Error("Expected StoreError. Got:", err)
+	}
+}
+
+func TestAuthenticatorRegisterPasswordPolicies(t *testing.T) {
+	authenticator, store, _ := newTestAuthenticator(t)
+	var policiesErr passhash.PasswordPoliciesNotMet
+	if err := authenticator.Register(context.Background(), passhash.UserID(1), "short"); !errors.As(err,
+		&policiesErr) {
+		t.Error("Expected PasswordPoliciesNotMet. Got:", err)
+	}
+	if store.stores != 0 {
+		t.Error("Credential stored for password that fails the password policies")
+	}
+}
+
+func TestAuthenticatorLoginUnknownUser(t *testing.T) {
+	authenticator, _, _ := newTestAuthenticator(t)
+	_, err := authenticator.Login(context.Background(), passhash.UserID(1), testPassword, passhash.EmptyIP)
+	var storeErr passhash.StoreError
+	if !errors.As(err, &storeErr) || storeErr.Op != "load" {
+		t.Error("Expected load StoreError. Got:", err)
+	}
+	if !errors.Is(err, passhash.ErrCredentialNotFound) {
+		t.Error("Expected ErrCredentialNotFound. Got:", err)
+	}
+}
+
+func TestAuthenticatorLoginPersistsUpgrade(t *testing.T) {
+	ctx := context.Background()
+	authenticator, store, _ := newTestAuthenticator(t)
+	userID := passhash.UserID(1)
+	config := passhash.Config{Kdf: passhash.Pbkdf2Sha256, WorkFactor: &passhash.Pbkdf2WorkFactor{Iter: 1000},
+		SaltSize: 16, KeyLength: 32, ExpertOverride: true}
+	credential, err := config.NewCredential(userID, testPassword)
+	if err != nil {
+		t.Fatal("Unable to create new Credential", err)
+	}
+	if err := store.Store(credential); err != nil {
+		t.Fatal("Unable to store Credential", err)
+	}
+
+	result, err := authenticator.Login(ctx, userID, testPassword, passhash.EmptyIP)
+	if err != nil {
+		t.Fatal("Unable to login", err)
+	}
+	if !result.Matched || !result.Upgraded {
+		t.Error("Outdated credential not upgraded", result)
+	}
+	stored, err := store.Load(userID)
+	if err != nil {
+		t.Fatal("Unable to load Credential", err)
+	}
+	if !stored.MeetsConfig(authenticator.Config()) {
+		t.Error("Upgraded credential not persisted")
+	}
+}
+
+func TestAuthenticatorLoginStoreError(t *testing.T) {
+	ctx := context.Background()
+	authenticator, store, _ := newTestAuthenticator(t)
+	userID := passhash.UserID(1)
+	config := passhash.Config{Kdf: passhash.Pbkdf2Sha256, WorkFactor: &passhash.Pbkdf2WorkFactor{Iter: 1000},
+		SaltSize: 16, KeyLength: 32, ExpertOverride: true}
+	credential, err := config.NewCredential(userID, testPassword)
+	if err != nil {
+		t.Fatal("Unable to create new Credential", err)
+	}
+	if err := store.Store(credential); err != nil {
+		t.Fatal("Unable to store Credential", err)
+	}
+	store.storeErr = errors.New("store unavailable")
+
+	result, err := authenticator.Login(ctx, userID, testPassword, passhash.EmptyIP)
+	var storeErr passhash.StoreError
+	if !errors.As(err, &storeErr) || storeErr.Op != "store" {
+		t.Error("Expected store StoreError. Got:", err)
+	}
+	if !result.Matched {
+		t.Error("Valid password did not match credential")
+	}
+}
+
+func TestAuthenticatorContextDone(t *testing.T) {
+	authenticator, store, _ := newTestAuthenticator(t)
+	userID := passhash.UserID(1)
+	if err := authenticator.Register(context.Background(), userID, testPassword); err != nil {
+		t.Fatal("Unable to register user", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := authenticator.Register(ctx, userID, testPassword); !errors.Is(err, context.Canceled) {
+		t.Error("Expected context.Canceled from Register. Got:", err)
+	}
+	if _, err := authenticator.Login(ctx, userID, testPassword, passhash.EmptyIP); !errors.Is(err, context.Canceled) {
+		t.Error("Expected context.Canceled from Login. Got:", err)
+	}
+	if err := authenticator.ChangePassword(ctx, userID, testPassword, "newInsecurePassword",
+		passhash.EmptyIP); !errors.Is(err, context.Canceled) {
+		t.Error("Expected context.Canceled from ChangePassword. Got:", err)
+	}
+	if err := authenticator.ResetPassword(ctx, userID, "newInsecurePassword", passhash.EmptyIP); !errors.Is(err,
+		context.Canceled) {
+		t.Error("Expected context.Canceled from ResetPassword. Got:", err)
+	}
+	if store.stores != 1 {
+		t.Error("Credential stored with a done context")
+	}
+}
+
+func TestAuthenticatorChangePassword(t *testing.T) {
+	ctx := context.Background()
+	authenticator, _, _ := newTestAuthenticator(t)
+	userID := passhash.UserID(1)
+	newPassword := "newInsecurePassword"
+	if err := authenticator.Register(ctx, userID, testPassword); err != nil {
+		t.Fatal("Unable to register user", err)
+	}
+
+	if err := authenticator.ChangePassword(ctx, userID, "wrong password", newPassword,
+		passhash.EmptyIP); !errors.Is(err, passhash.ErrAuthenticationFailed) {
+		t.Error("Expected ErrAuthenticationFailed. Got:", err)
+	}
+	if err := authenticator.ChangePassword(ctx, userID, testPassword, testPassword,
+		passhash.EmptyIP); !errors.Is(err, passhash.ErrPasswordUnchanged) {
+		t.Error("Expected ErrPasswordUnchanged. Got:", err)
+	}
+	if err := authenticator.ChangePassword(ctx, userID, testPassword, newPassword, passhash.EmptyIP); err != nil {
+		t.Fatal("Unable to change password", err)
+	}
+	if _, err := authenticator.Login(ctx, userID, testPassword, passhash.EmptyIP); !errors.Is(err,
+		passhash.ErrAuthenticationFailed) {
+		t.Error("Old password still valid. Got:", err)
+	}
+	if _, err := authenticator.Login(ctx, userID, newPassword, passhash.EmptyIP); err != nil {
+		t.Error("New password not valid", err)
+	}
+}
+
+func TestAuthenticatorResetPassword(t *testing.T) {
+	ctx := context.Background()
+	authenticator, _, _ := newTestAuthenticator(t)
+	userID := passhash.UserID(1)
+	newPassword := "newInsecurePassword"
+	if err := authenticator.ResetPassword(ctx, userID, newPassword, passhash.EmptyIP); !errors.Is(err,
+		passhash.ErrCredentialNotFound) {
+		t.Error("Expected ErrCredentialNotFound. Got:", err)
+	}
+	if err := authenticator.Register(ctx, userID, testPassword); err != nil {
+		t.Fatal("Unable to register user", err)
+	}
+	if err := authenticator.ResetPassword(ctx, userID, newPassword, passhash.EmptyIP); err != nil {
+		t.Fatal("Unable to reset password", err)
+	}
+	if _, err := authenticator.Login(ctx, userID, newPassword, passhash.EmptyIP); err != nil {
+		t.Error("New password not valid", err)
+	}
+}
@@ -79,3 +79,15 @@ func BenchmarkDefaultWorkFactorScrypt(b *testing.B) {
 		config.NewCredential(userID, testPassword) // nolint: errcheck
 	}
 }
+
+func BenchmarkDefaultWorkFactorArgon2id(b *testing.B) {
+	kdf := passhash.Argon2id
+	config := passhash.Config{Kdf: kdf, WorkFactor: passhash.DefaultWorkFactor[kdf],
+		SaltSize: 16, KeyLength: 32, AuditLogger: &passhash.DummyAuditLogger{},
+		Store: passhash.DummyCredentialStore{}, PasswordPolicies: []passhash.PasswordPolicy{},
+	}
+	userID := passhash.UserID(0)
+	for i := 0; i < b.N; i++ {
+		config.NewCredential(userID, testPassword) // nolint: errcheck
+	}
+}
@@ -0,0 +1,336 @@
+package passhash
+
+import (
+	"bufio"
+	"crypto/sha1" // nolint: gosec
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	breachFilterMagic          = "PHBF"
+	breachFilterVersion        = 1
+	breachFilterHeaderSize     = 32
+	breachFilterMaxK           = 32
+	defaultBreachFilterFPRate  = 0.001
+	maxBreachCorpusLineLength  = 1024 * 1024
+	breachCorpusHIBPHashLength = 2 * sha1.Size
+)
+
+// BreachCorpusFormat is the format of a breach corpus used to build a BreachFilter
+type BreachCorpusFormat int
+
+const (
+	// BreachCorpusPlaintext is a newline-separated list of passwords
+	BreachCorpusPlaintext BreachCorpusFormat = iota
+	// BreachCorpusHIBP is a newline-separated list of uppercase or lowercase hex SHA-1 hashes, optionally followed by
+	// :COUNT. e.g. the Have I Been Pwned Pwned Passwords SHA-1 download
+	BreachCorpusHIBP
+)
+
+// BreachFilterOptions configures building a BreachFilter from a breach corpus
+type BreachFilterOptions struct {
+	Format            BreachCorpusFormat // The format of the corpus. Defaults to BreachCorpusPlaintext
+	FalsePositiveRate float64            // The false positive rate of the filter. Defaults to 0.001
+	MinCount          int                // For BreachCorpusHIBP, skip hashes with a COUNT below MinCount
+}
+
+// BreachFilterBuilder builds a Bloom filter of breached passwords. The filter is sized for the expected number of
+// passwords when created, so adding more passwords than expected increases the false positive rate.
+//
+// The filter file format is a 32 byte header followed by the filter's bits:
+// "PHBF" | version (uint32) | k (uint32) | reserved (uint32) | m (uint64) | n (uint64), all big-endian.
+// Bit i of the m bits is bit i%8 of byte i/8. Each password is keyed by its SHA-1, and the k bit indexes are derived
+// from the SHA-1 using double hashing
+type BreachFilterBuilder struct {
+	filter BreachFilter
+}
+
+// NewBreachFilterBuilder creates a BreachFilterBuilder sized for the expected number of passwords and the false
+// positive rate
+func NewBreachFilterBuilder(expected uint64, falsePositiveRate float64) (*BreachFilterBuilder, error) {
+	if falsePositiveRate <= 0 || falsePositiveRate >= 1 {
+		return nil, fmt.Errorf("Invalid breach filter false positive rate: %v", falsePositiveRate)
+	}
+	n := float64(max(expected, 1))
+	m := uint64(math.Ceil(-n * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	m = (m + 7) / 8 * 8
+	if m/8 > math.MaxInt {
+		return nil, fmt.Errorf("Breach filter for %d passwords is too large", expected)
+	}
+	k := uint32(min(max(math.Round(float64(m)/n*math.Ln2), 1), breachFilterMaxK))
+	return &BreachFilterBuilder{filter: BreachFilter{k: k, m: m, bits: make([]byte, m/8)}}, nil
+}
+
+// Add adds a password to the filter
+func (b *BreachFilterBuilder) Add(password string) {
+	b.AddSHA1(sha1.Sum([]byte(password))) // nolint: gosec
+}
+
+// AddSHA1 adds a password's SHA-1 to the filter
+func (b *BreachFilterBuilder) AddSHA1(sum [sha1.Size]byte) {
+	f := &b.filter
+	for i := uint32(0); i < f.k; i++ {
+		idx := f.bitIndex(sum, i)
+		f.bits[idx/8] |= 1 << (idx % 8)
+	}
+	f.n++
+}
+
+// AddCorpus adds every password in the corpus to the filter
+func (b *BreachFilterBuilder) AddCorpus(r io.Reader, opts BreachFilterOptions) error {
+	return scanBreachCorpus(r, opts, b.AddSHA1)
+}
+
+// Filter returns an in-memory BreachFilter sharing the builder's bits
+func (b *BreachFilterBuilder) Filter() *BreachFilter {
+	return &b.filter
+}
+
+// WriteTo writes the filter file to w
+func (b *BreachFilterBuilder) WriteTo(w io.Writer) (int64, error) {
+	f := &b.filter
+	header := make([]byte, breachFilterHeaderSize)
+	copy(header, breachFilterMagic)
+	binary.BigEndian.PutUint32(header[4:], breachFilterVersion)
+	binary.BigEndian.PutUint32(header[8:], f.k)
+	binary.BigEndian.PutUint64(header[16:], f.m)
+	binary.BigEndian.PutUint64(header[24:], f.n)
+	n, err := w.Write(header)
+	if err != nil {
+		return int64(n), err
+	}
+	written, err := w.Write(f.bits)
+	return int64(n + written), err
+}
+
+// scanBreachCorpus calls add with the SHA-1 of every password in the corpus
+func scanBreachCorpus(r io.Reader, opts BreachFilterOptions, add func([sha1.Size]byte)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxBreachCorpusLineLength)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		if opts.Format == BreachCorpusPlaintext {
+			add(sha1.Sum([]byte(line))) // nolint: gosec
+			continue
+		}
+		hash, countStr, hasCount := strings.Cut(strings.TrimSpace(line), ":")
+		var sum [sha1.Size]byte
+		if len(hash) != breachCorpusHIBPHashLength {
+			return fmt.Errorf("Invalid SHA-1 on breach corpus line %d", lineNum)
+		}
+		if _, err := hex.Decode(sum[:], []byte(hash)); err != nil {
+			return fmt.Errorf("Invalid SHA-1 on breach corpus line %d: %v", lineNum, err)
+		}
+		if hasCount {
+			count, err := strconv.Atoi(countStr)
+			if err != nil {
+				return fmt.Errorf("Invalid count on breach corpus line %d: %v", lineNum, err)
+			}
+			if count < opts.MinCount {
+				continue
+			}
+		}
+		add(sum)
+	}
+	return scanner.Err()
+}
+
+// BuildBreachFilterFile builds a filter file from a breach corpus file. The corpus is read twice: once to count the
+// passwords and once to add them to the filter
+func BuildBreachFilterFile(corpusPath, filterPath string, opts BreachFilterOptions) (err error) {
+	if opts.FalsePositiveRate == 0 {
+		opts.FalsePositiveRate = defaultBreachFilterFPRate
+	}
+	corpus, err := os.Open(corpusPath) // #nosec G304 -- the corpus path is provided by the caller
+	if err != nil {
+		return err
+	}
+	defer corpus.Close() // nolint: errcheck
+	var expected uint64
+	if err := scanBreachCorpus(corpus, opts, func([sha1.Size]byte) { expected++ }); err != nil {
+		return err
+	}
+	if _, err := corpus.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	b, err := NewBreachFilterBuilder(expected, opts.FalsePositiveRate)
+	if err != nil {
+		return err
+	}
+	if err := b.AddCorpus(corpus, opts); err != nil {
+		return err
+	}
+
+	out, err := os.Create(filterPath) // #nosec G304 -- the filter path is provided by the caller
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+	w := bufio.NewWriter(out)
+	if _, err := b.WriteTo(w); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// BreachFilter is a Bloom filter of breached passwords. See BreachFilterBuilder for the file format.
+// A BreachFilter is either loaded into memory or reads its bits from an io.ReaderAt (e.g. a file) as needed
+type BreachFilter struct {
+	k      uint32
+	m      uint64
+	n      uint64
+	bits   []byte
+	ra     io.ReaderAt
+	closer io.Closer
+}
+
+func (f *BreachFilter) bitIndex(sum [sha1.Size]byte, i uint32) uint64 {
+	h1 := binary.LittleEndian.Uint64(sum[0:8])
+	h2 := binary.LittleEndian.Uint64(sum[8:16]) | 1
+	return (h1 + uint64(i)*h2) % f.m
+}
+
+func parseBreachFilterHeader(header []byte) (BreachFilter, error) {
+	if string(header[:4]) != breachFilterMagic {
+		return BreachFilter{}, fmt.Errorf("%w: bad magic", ErrInvalidBreachFilter)
+	}
+	if version := binary.BigEndian.Uint32(header[4:]); version != breachFilterVersion {
+		return BreachFilter{}, fmt.Errorf("%w: unsupported version %d", ErrInvalidBreachFilter, version)
+	}
+	f := BreachFilter{k: binary.BigEndian.Uint32(header[8:]), m: binary.BigEndian.Uint64(header[16:]),
+		n: binary.BigEndian.Uint64(header[24:])}
+	if f.k == 0 || f.k > breachFilterMaxK || f.m == 0 || f.m%8 != 0 {
+		return BreachFilter{}, fmt.Errorf("%w: bad parameters", ErrInvalidBreachFilter)
+	}
+	return f, nil
+}
+
+// LoadBreachFilter reads a filter file into memory
+func LoadBreachFilter(r io.Reader) (*BreachFilter, error) {
+	header := make([]byte, breachFilterHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBreachFilter, err)
+	}
+	f, err := parseBreachFilterHeader(header)
+	if err != nil {
+		return nil, err
+	}
+	if f.m/8 > math.MaxInt {
+		return nil, fmt.Errorf("%w: too large to load into memory", ErrInvalidBreachFilter)
+	}
+	f.bits = make([]byte, f.m/8)
+	if _, err := io.ReadFull(r, f.bits); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBreachFilter, err)
+	}
+	return &f, nil
+}
+
+// NewBreachFilter creates a BreachFilter that reads its bits from the filter file in ra as needed. size is the size of
+// the filter file
+func NewBreachFilter(ra io.ReaderAt, size int64) (*BreachFilter, error) {
+	header := make([]byte, breachFilterHeaderSize)
+	if _, err := ra.ReadAt(header, 0); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBreachFilter, err)
+	}
+	f, err := parseBreachFilterHeader(header)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(size) != breachFilterHeaderSize+f.m/8 {
+		return nil, fmt.Errorf("%w: size %d doesn't match the header", ErrInvalidBreachFilter, size)
+	}
+	f.ra = ra
+	return &f, nil
+}
+
+// OpenBreachFilter opens a filter file without loading it into memory. Close the BreachFilter when done
+func OpenBreachFilter(path string) (*BreachFilter, error) {
+	file, err := os.Open(path) // #nosec G304 -- the filter path is provided by the caller
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close() // nolint: errcheck
+		return nil, err
+	}
+	f, err := NewBreachFilter(file, info.Size())
+	if err != nil {
+		file.Close() // nolint: errcheck
+		return nil, err
+	}
+	f.closer = file
+	return f, nil
+}
+
+// Len returns the number of passwords added to the filter
+func (f *BreachFilter) Len() uint64 {
+	return f.n
+}
+
+// Contains returns true if the password is probably in the filter. False positives occur at the filter's false
+// positive rate, but false negatives never occur
+func (f *BreachFilter) Contains(password string) (bool, error) {
+	return f.ContainsSHA1(sha1.Sum([]byte(password))) // nolint: gosec
+}
+
+// ContainsSHA1 returns true if the password with the SHA-1 is probably in the filter
+func (f *BreachFilter) ContainsSHA1(sum [sha1.Size]byte) (bool, error) {
+	var buf [1]byte
+	for i := uint32(0); i < f.k; i++ {
+		idx := f.bitIndex(sum, i)
+		b := buf[:]
+		if f.ra != nil {
+			if _, err := f.ra.ReadAt(b, int64(breachFilterHeaderSize+idx/8)); err != nil {
+				return false, err
+			}
+		} else {
+			b = f.bits[idx/8 : idx/8+1]
+		}
+		if b[0]&(1<<(idx%8)) == 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Close closes the filter file opened by OpenBreachFilter
+func (f *BreachFilter) Close() error {
+	if f.closer == nil {
+		return nil
+	}
+	return f.closer.Close()
+}
+
+// NotBreachedPassword is a PasswordPolicy that rejects passwords in a BreachFilter. Unlike NotCommonPasswordNaive,
+// the filter doesn't need to fit in memory, and no external service is needed (unlike NotPwnedPassword).
+// Passwords are falsely rejected at the filter's false positive rate
+type NotBreachedPassword struct {
+	Filter *BreachFilter
+}
+
+// PasswordAcceptable accepts passwords that aren't in the BreachFilter
+func (pp NotBreachedPassword) PasswordAcceptable(password string) error {
+	breached, err := pp.Filter.Contains(password)
+	if err != nil {
+		return fmt.Errorf("Unable to read breach filter: %v", err)
+	}
+	if breached {
+		return ErrPwnedPassword
+	}
+	return nil
+}
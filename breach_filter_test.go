@@ -0,0 +1,172 @@
+package passhash_test
+
+import (
+	"bytes"
+	"crypto/sha1" // nolint: gosec
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dhui/passhash"
+)
+
+const breachFilterTestPasswords = 1000
+
+func breachedPassword(i int) string {
+	return fmt.Sprintf("breached-%d", i)
+}
+
+func newTestBreachFilterBuilder(t *testing.T) *passhash.BreachFilterBuilder {
+	t.Helper()
+	b, err := passhash.NewBreachFilterBuilder(breachFilterTestPasswords, 0.01)
+	if err != nil {
+		t.Fatal("Unable to create BreachFilterBuilder", err)
+	}
+	for i := 0; i < breachFilterTestPasswords; i++ {
+		b.Add(breachedPassword(i))
+	}
+	return b
+}
+
+func checkBreachFilter(t *testing.T, f *passhash.BreachFilter) {
+	t.Helper()
+	if f.Len() != breachFilterTestPasswords {
+		t.Errorf("Unexpected filter length. %d != %d", f.Len(), breachFilterTestPasswords)
+	}
+	for i := 0; i < breachFilterTestPasswords; i++ {
+		if ok, err := f.Contains(breachedPassword(i)); err != nil || !ok {
+			t.Fatalf("False negative for %s. Error: %v", breachedPassword(i), err)
+		}
+	}
+	falsePositives := 0
+	for i := 0; i < 10000; i++ {
+		ok, err := f.Contains(fmt.Sprintf("not-breached-%d", i))
+		if err != nil {
+			t.Fatal("Unable to check filter", err)
+		}
+		if ok {
+			falsePositives++
+		}
+	}
+	if falsePositives > 300 {
+		t.Errorf("False positive rate too high. %d / 10000", falsePositives)
+	}
+}
+
+func TestNewBreachFilterBuilderInvalidFalsePositiveRate(t *testing.T) {
+	for _, rate := range []float64{0, -0.1, 1} {
+		if _, err := passhash.NewBreachFilterBuilder(10, rate); err == nil {
+			t.Errorf("Expected error for false positive rate %v", rate)
+		}
+	}
+}
+
+func TestBreachFilterInMemory(t *testing.T) {
+	checkBreachFilter(t, newTestBreachFilterBuilder(t).Filter())
+}
+
+func TestBreachFilterRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if _, err := newTestBreachFilterBuilder(t).WriteTo(&buf); err != nil {
+		t.Fatal("Unable to write filter", err)
+	}
+	loaded, err := passhash.LoadBreachFilter(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal("Unable to load filter", err)
+	}
+	checkBreachFilter(t, loaded)
+
+	streamed, err := passhash.NewBreachFilter(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal("Unable to create streamed filter", err)
+	}
+	checkBreachFilter(t, streamed)
+}
+
+func TestBreachFilterInvalid(t *testing.T) {
+	var buf bytes.Buffer
+	if _, err := newTestBreachFilterBuilder(t).WriteTo(&buf); err != nil {
+		t.Fatal("Unable to write filter", err)
+	}
+	valid := buf.Bytes()
+	badMagic := append([]byte("XXXX"), valid[4:]...)
+	badVersion := append(append(append([]byte{}, valid[:4]...), 0, 0, 0, 2), valid[8:]...)
+	for name, data := range map[string][]byte{
+		"empty":       nil,
+		"bad magic":   badMagic,
+		"bad version": badVersion,
+		"truncated":   valid[:len(valid)-1],
+	} {
+		if _, err := passhash.LoadBreachFilter(bytes.NewReader(data)); !errors.Is(err, passhash.ErrInvalidBreachFilter) {
+			t.Errorf("%s: expected ErrInvalidBreachFilter from LoadBreachFilter. Got: %v", name, err)
+		}
+		if _, err := passhash.NewBreachFilter(bytes.NewReader(data), int64(len(data))); !errors.Is(err,
+			passhash.ErrInvalidBreachFilter) {
+			t.Errorf("%s: expected ErrInvalidBreachFilter from NewBreachFilter. Got: %v", name, err)
+		}
+	}
+}
+
+func TestBuildBreachFilterFile(t *testing.T) {
+	dir := t.TempDir()
+	var plaintext, hibp strings.Builder
+	for i := 0; i < breachFilterTestPasswords; i++ {
+		fmt.Fprintf(&plaintext, "%s\r\n", breachedPassword(i))
+		sum := sha1.Sum([]byte(breachedPassword(i))) // nolint: gosec
+		fmt.Fprintf(&hibp, "%s:%d\n", strings.ToUpper(hex.EncodeToString(sum[:])), 2)
+	}
+	sum := sha1.Sum([]byte("rare")) // nolint: gosec
+	fmt.Fprintf(&hibp, "%s:1\n", hex.EncodeToString(sum[:]))
+
+	for name, corpus := range map[string]struct {
+		data string
+		opts passhash.BreachFilterOptions
+	}{
+		"plaintext": {plaintext.String(), passhash.BreachFilterOptions{FalsePositiveRate: 0.01}},
+		"hibp":      {hibp.String(), passhash.BreachFilterOptions{Format: passhash.BreachCorpusHIBP, MinCount: 2}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			corpusPath, filterPath := filepath.Join(dir, name+".txt"), filepath.Join(dir, name+".phbf")
+			if err := os.WriteFile(corpusPath, []byte(corpus.data), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if err := passhash.BuildBreachFilterFile(corpusPath, filterPath, corpus.opts); err != nil {
+				t.Fatal("Unable to build filter file", err)
+			}
+			f, err := passhash.OpenBreachFilter(filterPath)
+			if err != nil {
+				t.Fatal("Unable to open filter file", err)
+			}
+			defer f.Close() // nolint: errcheck
+			checkBreachFilter(t, f)
+		})
+	}
+}
+
+func TestBuildBreachFilterFileInvalidCorpus(t *testing.T) {
+	dir := t.TempDir()
+	corpusPath := filepath.Join(dir, "corpus.txt")
+	for _, data := range []string{"not a hash\n", strings.Repeat("a", 40) + ":many\n", strings.Repeat("z", 40)} {
+		if err := os.WriteFile(corpusPath, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := passhash.BuildBreachFilterFile(corpusPath, filepath.Join(dir, "filter.phbf"),
+			passhash.BreachFilterOptions{Format: passhash.BreachCorpusHIBP}); err == nil {
+			t.Errorf("Expected error for corpus %q", data)
+		}
+	}
+}
+
+func TestNotBreachedPassword(t *testing.T) {
+	pp := passhash.NotBreachedPassword{Filter: newTestBreachFilterBuilder(t).Filter()}
+	if err := pp.PasswordAcceptable(breachedPassword(0)); !errors.Is(err, passhash.ErrPwnedPassword) {
+		t.Error("Expected ErrPwnedPassword. Got:", err)
+	}
+	if err := pp.PasswordAcceptable(testPassword); err != nil {
+		t.Error("Password that hasn't been breached was rejected", err)
+	}
+}
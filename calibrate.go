@@ -0,0 +1,170 @@
+package passhash
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrCalibrationTargetNotReached is returned by Calibrate when the target hash time could not be reached within the
+// CalibrateOptions limits. The strongest WorkFactor that was tried is returned with the error.
+var ErrCalibrationTargetNotReached = errors.New("Calibration target hash time not reached")
+
+const (
+	calibrateMaxSteps        = 64
+	calibratePbkdf2MinGrowth = 1.1
+	calibratePbkdf2MaxGrowth = 8.0
+)
+
+// CalibrateOptions specifies the limits and parameters used by Calibrate. The zero value uses sane defaults.
+type CalibrateOptions struct {
+	MaxMemoryBytes int64 // The memory budget for memory-hard kdfs (e.g. scrypt and Argon2). Defaults to 64 MiB
+	SaltSize       int   // The size of the salt in bytes. Defaults to DefaultConfig.SaltSize
+	KeyLength      int   // The size of the output key in bytes. Defaults to DefaultConfig.KeyLength
+	Samples        int   // The number of hashes timed for each WorkFactor. The fastest is used. Defaults to 3
+	Argon2Threads  int   // The Argon2 degree of parallelism. Defaults to 1
+}
+
+func (o CalibrateOptions) withDefaults() CalibrateOptions {
+	if o.MaxMemoryBytes <= 0 {
+		o.MaxMemoryBytes = 64 * 1024 * 1024
+	}
+	if o.SaltSize <= 0 {
+		o.SaltSize = DefaultConfig.SaltSize
+	}
+	if o.KeyLength <= 0 {
+		o.KeyLength = DefaultConfig.KeyLength
+	}
+	if o.Samples <= 0 {
+		o.Samples = 3
+	}
+	if o.Argon2Threads <= 0 {
+		o.Argon2Threads = 1
+	}
+	return o
+}
+
+// Calibrate benchmarks the kdf on the current machine and returns the weakest WorkFactor that takes at least target to
+// hash a password. Calibration starts from the kdf's DefaultSecurityFloors WorkFactor, which is stepped up as follows:
+//   - PBKDF2: iterations
+//   - bcrypt: cost
+//   - scrypt: N until the memory budget is reached, then p
+//   - Argon2: memory until the memory budget is reached, then time
+//
+// Calibration should be done at startup on the hardware that will verify passwords. e.g. API servers
+func Calibrate(kdf Kdf, target time.Duration, opts CalibrateOptions) (WorkFactor, error) {
+	opts = opts.withDefaults()
+	var wf WorkFactor
+	var step func(WorkFactor, time.Duration) (WorkFactor, bool)
+	switch kdf {
+	case Pbkdf2Sha256, Pbkdf2Sha512, Pbkdf2Sha3_256, Pbkdf2Sha3_512:
+		wf = calibrationStart(kdf, &Pbkdf2WorkFactor{Iter: 10000})
+		step = func(wf WorkFactor, elapsed time.Duration) (WorkFactor, bool) {
+			// PBKDF2's cost is linear so estimate the number of iterations needed
+			iter := wf.(*Pbkdf2WorkFactor).Iter
+			growth := float64(target) / float64(max(elapsed, 1))
+			growth = max(calibratePbkdf2MinGrowth, min(growth, calibratePbkdf2MaxGrowth))
+			return &Pbkdf2WorkFactor{Iter: int(float64(iter) * growth)}, true
+		}
+	case Bcrypt:
+		wf = calibrationStart(kdf, &BcryptWorkFactor{Cost: 10})
+		step = func(wf WorkFactor, _ time.Duration) (WorkFactor, bool) {
+			cost := wf.(*BcryptWorkFactor).Cost
+			return &BcryptWorkFactor{Cost: cost + 1}, cost < 31
+		}
+	case Scrypt:
+		wf = calibrationStart(kdf, &ScryptWorkFactor{N: 16384, R: 8, P: 1})
+		if scryptMemory(wf.(*ScryptWorkFactor)) > opts.MaxMemoryBytes {
+			return nil, fmt.Errorf("Memory budget too small for scrypt: %d bytes", opts.MaxMemoryBytes)
+		}
+		step = func(wf WorkFactor, _ time.Duration) (WorkFactor, bool) {
+			next := *wf.(*ScryptWorkFactor)
+			next.N *= 2
+			if scryptMemory(&next) > opts.MaxMemoryBytes {
+				next.N /= 2
+				next.P++
+			}
+			return &next, true
+		}
+	case Argon2id, Argon2i:
+		awf := calibrationStart(kdf, &Argon2WorkFactor{Time: 1, MemoryKiB: 19456}).(*Argon2WorkFactor)
+		awf.Threads = max(awf.Threads, opts.Argon2Threads)
+		if int64(awf.MemoryKiB)*1024 > opts.MaxMemoryBytes {
+			return nil, fmt.Errorf("Memory budget too small for Argon2: %d bytes", opts.MaxMemoryBytes)
+		}
+		wf = awf
+		step = func(wf WorkFactor, _ time.Duration) (WorkFactor, bool) {
+			next := *wf.(*Argon2WorkFactor)
+			if int64(next.MemoryKiB)*2*1024 <= opts.MaxMemoryBytes {
+				next.MemoryKiB *= 2
+			} else {
+				next.Time++
+			}
+			return &next, true
+		}
+	default:
+		return nil, fmt.Errorf("Calibration is not supported for kdf: %v", kdf)
+	}
+
+	for i := 0; i < calibrateMaxSteps; i++ {
+		elapsed, err := timePasswordHash(kdf, wf, opts)
+		if err != nil {
+			return nil, err
+		}
+		if elapsed >= target {
+			return wf, nil
+		}
+		next, ok := step(wf, elapsed)
+		if !ok {
+			break
+		}
+		wf = next
+	}
+	return wf, ErrCalibrationTargetNotReached
+}
+
+// CalibrateConfig returns a copy of the DefaultConfig using the kdf and the WorkFactor calibrated by Calibrate
+func CalibrateConfig(kdf Kdf, target time.Duration, opts CalibrateOptions) (Config, error) {
+	wf, err := Calibrate(kdf, target, opts)
+	if err != nil {
+		return Config{}, err
+	}
+	opts = opts.withDefaults()
+	config := DefaultConfig
+	config.Kdf = kdf
+	config.WorkFactor = wf
+	config.SaltSize = opts.SaltSize
+	config.KeyLength = opts.KeyLength
+	return config, nil
+}
+
+// calibrationStart returns the WorkFactor to start calibrating from. e.g. the kdf's security floor
+func calibrationStart(kdf Kdf, fallback WorkFactor) WorkFactor {
+	if floor, ok := DefaultSecurityFloors.WorkFactor[kdf]; ok {
+		if wf, err := cloneWorkFactor(kdf, floor); err == nil {
+			return wf
+		}
+	}
+	return fallback
+}
+
+// scryptMemory returns the approximate memory used by scrypt in bytes
+func scryptMemory(wf *ScryptWorkFactor) int64 {
+	return 128 * int64(wf.N) * int64(wf.R)
+}
+
+// timePasswordHash returns the fastest time taken to hash a password over opts.Samples attempts
+func timePasswordHash(kdf Kdf, wf WorkFactor, opts CalibrateOptions) (time.Duration, error) {
+	salt := make([]byte, opts.SaltSize)
+	var fastest time.Duration
+	for i := 0; i < opts.Samples; i++ {
+		start := time.Now()
+		if _, err := getPasswordHash(kdf, wf, salt, opts.KeyLength, "calibration password"); err != nil {
+			return 0, err
+		}
+		if elapsed := time.Since(start); i == 0 || elapsed < fastest {
+			fastest = elapsed
+		}
+	}
+	return fastest, nil
+}
@@ -0,0 +1,89 @@
+package passhash_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dhui/passhash"
+)
+
+const testCalibrateTarget = 5 * time.Millisecond
+
+func TestCalibratePbkdf2(t *testing.T) {
+	wf, err := passhash.Calibrate(passhash.Pbkdf2Sha256, testCalibrateTarget, passhash.CalibrateOptions{Samples: 1})
+	if err != nil {
+		t.Fatal("Unable to calibrate", err)
+	}
+	if iter := wf.(*passhash.Pbkdf2WorkFactor).Iter; iter < 600000 {
+		t.Errorf("Calibrated iterations too low: %d", iter)
+	}
+}
+
+func TestCalibrateBcrypt(t *testing.T) {
+	wf, err := passhash.Calibrate(passhash.Bcrypt, testCalibrateTarget, passhash.CalibrateOptions{Samples: 1})
+	if err != nil {
+		t.Fatal("Unable to calibrate", err)
+	}
+	if cost := wf.(*passhash.BcryptWorkFactor).Cost; cost < 10 {
+		t.Errorf("Calibrated cost too low: %d", cost)
+	}
+}
+
+func TestCalibrateScryptMemoryBudget(t *testing.T) {
+	const budget = 16 * 1024 * 1024
+	wf, err := passhash.Calibrate(passhash.Scrypt, 20*time.Millisecond,
+		passhash.CalibrateOptions{MaxMemoryBytes: budget, Samples: 1})
+	if err != nil {
+		t.Fatal("Unable to calibrate", err)
+	}
+	swf := wf.(*passhash.ScryptWorkFactor)
+	if memory := 128 * swf.N * swf.R; memory > budget {
+		t.Errorf("Calibrated scrypt WorkFactor %+v exceeds memory budget: %d > %d", *swf, memory, budget)
+	}
+}
+
+func TestCalibrateArgon2MemoryBudget(t *testing.T) {
+	const budget = 32 * 1024 * 1024
+	wf, err := passhash.Calibrate(passhash.Argon2id, 20*time.Millisecond,
+		passhash.CalibrateOptions{MaxMemoryBytes: budget, Samples: 1})
+	if err != nil {
+		t.Fatal("Unable to calibrate", err)
+	}
+	awf := wf.(*passhash.Argon2WorkFactor)
+	if memory := awf.MemoryKiB * 1024; memory > budget {
+		t.Errorf("Calibrated Argon2 WorkFactor %+v exceeds memory budget: %d > %d", *awf, memory, budget)
+	}
+}
+
+func TestCalibrateMemoryBudgetTooSmall(t *testing.T) {
+	opts := passhash.CalibrateOptions{MaxMemoryBytes: 1024 * 1024}
+	if _, err := passhash.Calibrate(passhash.Scrypt, testCalibrateTarget, opts); err == nil {
+		t.Error("Calibrated scrypt with a memory budget that's too small")
+	}
+	if _, err := passhash.Calibrate(passhash.Argon2id, testCalibrateTarget, opts); err == nil {
+		t.Error("Calibrated Argon2 with a memory budget that's too small")
+	}
+}
+
+func TestCalibrateUnsupportedKdf(t *testing.T) {
+	if _, err := passhash.Calibrate(passhash.Sha512Crypt, testCalibrateTarget, passhash.CalibrateOptions{}); err == nil {
+		t.Error("Calibrated a verify only Kdf")
+	}
+}
+
+func TestCalibrateConfig(t *testing.T) {
+	config, err := passhash.CalibrateConfig(passhash.Argon2id, testCalibrateTarget, passhash.CalibrateOptions{Samples: 1})
+	if err != nil {
+		t.Fatal("Unable to calibrate", err)
+	}
+	if config.Kdf != passhash.Argon2id {
+		t.Errorf("Unexpected Kdf: %v", config.Kdf)
+	}
+	credential, err := config.NewCredential(passhash.UserID(0), testPassword)
+	if err != nil {
+		t.Fatal("Unable to create new Credential with calibrated Config", err)
+	}
+	if matched, updated := credential.MatchesPasswordWithConfig(config, testPassword); !matched || updated {
+		t.Errorf("Credential did not match without update. matched: %v updated: %v", matched, updated)
+	}
+}
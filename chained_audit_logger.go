@@ -0,0 +1,248 @@
+package passhash
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"maps"
+	"net"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// ChainSeqAttribute is the AuditEvent attribute in which a ChainedAuditLogger stores the sequence number of a log
+	ChainSeqAttribute = "chain_seq"
+	// ChainDigestAttribute is the AuditEvent attribute in which a ChainedAuditLogger stores the hex digest of a log
+	ChainDigestAttribute = "chain_digest"
+	// ChainPrevAttribute is the AuditEvent attribute in which a ChainedAuditLogger stores the hex digest of the
+	// previous log
+	ChainPrevAttribute = "chain_prev"
+)
+
+// ChainedAuditLogger is an AuditLogger decorator that makes the logs stored by an AuditLogger tamper-evident.
+// Every log is chained to the previous log by a digest over the previous log's digest, the log's sequence number, and
+// every field of the AuditEvent. The digest is an HMAC-SHA256 if a key is provided, otherwise a SHA-256.
+// Without a key, anyone able to modify the logs can recompute the digests.
+//
+// The sequence number, digest, and previous digest are stored with each log in the ChainSeqAttribute,
+// ChainDigestAttribute, and ChainPrevAttribute attributes, so the underlying AuditLogger must implement
+// ContextAuditLogger and AuditEventReader. e.g. FileAuditLogger. AuditLoggers that can't store and read back the
+// attributes (e.g. SlogAuditLogger) aren't supported. VerifyChain verifies the stored logs, so logs persisted by a
+// previous process are covered and the chain is resumed from the stored logs when a ChainedAuditLogger is created. Only
+// the head of the chain is kept in memory. If the underlying AuditLogger implements AuditEventWriter, logs it fails to
+// store aren't chained.
+//
+// The oldest stored log anchors the chain, so logs deleted by the underlying AuditLogger's retention (e.g.
+// FileAuditLoggerOptions.MaxSegments) don't break the chain, but neither do logs deleted from the start of the chain
+// by an attacker. The anchor's digest is still verified from its stored previous digest, so it can't be modified.
+// Logs deleted from the end of the chain are only detected if this ChainedAuditLogger logged them.
+// Periodically record Head outside of the process (e.g. in a separate system) to detect either.
+// The underlying AuditLogger must otherwise retain every log. e.g. a MemoryAuditLogger that evicts a user's oldest
+// logs will fail verification
+type ChainedAuditLogger struct {
+	mu   sync.Mutex
+	next ContextAuditLogger
+	key  []byte
+	seq  uint64
+	head []byte
+}
+
+// NewChainedAuditLogger creates a ChainedAuditLogger that logs to next, resuming the chain stored by next, if any.
+// A nil key uses SHA-256 instead of HMAC-SHA256. An error is returned if next doesn't implement ContextAuditLogger and
+// AuditEventReader, or if the stored logs can't be read
+func NewChainedAuditLogger(next AuditLogger, key []byte) (*ChainedAuditLogger, error) {
+	cal, ok := next.(ContextAuditLogger)
+	if !ok {
+		return nil, errors.New("ChainedAuditLogger requires a ContextAuditLogger")
+	}
+	reader, ok := next.(AuditEventReader)
+	if !ok {
+		return nil, errors.New("ChainedAuditLogger requires an AuditEventReader")
+	}
+	al := &ChainedAuditLogger{next: cal, key: key}
+	err := reader.ReadEvents(func(event AuditEvent) error {
+		if link, ok := chainLinkOf(event); ok {
+			al.seq, al.head = link.seq, link.digest
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return al, nil
+}
+
+// chainLink is the sequence number, digest, and previous digest stored in a log
+type chainLink struct {
+	seq    uint64
+	digest []byte
+	prev   []byte
+}
+
+// chainLinkOf returns the chainLink stored in the event, if any
+func chainLinkOf(event AuditEvent) (chainLink, bool) {
+	seqAttr, ok := event.Attributes[ChainSeqAttribute]
+	if !ok {
+		return chainLink{}, false
+	}
+	seq, err := strconv.ParseUint(seqAttr, 10, 64)
+	if err != nil {
+		return chainLink{}, false
+	}
+	digest, err := hex.DecodeString(event.Attributes[ChainDigestAttribute])
+	if err != nil {
+		return chainLink{}, false
+	}
+	prev, err := hex.DecodeString(event.Attributes[ChainPrevAttribute])
+	if err != nil {
+		return chainLink{}, false
+	}
+	return chainLink{seq: seq, digest: digest, prev: prev}, true
+}
+
+func isChainAttribute(k string) bool {
+	return k == ChainSeqAttribute || k == ChainDigestAttribute || k == ChainPrevAttribute
+}
+
+func (al *ChainedAuditLogger) digest(prev []byte, seq uint64, event AuditEvent) []byte {
+	var h hash.Hash
+	if al.key != nil {
+		h = hmac.New(sha256.New, al.key)
+	} else {
+		h = sha256.New()
+	}
+	var buf [8]byte
+	writeUint := func(n uint64) {
+		binary.BigEndian.PutUint64(buf[:], n)
+		h.Write(buf[:])
+	}
+	writeBytes := func(b []byte) {
+		writeUint(uint64(len(b)))
+		h.Write(b)
+	}
+	ip := event.IP
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	writeBytes(prev)
+	writeUint(seq)
+	writeUint(uint64(event.UserID))
+	writeUint(uint64(event.Type))
+	writeBytes([]byte(event.Time.UTC().Format(time.RFC3339Nano)))
+	writeBytes(ip)
+	for _, s := range []string{string(event.Reason), event.RequestID, event.UserAgent, event.ClientID} {
+		writeBytes([]byte(s))
+	}
+	keys := slices.Sorted(maps.Keys(event.Attributes))
+	keys = slices.DeleteFunc(keys, isChainAttribute)
+	writeUint(uint64(len(keys)))
+	for _, k := range keys {
+		writeBytes([]byte(k))
+		writeBytes([]byte(event.Attributes[k]))
+	}
+	return h.Sum(nil)
+}
+
+// Log logs to the underlying AuditLogger and chains the log
+func (al *ChainedAuditLogger) Log(userID UserID, at AuditType, ip net.IP) {
+	ctx := context.Background()
+	al.LogEvent(ctx, newAuditEvent(ctx, userID, at, ip, ""))
+}
+
+// LogEvent chains the event and logs it, including its sequence number and digests, to the underlying AuditLogger
+func (al *ChainedAuditLogger) LogEvent(ctx context.Context, event AuditEvent) {
+	_ = al.WriteEvent(ctx, event)
+}
+
+// WriteEvent chains the event and logs it, including its sequence number and digests, to the underlying AuditLogger.
+// If the underlying AuditLogger implements AuditEventWriter and fails to store the log, the error is returned and the
+// log isn't chained
+func (al *ChainedAuditLogger) WriteEvent(ctx context.Context, event AuditEvent) error {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	seq := al.seq + 1
+	digest := al.digest(al.head, seq, event)
+	event.Attributes = maps.Clone(event.Attributes)
+	if event.Attributes == nil {
+		event.Attributes = make(map[string]string, 3)
+	}
+	event.Attributes[ChainSeqAttribute] = strconv.FormatUint(seq, 10)
+	event.Attributes[ChainDigestAttribute] = hex.EncodeToString(digest)
+	event.Attributes[ChainPrevAttribute] = hex.EncodeToString(al.head)
+	if writer, ok := al.next.(AuditEventWriter); ok {
+		if err := writer.WriteEvent(ctx, event); err != nil {
+			return err
+		}
+	} else {
+		al.next.LogEvent(ctx, event)
+	}
+	al.seq, al.head = seq, digest
+	return nil
+}
+
+// LastN gets the last N logs for a user from the underlying AuditLogger
+func (al *ChainedAuditLogger) LastN(userID UserID, n int) []Log {
+	return al.next.LastN(userID, n)
+}
+
+// LastNWithTypes gets the last N logs for a user with the specified types from the underlying AuditLogger
+func (al *ChainedAuditLogger) LastNWithTypes(userID UserID, n int, auditTypes ...AuditType) []Log {
+	return al.next.LastNWithTypes(userID, n, auditTypes...)
+}
+
+// Head returns the digest of the latest log, or nil if nothing has been logged
+func (al *ChainedAuditLogger) Head() []byte {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	return slices.Clone(al.head)
+}
+
+// VerifyChain reads the logs back from the underlying AuditLogger and verifies their stored sequence numbers and
+// digests. An error wrapping ErrAuditChainBroken is returned if any chained log was deleted, reordered, inserted, or
+// modified
+func (al *ChainedAuditLogger) VerifyChain() error {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	var seq uint64
+	var prev []byte
+	err := al.next.(AuditEventReader).ReadEvents(func(event AuditEvent) error {
+		link, ok := chainLinkOf(event)
+		if !ok {
+			if seq == 0 {
+				// Logged before the chain started
+				return nil
+			}
+			return fmt.Errorf("%w: unchained log after log %d for user %d", ErrAuditChainBroken, seq, event.UserID)
+		}
+		if seq == 0 && link.seq > 1 {
+			// The oldest stored log anchors the chain since the logs before it were deleted
+			seq, prev = link.seq-1, link.prev
+		}
+		if link.seq != seq+1 {
+			return fmt.Errorf("%w: log %d follows log %d", ErrAuditChainBroken, link.seq, seq)
+		}
+		if !hmac.Equal(link.prev, prev) || !hmac.Equal(al.digest(prev, link.seq, event), link.digest) {
+			return fmt.Errorf("%w: log %d for user %d does not match", ErrAuditChainBroken, link.seq, event.UserID)
+		}
+		seq, prev = link.seq, link.digest
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if seq != al.seq || !hmac.Equal(prev, al.head) {
+		return fmt.Errorf("%w: the last log is %d instead of %d", ErrAuditChainBroken, seq, al.seq)
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package passhash_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/dhui/passhash"
+)
+
+func newTestChainedAuditLogger(t *testing.T, next passhash.AuditLogger,
+	key []byte) *passhash.ChainedAuditLogger {
+	t.Helper()
+	al, err := passhash.NewChainedAuditLogger(next, key)
+	if err != nil {
+		t.Fatal("Unable to create ChainedAuditLogger", err)
+	}
+	return al
+}
+
+// setupChainedAuditLoggerTestData logs test data for two users, including an AuditEvent with metadata
+func setupChainedAuditLoggerTestData(al *passhash.ChainedAuditLogger) {
+	setupAuditLoggerTestData(passhash.UserID(1), al)
+	al.LogEvent(context.Background(), passhash.AuditEvent{UserID: passhash.UserID(2), Type: passhash.AuthnFailed,
+		IP: net.ParseIP("192.0.2.1"), Reason: passhash.ReasonWrongPassword, RequestID: "request-1",
+		Attributes: map[string]string{"tenant": "a"}})
+	setupAuditLoggerTestData(passhash.UserID(2), al)
+}
+
+var chainedAuditLoggerTamperTests = map[string]func(*fakeAuditLogger){
+	"modified type":       func(al *fakeAuditLogger) { al.events[4].Type = passhash.AuthnSucceeded },
+	"modified ip":         func(al *fakeAuditLogger) { al.events[15].IP = net.ParseIP("192.0.2.2") },
+	"modified user":       func(al *fakeAuditLogger) { al.events[0].UserID = passhash.UserID(2) },
+	"modified time":       func(al *fakeAuditLogger) { al.events[3].Time = al.events[3].Time.Add(time.Second) },
+	"modified reason":     func(al *fakeAuditLogger) { al.events[15].Reason = passhash.ReasonStoreError },
+	"modified request id": func(al *fakeAuditLogger) { al.events[15].RequestID = "request-2" },
+	"modified attribute":  func(al *fakeAuditLogger) { al.events[15].Attributes["tenant"] = "b" },
+	"modified sequence": func(al *fakeAuditLogger) {
+		al.events[4].Attributes[passhash.ChainSeqAttribute] = al.events[5].Attributes[passhash.ChainSeqAttribute]
+	},
+	"deleted":        func(al *fakeAuditLogger) { al.events = append(al.events[:4], al.events[5:]...) },
+	"deleted last":   func(al *fakeAuditLogger) { al.events = al.events[:len(al.events)-1] },
+	"reordered":      func(al *fakeAuditLogger) { al.events[1], al.events[2] = al.events[2], al.events[1] },
+	"inserted":       func(al *fakeAuditLogger) { al.Log(passhash.UserID(1), passhash.AuthnSucceeded, nil) },
+	"modified first": func(al *fakeAuditLogger) { al.events[0].Type = passhash.AuthnFailed },
+	"deleted first and modified oldest": func(al *fakeAuditLogger) {
+		al.events = al.events[3:]
+		al.events[0].Type = passhash.AuthnFailed
+	},
+	"deleted first and modified oldest prev": func(al *fakeAuditLogger) {
+		al.events = al.events[3:]
+		al.events[0].Attributes[passhash.ChainPrevAttribute] = al.events[1].Attributes[passhash.ChainPrevAttribute]
+	},
+}
+
+func TestChainedAuditLoggerVerifyChain(t *testing.T) {
+	for _, key := range [][]byte{nil, []byte("key")} {
+		al := newTestChainedAuditLogger(t, &fakeAuditLogger{}, key)
+		setupChainedAuditLoggerTestData(al)
+		if err := al.VerifyChain(); err != nil {
+			t.Error("Untampered chain is broken", err)
+		}
+	}
+}
+
+func TestChainedAuditLoggerTampered(t *testing.T) {
+	for name, tamper := range chainedAuditLoggerTamperTests {
+		t.Run(name, func(t *testing.T) {
+			next := &fakeAuditLogger{}
+			al := newTestChainedAuditLogger(t, next, []byte("key"))
+			setupChainedAuditLoggerTestData(al)
+			tamper(next)
+			if err := al.VerifyChain(); !errors.Is(err, passhash.ErrAuditChainBroken) {
+				t.Error("Expected ErrAuditChainBroken. Got:", err)
+			}
+		})
+	}
+}
+
+func TestChainedAuditLoggerHead(t *testing.T) {
+	next := &passhash.MemoryAuditLogger{}
+	al := newTestChainedAuditLogger(t, next, []byte("key"))
+	if head := al.Head(); head != nil {
+		t.Error("Empty chain has a head", head)
+	}
+	al.Log(passhash.UserID(1), passhash.AuthnSucceeded, passhash.EmptyIP)
+	head := al.Head()
+	if len(head) != 32 {
+		t.Errorf("Unexpected head length. %d != 32", len(head))
+	}
+	al.Log(passhash.UserID(1), passhash.AuthnSucceeded, passhash.EmptyIP)
+	if bytes.Equal(head, al.Head()) {
+		t.Error("Head unchanged after logging")
+	}
+
+	otherKey := newTestChainedAuditLogger(t, &passhash.MemoryAuditLogger{}, []byte("other key"))
+	otherKey.Log(passhash.UserID(1), passhash.AuthnSucceeded, passhash.EmptyIP)
+	if bytes.Equal(head, otherKey.Head()) {
+		t.Error("Heads with different keys are equal")
+	}
+	if l := len(al.LastN(passhash.UserID(1), 10)); l != 2 {
+		t.Errorf("Logs not forwarded. Have %d logs instead of 2", l)
+	}
+	if l := len(al.LastNWithTypes(passhash.UserID(1), 10, passhash.AuthnSucceeded)); l != 2 {
+		t.Errorf("Logs not forwarded. Have %d logs instead of 2", l)
+	}
+}
+
+func TestChainedAuditLoggerFileAuditLogger(t *testing.T) {
+	dir := t.TempDir()
+	next := openTestFileAuditLogger(t, passhash.FileAuditLoggerOptions{Dir: dir})
+	al := newTestChainedAuditLogger(t, next, []byte("key"))
+	setupAuditLoggerTestData(passhash.UserID(1), al)
+	al.Log(passhash.UserID(1), passhash.AuthnFailed, net.ParseIP("192.0.2.1"))
+	if err := al.VerifyChain(); err != nil {
+		t.Fatal("Untampered chain is broken", err)
+	}
+
+	path := segments(t, dir)[0]
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Replace the first authn_failed with an upgraded_kdf of the same length so the index stays valid
+	tampered := bytes.Replace(data, []byte("authn_failed"), []byte("upgraded_kdf"), 1)
+	if err := os.WriteFile(path, tampered, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := al.VerifyChain(); !errors.Is(err, passhash.ErrAuditChainBroken) {
+		t.Error("Expected ErrAuditChainBroken. Got:", err)
+	}
+}
+
+func TestNewChainedAuditLoggerUnsupported(t *testing.T) {
+	for _, next := range []passhash.AuditLogger{&passhash.DummyAuditLogger{}, passhash.NewSlogAuditLogger(nil,
+		passhash.SlogAuditLoggerOptions{})} {
+		if _, err := passhash.NewChainedAuditLogger(next, nil); err == nil {
+			t.Errorf("Expected error for %T", next)
+		}
+	}
+}
+
+func TestChainedAuditLoggerResume(t *testing.T) {
+	dir := t.TempDir()
+	next, err := passhash.OpenFileAuditLogger(passhash.FileAuditLoggerOptions{Dir: dir})
+	if err != nil {
+		t.Fatal("Unable to open FileAuditLogger", err)
+	}
+	next.Log(passhash.UserID(1), passhash.AuthnSucceeded, nil) // Logged before the chain started
+	al := newTestChainedAuditLogger(t, next, []byte("key"))
+	setupAuditLoggerTestData(passhash.UserID(1), al)
+	head := al.Head()
+	if err := next.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	next = openTestFileAuditLogger(t, passhash.FileAuditLoggerOptions{Dir: dir})
+	al = newTestChainedAuditLogger(t, next, []byte("key"))
+	if !bytes.Equal(head, al.Head()) {
+		t.Fatal("Chain not resumed from the stored logs")
+	}
+	setupAuditLoggerTestData(passhash.UserID(2), al)
+	if err := al.VerifyChain(); err != nil {
+		t.Fatal("Untampered chain is broken", err)
+	}
+	if err := newTestChainedAuditLogger(t, next, []byte("other key")).VerifyChain(); !errors.Is(err,
+		passhash.ErrAuditChainBroken) {
+		t.Error("Expected ErrAuditChainBroken with another key. Got:", err)
+	}
+}
+
+func TestChainedAuditLoggerRetention(t *testing.T) {
+	next := openTestFileAuditLogger(t, passhash.FileAuditLoggerOptions{Dir: t.TempDir(), MaxSegmentBytes: 512,
+		MaxSegments: 2})
+	al := newTestChainedAuditLogger(t, next, []byte("key"))
+	for i := 0; i < 5; i++ {
+		setupAuditLoggerTestData(passhash.UserID(1), al)
+	}
+	if err := al.VerifyChain(); err != nil {
+		t.Error("Chain broken by retention", err)
+	}
+}
+
+func TestChainedAuditLoggerWriteError(t *testing.T) {
+	next := openTestFileAuditLogger(t, passhash.FileAuditLoggerOptions{Dir: t.TempDir()})
+	al := newTestChainedAuditLogger(t, next, []byte("key"))
+	setupAuditLoggerTestData(passhash.UserID(1), al)
+	head := al.Head()
+	if err := next.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := al.WriteEvent(context.Background(), passhash.AuditEvent{UserID: passhash.UserID(1),
+		Type: passhash.AuthnSucceeded}); !errors.Is(err, passhash.ErrAuditLoggerClosed) {
+		t.Error("Expected ErrAuditLoggerClosed. Got:", err)
+	}
+	al.Log(passhash.UserID(1), passhash.AuthnSucceeded, passhash.EmptyIP)
+	if !bytes.Equal(head, al.Head()) {
+		t.Error("Logs that weren't written were chained")
+	}
+	if err := al.VerifyChain(); err != nil {
+		t.Error("Chain broken by write errors", err)
+	}
+}
@@ -0,0 +1,143 @@
+package passhash
+
+import (
+	_ "embed" // Embeds the common password list
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// commonPasswordsList is a newline-separated list of common passwords, from most to least common. Lines starting with
+// # are comments. The list is from zxcvbn-go and is distributed under its MIT license. See the header of
+// common_passwords.txt
+//
+//go:embed common_passwords.txt
+var commonPasswordsList string
+
+// minCommonPasswordFormLen is the minimum length of a normalized form that's checked, so that trimming doesn't reject
+// passwords for containing a short common word
+const minCommonPasswordFormLen = 4
+
+// commonPasswords maps the case folded and collapsed forms of the common passwords to their ranks
+type commonPasswords struct {
+	folded    map[string]int
+	collapsed map[string]int
+}
+
+var loadCommonPasswords = sync.OnceValue(func() commonPasswords {
+	cp := commonPasswords{folded: make(map[string]int), collapsed: make(map[string]int)}
+	rank := -1
+	for _, password := range strings.Split(strings.TrimSpace(commonPasswordsList), "\n") {
+		if password = strings.TrimSpace(password); password == "" || strings.HasPrefix(password, "#") {
+			continue
+		}
+		rank++
+		folded := strings.ToLower(password)
+		if _, ok := cp.folded[folded]; !ok {
+			cp.folded[folded] = rank
+		}
+		if collapsed := collapseRepeats(folded); len(collapsed) > 0 {
+			if _, ok := cp.collapsed[collapsed]; !ok {
+				cp.collapsed[collapsed] = rank
+			}
+		}
+	}
+	return cp
+})
+
+// passwordNormalization transforms a password into one or more normalized forms
+type passwordNormalization struct {
+	name      string
+	normalize func(string) []string
+}
+
+var leetReplacers = []*strings.Replacer{
+	strings.NewReplacer("0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t", "8", "b", "9", "g", "@", "a",
+		"$", "s", "!", "i", "+", "t"),
+	strings.NewReplacer("0", "o", "1", "l", "3", "e", "4", "a", "5", "s", "7", "t", "8", "b", "9", "g", "@", "a",
+		"$", "s", "!", "l", "+", "t", "|", "l"),
+}
+
+var (
+	foldCase = passwordNormalization{"case folding", func(s string) []string {
+		return []string{strings.ToLower(s)}
+	}}
+	substituteLeet = passwordNormalization{"leetspeak substitution", func(s string) []string {
+		forms := make([]string, 0, len(leetReplacers))
+		for _, r := range leetReplacers {
+			forms = append(forms, r.Replace(s))
+		}
+		return forms
+	}}
+	trimNonLetters = passwordNormalization{"trimming digits and symbols", func(s string) []string {
+		return []string{strings.TrimFunc(s, func(r rune) bool { return !unicode.IsLetter(r) })}
+	}}
+	collapseRepeated = passwordNormalization{"collapsing repeated characters", func(s string) []string {
+		return []string{collapseRepeats(s)}
+	}}
+)
+
+// commonPasswordPipelines are the normalizations applied to a password, in order of increasing fuzziness
+var commonPasswordPipelines = [][]passwordNormalization{
+	{foldCase},
+	{foldCase, trimNonLetters},
+	{foldCase, substituteLeet},
+	{foldCase, trimNonLetters, substituteLeet},
+	{foldCase, substituteLeet, trimNonLetters},
+	{foldCase, collapseRepeated},
+	{foldCase, trimNonLetters, collapseRepeated},
+	{foldCase, substituteLeet, collapseRepeated},
+	{foldCase, trimNonLetters, substituteLeet, collapseRepeated},
+	{foldCase, substituteLeet, trimNonLetters, collapseRepeated},
+}
+
+func collapseRepeats(s string) string {
+	var b strings.Builder
+	var prev rune = -1
+	for _, r := range s {
+		if r != prev {
+			b.WriteRune(r)
+		}
+		prev = r
+	}
+	return b.String()
+}
+
+// NotCommonPassword is a PasswordPolicy that rejects passwords in an embedded list of common passwords. Unlike
+// NotCommonPasswordNaive, passwords are normalized before being checked, by case folding, leetspeak substitution,
+// trimming leading and trailing digits and symbols, and collapsing repeated characters. e.g. "Password1!" and
+// "p@ssw0rd" are rejected since they normalize to "password"
+type NotCommonPassword struct {
+	TopN int // Only check the N most common passwords. 0 checks the whole list
+}
+
+// PasswordAcceptable accepts passwords that don't normalize to a common password
+func (pp NotCommonPassword) PasswordAcceptable(password string) error {
+	cp := loadCommonPasswords()
+	for _, pipeline := range commonPasswordPipelines {
+		forms := []string{password}
+		steps := make([]string, 0, len(pipeline))
+		for _, n := range pipeline {
+			steps = append(steps, n.name)
+			var next []string
+			for _, form := range forms {
+				next = append(next, n.normalize(form)...)
+			}
+			forms = next
+		}
+		ranks := cp.folded
+		if pipeline[len(pipeline)-1].name == collapseRepeated.name {
+			ranks = cp.collapsed
+		}
+		for _, form := range forms {
+			if utf8.RuneCountInString(form) < minCommonPasswordFormLen {
+				continue
+			}
+			if rank, ok := ranks[form]; ok && (pp.TopN <= 0 || rank < pp.TopN) {
+				return CommonPasswordError{Form: form, Normalization: strings.Join(steps, ", ")}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package passhash_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/dhui/passhash"
+)
+
+func TestNotCommonPasswordRejected(t *testing.T) {
+	for password, expected := range map[string]passhash.CommonPasswordError{
+		"password":    {Form: "password", Normalization: "case folding"},
+		"PASSWORD":    {Form: "password", Normalization: "case folding"},
+		"Password99!": {Form: "password", Normalization: "case folding, trimming digits and symbols"},
+		"p@ssw0rd":    {Form: "password", Normalization: "case folding, leetspeak substitution"},
+		"P@55W0RD":    {Form: "password", Normalization: "case folding, leetspeak substitution"},
+		"!!m0nk3y2024": {Form: "monkey",
+			Normalization: "case folding, trimming digits and symbols, leetspeak substitution"},
+		"@dmin":         {Form: "admin", Normalization: "case folding, leetspeak substitution"},
+		"passsswoooord": {Form: "pasword", Normalization: "case folding, collapsing repeated characters"},
+		"#Dragonnnn999#": {Form: "dragon",
+			Normalization: "case folding, trimming digits and symbols, collapsing repeated characters"},
+		"1ov3rs": {Form: "lovers", Normalization: "case folding, leetspeak substitution"},
+	} {
+		err := passhash.NotCommonPassword{}.PasswordAcceptable(password)
+		if !errors.Is(err, passhash.ErrCommonPassword) {
+			t.Errorf("Common password %q was accepted: %v", password, err)
+			continue
+		}
+		var cpErr passhash.CommonPasswordError
+		if !errors.As(err, &cpErr) || cpErr != expected {
+			t.Errorf("Unexpected error for %q. %+v != %+v", password, cpErr, expected)
+		}
+	}
+}
+
+func TestNotCommonPasswordAccepted(t *testing.T) {
+	for _, password := range []string{testPassword, "correct horse battery staple", "x7#Kq!v9", "ann123"} {
+		if err := (passhash.NotCommonPassword{}).PasswordAcceptable(password); err != nil {
+			t.Errorf("Uncommon password %q was rejected: %v", password, err)
+		}
+	}
+}
+
+func TestNotCommonPasswordTopN(t *testing.T) {
+	if err := (passhash.NotCommonPassword{TopN: 10}).PasswordAcceptable("password1"); err == nil {
+		t.Error("Top 10 common password was accepted")
+	}
+	if err := (passhash.NotCommonPassword{TopN: 10}).PasswordAcceptable("butterfly"); err != nil {
+		t.Error("Password outside of the top 10 was rejected", err)
+	}
+}
+
+func TestNotCommonPasswordErrorMessage(t *testing.T) {
+	err := passhash.NotCommonPassword{}.PasswordAcceptable("Password99!")
+	expected := `Password is a common password (matched "password" after case folding, trimming digits and symbols)`
+	if err == nil || err.Error() != expected {
+		t.Errorf("Unexpected error message. %v != %s", err, expected)
+	}
+}
@@ -1,7 +1,10 @@
 package passhash
 
 import (
+	"cmp"
+	"context"
 	"crypto/rand"
+	"errors"
 	"fmt"
 	"io"
 	"reflect"
@@ -28,20 +31,12 @@ type WorkFactor interface {
 }
 
 // cloneWorkFactor returns an independent copy of the provided WorkFactor
-func cloneWorkFactor(wf WorkFactor) (WorkFactor, error) {
-	switch v := wf.(type) {
-	case *Pbkdf2WorkFactor:
-		c := *v
-		return &c, nil
-	case *BcryptWorkFactor:
-		c := *v
-		return &c, nil
-	case *ScryptWorkFactor:
-		c := *v
-		return &c, nil
-	default:
-		return nil, fmt.Errorf("unsupported WorkFactor type: %T", wf)
+func cloneWorkFactor(kdf Kdf, wf WorkFactor) (WorkFactor, error) {
+	impl, err := getKdf(kdf)
+	if err != nil {
+		return nil, err
 	}
+	return impl.CloneWorkFactor(wf)
 }
 
 // WorkFactorsEqual determines if 2 WorkFactors are equivalent
@@ -60,6 +55,62 @@ func WorkFactorsEqual(a, b WorkFactor) bool {
 	return slices.Equal(aM, bM)
 }
 
+// ComparableWorkFactor is a WorkFactor that orders itself by strength. Custom WorkFactors may implement it when
+// comparing their marshaled parameters (see CompareWorkFactors) doesn't reflect their strength
+type ComparableWorkFactor interface {
+	WorkFactor
+	// Compare returns -1 if the WorkFactor is weaker than other, 0 if they're equivalent, and +1 if it's stronger
+	Compare(other WorkFactor) (int, error)
+}
+
+// CompareWorkFactors returns -1 if a is weaker than b, 0 if they're equivalent, and +1 if a is stronger than b.
+// Unless a is a ComparableWorkFactor, a is only weaker (or stronger) than b if none of its marshaled parameters are
+// stronger (or weaker) than b's. Otherwise, e.g. for scrypt with a larger N but a smaller r, ErrIncomparableWorkFactors
+// is returned
+func CompareWorkFactors(a, b WorkFactor) (int, error) {
+	if cwf, ok := a.(ComparableWorkFactor); ok {
+		return cwf.Compare(b)
+	}
+	if reflect.TypeOf(a) != reflect.TypeOf(b) {
+		return 0, fmt.Errorf("%w: %T and %T", ErrIncomparableWorkFactors, a, b)
+	}
+	aM, err := a.Marshal()
+	if err != nil {
+		return 0, err
+	}
+	bM, err := b.Marshal()
+	if err != nil {
+		return 0, err
+	}
+	if len(aM) != len(bM) {
+		return 0, fmt.Errorf("%w: %v and %v", ErrIncomparableWorkFactors, aM, bM)
+	}
+	result := 0
+	for i := range aM {
+		c := cmp.Compare(aM[i], bM[i])
+		if c == 0 {
+			continue
+		}
+		if result != 0 && c != result {
+			return 0, fmt.Errorf("%w: %v and %v", ErrIncomparableWorkFactors, aM, bM)
+		}
+		result = c
+	}
+	return result, nil
+}
+
+// UpgradePolicy determines when a Credential is rehashed to meet a Config. See Credential.MeetsConfig
+type UpgradePolicy int
+
+const (
+	// UpgradeExactMatch rehashes Credentials unless their Kdf and WorkFactor exactly match the Config's.
+	// Credentials with a stronger WorkFactor are downgraded.
+	UpgradeExactMatch UpgradePolicy = iota
+	// UpgradeIfWeaker only rehashes Credentials with a different Kdf or a WorkFactor that is weaker than (or
+	// incomparable to) the Config's
+	UpgradeIfWeaker
+)
+
 // Pbkdf2WorkFactor specifies the work/cost parameters for PBKDF2
 type Pbkdf2WorkFactor struct {
 	Iter int
@@ -121,6 +172,49 @@ func (wf *ScryptWorkFactor) Unmarshal(p []int) error {
 	return nil
 }
 
+// Argon2WorkFactor specifies the work/cost parameters for Argon2id and Argon2i
+type Argon2WorkFactor struct {
+	Time      int // The number of passes over the memory
+	MemoryKiB int // The amount of memory used in KiB
+	Threads   int // The degree of parallelism. Must be between 1 and 255
+}
+
+// Marshal returns the marshaled WorkFactor
+func (wf *Argon2WorkFactor) Marshal() ([]int, error) {
+	return []int{wf.Time, wf.MemoryKiB, wf.Threads}, nil
+}
+
+// Unmarshal unmarshals the WorkFactor
+func (wf *Argon2WorkFactor) Unmarshal(p []int) error {
+	if len(p) != 3 {
+		return fmt.Errorf("Invalid parameters to unmarshal %T", wf)
+	}
+	wf.Time = p[0]
+	wf.MemoryKiB = p[1]
+	wf.Threads = p[2]
+	return nil
+}
+
+// LegacyWorkFactor specifies the work/cost parameters for the legacy (verify only) Kdfs.
+// e.g. Md5Crypt, Sha256Crypt, Sha512Crypt, and LdapSsha
+type LegacyWorkFactor struct {
+	Rounds int
+}
+
+// Marshal returns the marshaled WorkFactor
+func (wf *LegacyWorkFactor) Marshal() ([]int, error) {
+	return []int{wf.Rounds}, nil
+}
+
+// Unmarshal unmarshals the WorkFactor
+func (wf *LegacyWorkFactor) Unmarshal(p []int) error {
+	if len(p) != 1 {
+		return fmt.Errorf("Invalid parameters to unmarshal %T", wf)
+	}
+	wf.Rounds = p[0]
+	return nil
+}
+
 // Config provides configuration for managing credentials. e.g. creation, storing, verifying, and auditing
 type Config struct {
 	Kdf              Kdf              // The key derivation function
@@ -130,31 +224,190 @@ type Config struct {
 	AuditLogger      AuditLogger      // The AuditLogger to use
 	Store            CredentialStore  // The CredentialStore to use
 	PasswordPolicies []PasswordPolicy // The password policies to enforce
+	// TextSalt generates salts of SaltSize alphanumeric characters instead of random bytes. This is only needed to
+	// encode Credentials in formats that embed the salt as text (e.g. Django and Werkzeug)
+	TextSalt bool
+	// UpgradePolicy determines when Credentials are rehashed to meet the Config. Defaults to UpgradeExactMatch
+	UpgradePolicy UpgradePolicy
+	// LockoutPolicy locks accounts after too many failed authentication attempts. nil disables lockouts
+	LockoutPolicy *LockoutPolicy
+	// RateLimiter limits password verifications before any hashing happens. nil disables rate limiting
+	RateLimiter RateLimiter
+	// SecurityFloors are the minimum parameters accepted by Validate. nil uses DefaultSecurityFloors
+	SecurityFloors *SecurityFloors
+	// ExpertOverride allows NewCredential and the Credential methods to use a Config that fails Validate.
+	// Do not set unless you're an expert.
+	ExpertOverride bool
 }
 
-// NewCredential creates a new Credential with the provided Config
-func (c Config) NewCredential(userID UserID, password string) (*Credential, error) {
-	passwordPolicyFailures := PasswordPoliciesNotMet{}
-	for _, pp := range c.PasswordPolicies {
-		if err := pp.PasswordAcceptable(password); err != nil {
-			passwordPolicyFailures.UnMetPasswordPolicies = append(passwordPolicyFailures.UnMetPasswordPolicies,
-				PasswordPolicyError{PasswordPolicy: pp, Err: err})
+// SecurityFloors specifies the minimum parameters accepted by Config.Validate
+type SecurityFloors struct {
+	SaltSize   int                // The minimum size of the salt in bytes
+	KeyLength  int                // The minimum size of the output key in bytes
+	WorkFactor map[Kdf]WorkFactor // The minimum WorkFactor for each Kdf. Every marshaled parameter must be at least the minimum
+	// EquivalentWorkFactors are alternative minimum WorkFactors for each Kdf that are as strong as the WorkFactor
+	// floor. e.g. Argon2 settings that trade memory for time. A WorkFactor meeting any of them is accepted
+	EquivalentWorkFactors map[Kdf][]WorkFactor
+}
+
+// Validate checks that the Config is usable and that its parameters meet the security floors.
+// The returned error wraps ErrNilAuditLogger, ErrNilStore, ErrVerifyOnlyKdf, WorkFactorMismatchError, and
+// BelowSecurityFloorError as appropriate and may be inspected using errors.Is and errors.As
+func (c Config) Validate() error {
+	var errs []error
+	if c.AuditLogger == nil {
+		errs = append(errs, ErrNilAuditLogger)
+	}
+	if c.Store == nil {
+		errs = append(errs, ErrNilStore)
+	}
+	return errors.Join(append(errs, c.validateKdf())...)
+}
+
+// validateKdf checks the Kdf parameters of the Config. These are the only parameters needed to hash and verify
+// passwords
+func (c Config) validateKdf() error {
+	var errs []error
+	impl, err := getKdf(c.Kdf)
+	if err != nil {
+		return errors.Join(append(errs, err)...)
+	}
+	if _, ok := impl.(verifyOnly); ok {
+		errs = append(errs, ErrVerifyOnlyKdf)
+	}
+	if c.WorkFactor == nil || reflect.TypeOf(c.WorkFactor) != reflect.TypeOf(impl.NewWorkFactor()) {
+		return errors.Join(append(errs, WorkFactorMismatchError{Kdf: c.Kdf, WorkFactor: c.WorkFactor})...)
+	}
+	floors := c.SecurityFloors
+	if floors == nil {
+		floors = &DefaultSecurityFloors
+	}
+	if c.Kdf != Bcrypt { // bcrypt generates its own salt and has a fixed output size
+		if c.SaltSize < floors.SaltSize {
+			errs = append(errs, BelowSecurityFloorError{Parameter: "SaltSize", Value: c.SaltSize, Minimum: floors.SaltSize})
+		}
+		if c.KeyLength < floors.KeyLength {
+			errs = append(errs, BelowSecurityFloorError{Parameter: "KeyLength", Value: c.KeyLength,
+				Minimum: floors.KeyLength})
 		}
 	}
-	if len(passwordPolicyFailures.UnMetPasswordPolicies) > 0 {
-		return nil, passwordPolicyFailures
+	if minimum, ok := floors.WorkFactor[c.Kdf]; ok && workFactorBelow(c.WorkFactor,
+		append([]WorkFactor{minimum}, floors.EquivalentWorkFactors[c.Kdf]...)) {
+		errs = append(errs, BelowSecurityFloorError{Parameter: "WorkFactor", Value: c.WorkFactor, Minimum: minimum})
 	}
-	salt := make([]byte, c.SaltSize)
-	if _, err := io.ReadFull(randReader, salt); err != nil {
+	return errors.Join(errs...)
+}
+
+// validate validates the Config unless ExpertOverride is set
+func (c Config) validate() error {
+	if c.ExpertOverride {
+		return nil
+	}
+	return c.Validate()
+}
+
+// validateHashing validates the Kdf parameters of the Config unless ExpertOverride is set. The Store and AuditLogger
+// aren't needed to hash or verify passwords, so they may be nil
+func (c Config) validateHashing() error {
+	if c.ExpertOverride {
+		return nil
+	}
+	if err := c.validateKdf(); err != nil {
+		return ConfigError{Err: err}
+	}
+	return nil
+}
+
+// workFactorBelow determines if the WorkFactor is below every minimum. i.e. any of its parameters are below each
+// minimum's
+func workFactorBelow(wf WorkFactor, minimums []WorkFactor) bool {
+	for _, minimum := range minimums {
+		if c, err := CompareWorkFactors(wf, minimum); err == nil && c >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// NewCredential creates a new Credential with the provided Config and logs CredentialCreated, or
+// PasswordPolicyRejected if the password doesn't meet the PasswordPolicies.
+// Unless ExpertOverride is set, a ConfigError is returned if the Config's Kdf parameters fail Validate. The Store and
+// AuditLogger may be nil.
+func (c Config) NewCredential(userID UserID, password string) (*Credential, error) {
+	return c.createCredential(context.Background(), userID, password)
+}
+
+// NewCredentialWithAttributes is NewCredential, but UserPasswordPolicies also check the password against the user's
+// attributes. e.g. NotUserInfo
+func (c Config) NewCredentialWithAttributes(userID UserID, password string, attributes UserAttributes) (*Credential,
+	error) {
+	return c.createCredential(WithUserAttributes(context.Background(), attributes), userID, password)
+}
+
+// createCredential creates a new Credential and audits its creation using the context's metadata
+func (c Config) createCredential(ctx context.Context, userID UserID, password string) (*Credential, error) {
+	credential, err := c.newCredential(ctx, userID, password)
+	if err != nil {
+		c.auditPolicyRejection(ctx, userID, err, EmptyIP)
+		return nil, err
+	}
+	c.auditLog(ctx, userID, CredentialCreated, EmptyIP, "")
+	return credential, nil
+}
+
+// newCredential creates a new Credential with the provided Config without auditing. The PasswordPolicies are checked
+// with the UserAttributes from the context
+func (c Config) newCredential(ctx context.Context, userID UserID, password string) (*Credential, error) {
+	if err := c.validateHashing(); err != nil {
+		return nil, err
+	}
+	if err := c.checkPasswordPolicies(ctx, userID, password); err != nil {
+		return nil, err
+	}
+	return c.hashCredential(userID, password)
+}
+
+// hashCredential creates a new Credential with the provided Config without validating the Config or checking the
+// PasswordPolicies
+func (c Config) hashCredential(userID UserID, password string) (*Credential, error) {
+	salt, err := c.newSalt()
+	if err != nil {
 		return nil, err
 	}
 	hash, err := getPasswordHash(c.Kdf, c.WorkFactor, salt, c.KeyLength, password)
 	if err != nil {
 		return nil, err
 	}
-	wfCopy, err := cloneWorkFactor(c.WorkFactor)
+	wfCopy, err := cloneWorkFactor(c.Kdf, c.WorkFactor)
 	if err != nil {
 		return nil, err
 	}
 	return &Credential{UserID: userID, Kdf: c.Kdf, WorkFactor: wfCopy, Salt: salt, Hash: hash}, nil
 }
+
+// textSaltAlphabet is the alphabet used to generate text salts
+const textSaltAlphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// newSalt generates a new random salt for the Config
+func (c Config) newSalt() ([]byte, error) {
+	salt := make([]byte, c.SaltSize)
+	if _, err := io.ReadFull(randReader, salt); err != nil {
+		return nil, err
+	}
+	if !c.TextSalt {
+		return salt, nil
+	}
+	// Use rejection sampling to avoid modulo bias
+	maxByte := byte(256 - 256%len(textSaltAlphabet))
+	buf := make([]byte, 1)
+	for i, b := range salt {
+		for b >= maxByte {
+			if _, err := io.ReadFull(randReader, buf); err != nil {
+				return nil, err
+			}
+			b = buf[0]
+		}
+		salt[i] = textSaltAlphabet[int(b)%len(textSaltAlphabet)]
+	}
+	return salt, nil
+}
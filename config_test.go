@@ -66,6 +66,73 @@ func TestWorkFactorsEqualDifferent(t *testing.T) {
 	}
 }
 
+// reversedWorkFactor is weaker the larger its Cost is
+type reversedWorkFactor struct {
+	Cost int
+}
+
+func (wf *reversedWorkFactor) Marshal() ([]int, error) { return []int{wf.Cost}, nil }
+func (wf *reversedWorkFactor) Unmarshal([]int) error   { return nil }
+func (wf *reversedWorkFactor) Compare(other passhash.WorkFactor) (int, error) {
+	return other.(*reversedWorkFactor).Cost - wf.Cost, nil
+}
+
+var compareWorkFactorsTests = map[string]struct {
+	a, b     passhash.WorkFactor
+	expected int
+}{
+	"equal":            {a: &passhash.ScryptWorkFactor{R: 8, P: 1, N: 2}, b: &passhash.ScryptWorkFactor{R: 8, P: 1, N: 2}, expected: 0},
+	"weaker":           {a: &passhash.ScryptWorkFactor{R: 8, P: 1, N: 2}, b: &passhash.ScryptWorkFactor{R: 8, P: 1, N: 4}, expected: -1},
+	"stronger":         {a: &passhash.ScryptWorkFactor{R: 8, P: 2, N: 4}, b: &passhash.ScryptWorkFactor{R: 8, P: 1, N: 4}, expected: 1},
+	"stronger pbkdf2":  {a: &passhash.Pbkdf2WorkFactor{Iter: 2}, b: &passhash.Pbkdf2WorkFactor{Iter: 1}, expected: 1},
+	"weaker argon2":    {a: &passhash.Argon2WorkFactor{Time: 1, MemoryKiB: 64, Threads: 1}, b: &passhash.Argon2WorkFactor{Time: 2, MemoryKiB: 64, Threads: 1}, expected: -1},
+	"comparable":       {a: &reversedWorkFactor{Cost: 1}, b: &reversedWorkFactor{Cost: 2}, expected: 1},
+	"comparable equal": {a: &reversedWorkFactor{Cost: 2}, b: &reversedWorkFactor{Cost: 2}, expected: 0},
+}
+
+func TestCompareWorkFactors(t *testing.T) {
+	for name, test := range compareWorkFactorsTests {
+		t.Run(name, func(t *testing.T) {
+			c, err := passhash.CompareWorkFactors(test.a, test.b)
+			if err != nil {
+				t.Fatal("Unable to compare WorkFactors", err)
+			}
+			if c != test.expected {
+				t.Errorf("Unexpected comparison of %v and %v. %d != %d", test.a, test.b, c, test.expected)
+			}
+		})
+	}
+}
+
+var compareWorkFactorsErrorTests = map[string]struct {
+	a, b passhash.WorkFactor
+}{
+	"different types": {a: &passhash.Pbkdf2WorkFactor{}, b: &passhash.BcryptWorkFactor{}},
+	"different lens":  {a: TestingWorkFactor{Len: 10}, b: TestingWorkFactor{Len: 5}},
+	"incomparable":    {a: &passhash.ScryptWorkFactor{R: 16, P: 1, N: 2}, b: &passhash.ScryptWorkFactor{R: 8, P: 1, N: 4}},
+}
+
+func TestCompareWorkFactorsIncomparable(t *testing.T) {
+	for name, test := range compareWorkFactorsErrorTests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := passhash.CompareWorkFactors(test.a, test.b); !errors.Is(err, passhash.ErrIncomparableWorkFactors) {
+				t.Error("Expected ErrIncomparableWorkFactors. Got:", err)
+			}
+		})
+	}
+}
+
+func TestCompareWorkFactorsMarshalError(t *testing.T) {
+	a := TestingWorkFactor{Error: true, Len: 10}
+	b := TestingWorkFactor{Error: false, Len: 10}
+	if _, err := passhash.CompareWorkFactors(a, b); err == nil {
+		t.Error("Compared WorkFactors with marshaling error")
+	}
+	if _, err := passhash.CompareWorkFactors(b, a); err == nil {
+		t.Error("Compared WorkFactors with marshaling error")
+	}
+}
+
 func TestConfigNewCredentialFailsPasswordPolicies(t *testing.T) {
 	userID := passhash.UserID(0)
 	password := "tooshort"
@@ -172,6 +239,34 @@ func TestScryptWorkFactorUnmarshalError(t *testing.T) {
 	testWorkFactorUnmarshalError(t, []int{1, 2, 3, 4}, &passhash.BcryptWorkFactor{})
 }
 
+func TestArgon2WorkFactorMarshal(t *testing.T) {
+	testWorkFactorMarshal(t, &passhash.Argon2WorkFactor{Time: 1, MemoryKiB: 2, Threads: 3}, []int{1, 2, 3})
+}
+
+func TestArgon2WorkFactorUnmarshal(t *testing.T) {
+	testWorkFactorUnmarshal(t, []int{1, 2, 3}, &passhash.Argon2WorkFactor{},
+		&passhash.Argon2WorkFactor{Time: 1, MemoryKiB: 2, Threads: 3})
+}
+
+func TestArgon2WorkFactorUnmarshalError(t *testing.T) {
+	testWorkFactorUnmarshalError(t, []int{}, &passhash.Argon2WorkFactor{})
+	testWorkFactorUnmarshalError(t, []int{1, 2}, &passhash.Argon2WorkFactor{})
+	testWorkFactorUnmarshalError(t, []int{1, 2, 3, 4}, &passhash.Argon2WorkFactor{})
+}
+
+func TestLegacyWorkFactorMarshal(t *testing.T) {
+	testWorkFactorMarshal(t, &passhash.LegacyWorkFactor{Rounds: 1}, []int{1})
+}
+
+func TestLegacyWorkFactorUnmarshal(t *testing.T) {
+	testWorkFactorUnmarshal(t, []int{1}, &passhash.LegacyWorkFactor{}, &passhash.LegacyWorkFactor{Rounds: 1})
+}
+
+func TestLegacyWorkFactorUnmarshalError(t *testing.T) {
+	testWorkFactorUnmarshalError(t, []int{}, &passhash.LegacyWorkFactor{})
+	testWorkFactorUnmarshalError(t, []int{1, 2}, &passhash.LegacyWorkFactor{})
+}
+
 // eofAfterNReader returns at most n bytes, then EOF.
 // This simulates a short-reading RNG that terminates early.
 type eofAfterNReader struct {
@@ -205,3 +300,188 @@ func TestNewCredentialWithShortEOFReader(t *testing.T) {
 		t.Fatalf("expected error due to short-reading RNG with EOF, got nil")
 	}
 }
+
+func TestConfigValidateDefaultConfig(t *testing.T) {
+	if err := passhash.DefaultConfig.Validate(); err != nil {
+		t.Error("DefaultConfig is invalid", err)
+	}
+}
+
+func TestConfigValidateDefaultWorkFactors(t *testing.T) {
+	for kdf, wf := range passhash.DefaultWorkFactor {
+		config := passhash.DefaultConfig
+		config.Kdf = kdf
+		config.WorkFactor = wf
+		if err := config.Validate(); err != nil {
+			t.Errorf("DefaultWorkFactor for Kdf %v is invalid. %v", kdf, err)
+		}
+	}
+}
+
+func TestConfigValidateNilAuditLoggerAndStore(t *testing.T) {
+	config := passhash.DefaultConfig
+	config.AuditLogger = nil
+	config.Store = nil
+	err := config.Validate()
+	if !errors.Is(err, passhash.ErrNilAuditLogger) {
+		t.Error("Expected ErrNilAuditLogger. Got:", err)
+	}
+	if !errors.Is(err, passhash.ErrNilStore) {
+		t.Error("Expected ErrNilStore. Got:", err)
+	}
+}
+
+func TestConfigValidateWorkFactorMismatch(t *testing.T) {
+	config := passhash.DefaultConfig
+	config.WorkFactor = &passhash.Pbkdf2WorkFactor{Iter: 600000}
+	var mismatchErr passhash.WorkFactorMismatchError
+	if err := config.Validate(); !errors.As(err, &mismatchErr) {
+		t.Error("Expected WorkFactorMismatchError. Got:", err)
+	}
+	config.WorkFactor = nil
+	if err := config.Validate(); !errors.As(err, &mismatchErr) {
+		t.Error("Expected WorkFactorMismatchError. Got:", err)
+	}
+}
+
+func TestConfigValidateUnsupportedKdf(t *testing.T) {
+	config := passhash.DefaultConfig
+	config.Kdf = passhash.Kdf(999999)
+	if err := config.Validate(); err == nil {
+		t.Error("Config with unsupported Kdf is valid")
+	}
+}
+
+func TestConfigValidateVerifyOnlyKdf(t *testing.T) {
+	config := passhash.DefaultConfig
+	config.Kdf = passhash.Sha512Crypt
+	config.WorkFactor = &passhash.LegacyWorkFactor{Rounds: 5000}
+	if err := config.Validate(); !errors.Is(err, passhash.ErrVerifyOnlyKdf) {
+		t.Error("Expected ErrVerifyOnlyKdf. Got:", err)
+	}
+}
+
+var configValidateBelowSecurityFloorTests = map[string]struct {
+	mutator   func(*passhash.Config)
+	parameter string
+}{
+	"salt size": {
+		mutator:   func(c *passhash.Config) { c.SaltSize = 0 },
+		parameter: "SaltSize",
+	},
+	"key length": {
+		mutator:   func(c *passhash.Config) { c.KeyLength = 8 },
+		parameter: "KeyLength",
+	},
+	"pbkdf2 iterations": {
+		mutator: func(c *passhash.Config) {
+			c.Kdf = passhash.Pbkdf2Sha256
+			c.WorkFactor = &passhash.Pbkdf2WorkFactor{Iter: 1}
+		},
+		parameter: "WorkFactor",
+	},
+	"scrypt N": {
+		mutator:   func(c *passhash.Config) { c.WorkFactor = &passhash.ScryptWorkFactor{N: 1024, R: 16, P: 1} },
+		parameter: "WorkFactor",
+	},
+	"argon2 memory": {
+		mutator: func(c *passhash.Config) {
+			c.Kdf = passhash.Argon2id
+			c.WorkFactor = &passhash.Argon2WorkFactor{Time: 3, MemoryKiB: 64, Threads: 1}
+		},
+		parameter: "WorkFactor",
+	},
+	"argon2 time": {
+		mutator: func(c *passhash.Config) {
+			c.Kdf = passhash.Argon2id
+			c.WorkFactor = &passhash.Argon2WorkFactor{Time: 1, MemoryKiB: 19456, Threads: 1}
+		},
+		parameter: "WorkFactor",
+	},
+	"bcrypt cost": {
+		mutator: func(c *passhash.Config) {
+			c.Kdf = passhash.Bcrypt
+			c.WorkFactor = &passhash.BcryptWorkFactor{Cost: 4}
+		},
+		parameter: "WorkFactor",
+	},
+}
+
+func TestConfigValidateBelowSecurityFloor(t *testing.T) {
+	for name, test := range configValidateBelowSecurityFloorTests {
+		t.Run(name, func(t *testing.T) {
+			config := passhash.DefaultConfig
+			test.mutator(&config)
+			err := config.Validate()
+			var floorErr passhash.BelowSecurityFloorError
+			if !errors.As(err, &floorErr) {
+				t.Fatal("Expected BelowSecurityFloorError. Got:", err)
+			}
+			if floorErr.Parameter != test.parameter {
+				t.Errorf("Unexpected parameter below the security floor. %s != %s", floorErr.Parameter, test.parameter)
+			}
+			if _, err := config.NewCredential(passhash.UserID(0), testPassword); err == nil {
+				t.Error("Created a Credential with an invalid Config")
+			}
+		})
+	}
+}
+
+func TestConfigValidateBcryptIgnoresSaltSizeAndKeyLength(t *testing.T) {
+	config := passhash.Config{Kdf: passhash.Bcrypt, WorkFactor: passhash.DefaultWorkFactor[passhash.Bcrypt],
+		AuditLogger: &passhash.DummyAuditLogger{}, Store: passhash.DummyCredentialStore{}}
+	if err := config.Validate(); err != nil {
+		t.Error("bcrypt Config is invalid", err)
+	}
+}
+
+func TestConfigValidateEquivalentWorkFactors(t *testing.T) {
+	config := passhash.DefaultConfig
+	config.Kdf = passhash.Argon2id
+	for _, wf := range []*passhash.Argon2WorkFactor{{Time: 2, MemoryKiB: 19456, Threads: 1},
+		{Time: 1, MemoryKiB: 47104, Threads: 1}, {Time: 3, MemoryKiB: 12288, Threads: 1},
+		{Time: 4, MemoryKiB: 9216, Threads: 1}, {Time: 5, MemoryKiB: 7168, Threads: 1}} {
+		config.WorkFactor = wf
+		if err := config.Validate(); err != nil {
+			t.Errorf("Config with OWASP's Argon2id WorkFactor %+v is invalid: %v", wf, err)
+		}
+	}
+	config.WorkFactor = &passhash.Argon2WorkFactor{Time: 3, MemoryKiB: 9216, Threads: 1}
+	if err := config.Validate(); err == nil {
+		t.Error("Config below every equivalent WorkFactor is valid")
+	}
+}
+
+func TestConfigValidateCustomSecurityFloors(t *testing.T) {
+	config := passhash.DefaultConfig
+	config.WorkFactor = &passhash.ScryptWorkFactor{N: 1024, R: 8, P: 1}
+	config.SecurityFloors = &passhash.SecurityFloors{SaltSize: 8, KeyLength: 16,
+		WorkFactor: map[passhash.Kdf]passhash.WorkFactor{passhash.Scrypt: &passhash.ScryptWorkFactor{N: 1024, R: 8, P: 1}}}
+	if err := config.Validate(); err != nil {
+		t.Error("Config meeting the custom security floors is invalid", err)
+	}
+	config.SecurityFloors.WorkFactor[passhash.Scrypt] = &passhash.ScryptWorkFactor{N: 2048, R: 8, P: 1}
+	if err := config.Validate(); err == nil {
+		t.Error("Config below the custom security floors is valid")
+	}
+}
+
+func TestConfigExpertOverride(t *testing.T) {
+	config := passhash.Config{Kdf: passhash.Scrypt, WorkFactor: &passhash.ScryptWorkFactor{N: 16, R: 1, P: 1},
+		SaltSize: 1, KeyLength: 8}
+	if _, err := config.NewCredential(passhash.UserID(0), testPassword); err == nil {
+		t.Error("Created a Credential with an invalid Config")
+	}
+	config.ExpertOverride = true
+	credential, err := config.NewCredential(passhash.UserID(0), testPassword)
+	if err != nil {
+		t.Fatal("Unable to create a Credential with ExpertOverride", err)
+	}
+	config.ExpertOverride = false
+	if matched, _ := credential.MatchesPasswordWithConfig(config, testPassword); matched {
+		t.Error("Password matched using an invalid Config")
+	}
+	if err := credential.ChangePasswordWithConfig(config, testPassword, "newInsecurePassword"); err == nil {
+		t.Error("Changed password using an invalid Config")
+	}
+}
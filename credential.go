@@ -1,9 +1,8 @@
 package passhash
 
 import (
+	"context"
 	"crypto/subtle"
-	"errors"
-	"golang.org/x/crypto/bcrypt"
 	"net"
 )
 
@@ -20,28 +19,56 @@ type Credential struct {
 	Hash       []byte
 }
 
-func (c *Credential) matchPassword(password string, auditLogger AuditLogger, ip net.IP) bool {
-	if c.Kdf == Bcrypt {
-		// Bcrypt's API is and compares the password and hash for you
-		match := bcrypt.CompareHashAndPassword(c.Hash, []byte(password)) == nil
-		if match {
-			auditLogger.Log(c.UserID, AuthnSucceeded, ip)
-		} else {
-			auditLogger.Log(c.UserID, AuthnFailed, ip)
-		}
-		return match
+// VerifyResult is the outcome of Credential.Verify
+type VerifyResult struct {
+	Matched  bool // The password matches the Credential
+	Upgraded bool // The Credential was rehashed to meet the Config. Only set when Matched
+	// PolicyError is set when the Credential was Upgraded but the password doesn't meet the Config's
+	// PasswordPolicies. The Credential is still upgraded since the password was verified. e.g. prompt the user to
+	// change their password
+	PolicyError error
+}
+
+// VerifyOption configures Credential.Verify
+type VerifyOption func(*verifyOptions)
+
+type verifyOptions struct {
+	ip net.IP
+}
+
+// WithIP specifies the IP address the password was provided from, which is recorded in the audit log
+func WithIP(ip net.IP) VerifyOption {
+	return func(o *verifyOptions) {
+		o.ip = ip
 	}
-	hash, err := getPasswordHash(c.Kdf, c.WorkFactor, c.Salt, len(c.Hash), password)
+}
+
+func (c *Credential) matchPassword(ctx context.Context, config Config, password string, ip net.IP) (bool, error) {
+	if err := config.checkLockout(c.UserID); err != nil {
+		return false, err
+	}
+	release, err := config.acquireRateLimit(ctx, ip)
 	if err != nil {
-		return false
+		return false, err
+	}
+	defer release()
+	impl, err := getKdf(c.Kdf)
+	if err != nil {
+		config.auditLog(ctx, c.UserID, AuthnFailed, ip, ReasonUnsupportedKdf)
+		return false, err
+	}
+	match, err := impl.Verify(c.WorkFactor, c.Salt, c.Hash, password)
+	if err != nil {
+		config.auditLog(ctx, c.UserID, AuthnFailed, ip, ReasonVerifyError)
+		return false, err
 	}
-	match := subtle.ConstantTimeCompare(c.Hash, hash) == 1
 	if match {
-		auditLogger.Log(c.UserID, AuthnSucceeded, ip)
+		config.auditLog(ctx, c.UserID, AuthnSucceeded, ip, "")
 	} else {
-		auditLogger.Log(c.UserID, AuthnFailed, ip)
+		config.auditLog(ctx, c.UserID, AuthnFailed, ip, ReasonWrongPassword)
+		config.lockoutAfterFailure(ctx, c.UserID, ip)
 	}
-	return match
+	return match, nil
 }
 
 // NeedsUpdate determines if the Credential meets the recommended safe key derivation function and parameters
@@ -49,23 +76,66 @@ func (c *Credential) NeedsUpdate() bool {
 	return !c.MeetsConfig(DefaultConfig)
 }
 
-// MeetsConfig returns true if the Credential meets the parameters specified in the given Config and returns false otherwise
+// MeetsConfig returns true if the Credential meets the parameters specified in the given Config and returns false otherwise.
+// The Config's UpgradePolicy determines whether a stronger WorkFactor meets the Config
 func (c *Credential) MeetsConfig(config Config) bool {
+	if c.Kdf != config.Kdf {
+		return false
+	}
+	if config.UpgradePolicy == UpgradeIfWeaker {
+		cmp, err := CompareWorkFactors(c.WorkFactor, config.WorkFactor)
+		return err == nil && cmp >= 0
+	}
 	// FML, workfactors are pointers and won't compare using ==
-	return c.Kdf == config.Kdf && WorkFactorsEqual(c.WorkFactor, config.WorkFactor)
+	return WorkFactorsEqual(c.WorkFactor, config.WorkFactor)
 }
 
-func (c *Credential) ensureUpdated(config Config, password string, ip net.IP) bool {
-	if !c.MeetsConfig(config) {
-		newCredential, err := config.NewCredential(c.UserID, password)
-		if err != nil {
-			return false
-		}
-		*c = *newCredential
-		config.AuditLogger.Log(c.UserID, UpgradedKdf, ip)
-		return true
+// ensureUpdated rehashes the verified password if the Credential doesn't meet the Config. The PasswordPolicies don't
+// prevent the upgrade so that e.g. legacy Credentials with short passwords don't stay on a weak Kdf
+func (c *Credential) ensureUpdated(ctx context.Context, config Config, password string, ip net.IP) (VerifyResult,
+	error) {
+	result := VerifyResult{Matched: true}
+	if c.MeetsConfig(config) {
+		return result, nil
+	}
+	newCredential, err := config.hashCredential(c.UserID, password)
+	if err != nil {
+		return result, UpgradeError{Err: err}
 	}
-	return false
+	*c = *newCredential
+	config.auditLog(ctx, c.UserID, UpgradedKdf, ip, "")
+	result.Upgraded = true
+	result.PolicyError = config.checkPasswordPolicies(ctx, c.UserID, password)
+	return result, nil
+}
+
+// Verify checks if the provided password matches the Credential and updates the Credential to meet the Config
+// parameters if necessary. A password that doesn't match is not an error. Errors are returned if the Config's Kdf
+// parameters fail Validate (a ConfigError, unless ExpertOverride is set), the Credential can't be verified (e.g. an
+// unsupported Kdf), or ctx is done. The Config's Store and AuditLogger may be nil.
+// The context is checked before hashing. If the password matches but the Credential can't be upgraded, the result is
+// still Matched and the error is an UpgradeError. Matching passwords that don't meet the Config's PasswordPolicies
+// are still upgraded and reported in the result's PolicyError.
+func (c *Credential) Verify(ctx context.Context, config Config, password string,
+	opts ...VerifyOption) (VerifyResult, error) {
+	o := verifyOptions{ip: EmptyIP}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if err := config.validateHashing(); err != nil {
+		return VerifyResult{}, err
+	}
+	if err := ctx.Err(); err != nil {
+		return VerifyResult{}, err
+	}
+	matched, err := c.matchPassword(ctx, config, password, o.ip)
+	if err != nil || !matched {
+		return VerifyResult{}, err
+	}
+	if err := ctx.Err(); err != nil {
+		return VerifyResult{Matched: true}, UpgradeError{Err: err}
+	}
+	return c.ensureUpdated(ctx, config, password, o.ip)
 }
 
 // MatchesPassword checks if the provided password matches the Credential
@@ -81,21 +151,18 @@ func (c *Credential) MatchesPasswordWithIP(password string, ip net.IP) (matched,
 }
 
 // MatchesPasswordWithConfig checks if the provided password matches the Credential
-// and updates the Credential to meet the Config parameters if necessary
+// and updates the Credential to meet the Config parameters if necessary. See MatchesPasswordWithConfigAndIP
 func (c *Credential) MatchesPasswordWithConfig(config Config, password string) (matched, updated bool) {
 	return c.MatchesPasswordWithConfigAndIP(config, password, EmptyIP)
 }
 
 // MatchesPasswordWithConfigAndIP checks if the provided password matches the Credential
-// and updates the Credential to meet the Config parameters if necessary
+// and updates the Credential to meet the Config parameters if necessary.
+// The Config's Store and AuditLogger may be nil, but unless ExpertOverride is set, passwords never match if the Config's
+// Kdf parameters fail Validate. Use Verify to distinguish a password that doesn't match from a ConfigError or Kdf error.
 func (c *Credential) MatchesPasswordWithConfigAndIP(config Config, password string, ip net.IP) (matched, updated bool) {
-	updated = false
-	matched = c.matchPassword(password, config.AuditLogger, ip)
-	if !matched {
-		return
-	}
-	updated = c.ensureUpdated(config, password, ip)
-	return
+	result, _ := c.Verify(context.Background(), config, password, WithIP(ip))
+	return result.Matched, result.Upgraded
 }
 
 // ChangePassword changes the password for the given Credential and updates the Credential to use the recommended safe key derivation function and parameters
@@ -115,13 +182,26 @@ func (c *Credential) ChangePasswordWithConfig(config Config, oldPassword, newPas
 
 // ChangePasswordWithConfigAndIP changes the password for the given Credential and updates the Credential to meet the Config parameters if necessary
 func (c *Credential) ChangePasswordWithConfigAndIP(config Config, oldPassword, newPassword string, ip net.IP) error {
-	if !c.matchPassword(oldPassword, config.AuditLogger, ip) {
-		return errors.New("Old password does not match existing password")
+	return c.changePassword(context.Background(), config, oldPassword, newPassword, ip)
+}
+
+func (c *Credential) changePassword(ctx context.Context, config Config, oldPassword, newPassword string,
+	ip net.IP) error {
+	if err := config.validateHashing(); err != nil {
+		return err
+	}
+	matched, err := c.matchPassword(ctx, config, oldPassword, ip)
+	if err != nil {
+		return err
+	}
+	if !matched {
+		return ErrOldPasswordMismatch
 	}
 	if subtle.ConstantTimeCompare([]byte(oldPassword), []byte(newPassword)) == 1 {
+		config.auditLog(ctx, c.UserID, PasswordUnchangedRejected, ip, ReasonPasswordUnchanged)
 		return ErrPasswordUnchanged
 	}
-	return c.ResetWithConfigAndIP(config, newPassword, ip)
+	return c.replace(ctx, config, newPassword, PasswordChanged, ip)
 }
 
 // Reset resets the password for the given Credential and updates the Credential to use the recommended safe key derivation function and parameters
@@ -141,10 +221,18 @@ func (c *Credential) ResetWithConfig(config Config, newPassword string) error {
 
 // ResetWithConfigAndIP resets the password for the given Credential and updates the Credential to meet the Config parameters if necessary
 func (c *Credential) ResetWithConfigAndIP(config Config, newPassword string, ip net.IP) error {
-	newCredential, err := config.NewCredential(c.UserID, newPassword)
+	return c.replace(context.Background(), config, newPassword, PasswordReset, ip)
+}
+
+// replace replaces the Credential with a new Credential for the password and logs the audit type.
+// PasswordPolicyRejected is logged instead if the password doesn't meet the Config's PasswordPolicies
+func (c *Credential) replace(ctx context.Context, config Config, newPassword string, at AuditType, ip net.IP) error {
+	newCredential, err := config.newCredential(ctx, c.UserID, newPassword)
 	if err != nil {
+		config.auditPolicyRejection(ctx, c.UserID, err, ip)
 		return err
 	}
 	*c = *newCredential
+	config.auditLog(ctx, c.UserID, at, ip, "")
 	return nil
 }
@@ -42,3 +42,11 @@ func TestGetPasswordHashInvalidScryptWorkFactor(t *testing.T) {
 	testGetPasswordHashInvalidKdfAndWorkFactorCombo(t, Scrypt, &Pbkdf2WorkFactor{})
 	testGetPasswordHashInvalidKdfAndWorkFactorCombo(t, Scrypt, &BcryptWorkFactor{})
 }
+
+func TestGetPasswordHashInvalidArgon2WorkFactor(t *testing.T) {
+	testGetPasswordHashInvalidKdfAndWorkFactorCombo(t, Argon2id, &Pbkdf2WorkFactor{})
+	testGetPasswordHashInvalidKdfAndWorkFactorCombo(t, Argon2i, &ScryptWorkFactor{})
+	testGetPasswordHashInvalidKdfAndWorkFactorCombo(t, Scrypt, &Argon2WorkFactor{Time: 1, MemoryKiB: 8, Threads: 1})
+	testGetPasswordHashInvalidKdfAndWorkFactorCombo(t, Argon2id, &Argon2WorkFactor{})
+	testGetPasswordHashInvalidKdfAndWorkFactorCombo(t, Argon2id, &Argon2WorkFactor{Time: 1, MemoryKiB: 8, Threads: 256})
+}
@@ -1,8 +1,11 @@
 package passhash_test
 
 import (
+	"context"
 	_ "crypto/sha256"
 	_ "crypto/sha512"
+	"errors"
+	"net"
 	"testing"
 
 	"github.com/dhui/passhash"
@@ -49,6 +52,14 @@ func TestNewScrypt(t *testing.T) {
 	testNew(t, passhash.Scrypt)
 }
 
+func TestNewArgon2id(t *testing.T) {
+	testNew(t, passhash.Argon2id)
+}
+
+func TestNewArgon2i(t *testing.T) {
+	testNew(t, passhash.Argon2i)
+}
+
 func TestNewInvalidKdf(t *testing.T) {
 	userID := passhash.UserID(0)
 	config := passhash.Config{Kdf: passhash.Kdf(999999), WorkFactor: &passhash.Pbkdf2WorkFactor{}}
@@ -77,7 +88,7 @@ func TestNeedsUpdate(t *testing.T) {
 			origWorkFactor, passhash.DefaultWorkFactor[passhash.DefaultConfig.Kdf])
 	}
 
-	config := passhash.Config{Kdf: origKdf, WorkFactor: origWorkFactor}
+	config := passhash.Config{Kdf: origKdf, WorkFactor: origWorkFactor, ExpertOverride: true}
 	userID := passhash.UserID(0)
 	credential, err := config.NewCredential(userID, testPassword)
 	if err != nil {
@@ -89,7 +100,8 @@ func TestNeedsUpdate(t *testing.T) {
 }
 
 func TestMeetsConfigSelf(t *testing.T) {
-	config := passhash.Config{Kdf: passhash.Scrypt, WorkFactor: &passhash.ScryptWorkFactor{R: 1, P: 2, N: 2}}
+	config := passhash.Config{Kdf: passhash.Scrypt, WorkFactor: &passhash.ScryptWorkFactor{R: 1, P: 2, N: 2},
+		ExpertOverride: true}
 	userID := passhash.UserID(0)
 	credential, err := config.NewCredential(userID, testPassword)
 	if err != nil {
@@ -101,8 +113,10 @@ func TestMeetsConfigSelf(t *testing.T) {
 }
 
 func TestMeetsConfigSame(t *testing.T) {
-	configA := passhash.Config{Kdf: passhash.Scrypt, WorkFactor: &passhash.ScryptWorkFactor{R: 1, P: 2, N: 2}}
-	configB := passhash.Config{Kdf: passhash.Scrypt, WorkFactor: &passhash.ScryptWorkFactor{R: 1, P: 2, N: 2}}
+	configA := passhash.Config{Kdf: passhash.Scrypt, WorkFactor: &passhash.ScryptWorkFactor{R: 1, P: 2, N: 2},
+		ExpertOverride: true}
+	configB := passhash.Config{Kdf: passhash.Scrypt, WorkFactor: &passhash.ScryptWorkFactor{R: 1, P: 2, N: 2},
+		ExpertOverride: true}
 	userID := passhash.UserID(0)
 	credential, err := configA.NewCredential(userID, testPassword)
 	if err != nil {
@@ -114,8 +128,10 @@ func TestMeetsConfigSame(t *testing.T) {
 }
 
 func TestMeetsConfigDifferentKdf(t *testing.T) {
-	configA := passhash.Config{Kdf: passhash.Scrypt, WorkFactor: &passhash.ScryptWorkFactor{R: 1, P: 2, N: 2}}
-	configB := passhash.Config{Kdf: passhash.Bcrypt, WorkFactor: &passhash.BcryptWorkFactor{Cost: 5}}
+	configA := passhash.Config{Kdf: passhash.Scrypt, WorkFactor: &passhash.ScryptWorkFactor{R: 1, P: 2, N: 2},
+		ExpertOverride: true}
+	configB := passhash.Config{Kdf: passhash.Bcrypt, WorkFactor: &passhash.BcryptWorkFactor{Cost: 5},
+		ExpertOverride: true}
 	userID := passhash.UserID(0)
 	credential, err := configA.NewCredential(userID, testPassword)
 	if err != nil {
@@ -127,8 +143,10 @@ func TestMeetsConfigDifferentKdf(t *testing.T) {
 }
 
 func TestMeetsConfigDifferentWorkFactor(t *testing.T) {
-	configA := passhash.Config{Kdf: passhash.Scrypt, WorkFactor: &passhash.ScryptWorkFactor{R: 1, P: 2, N: 2}}
-	configB := passhash.Config{Kdf: passhash.Scrypt, WorkFactor: &passhash.ScryptWorkFactor{R: 1, P: 2, N: 4}}
+	configA := passhash.Config{Kdf: passhash.Scrypt, WorkFactor: &passhash.ScryptWorkFactor{R: 1, P: 2, N: 2},
+		ExpertOverride: true}
+	configB := passhash.Config{Kdf: passhash.Scrypt, WorkFactor: &passhash.ScryptWorkFactor{R: 1, P: 2, N: 4},
+		ExpertOverride: true}
 	userID := passhash.UserID(0)
 
 	credential, err := configA.NewCredential(userID, testPassword)
@@ -140,6 +158,226 @@ func TestMeetsConfigDifferentWorkFactor(t *testing.T) {
 	}
 }
 
+var meetsConfigUpgradePolicyTests = map[string]struct {
+	workFactor passhash.WorkFactor
+	policy     passhash.UpgradePolicy
+	expected   bool
+}{
+	"exact match stronger":   {workFactor: &passhash.ScryptWorkFactor{R: 1, P: 2, N: 8}, policy: passhash.UpgradeExactMatch, expected: false},
+	"exact match weaker":     {workFactor: &passhash.ScryptWorkFactor{R: 1, P: 2, N: 2}, policy: passhash.UpgradeExactMatch, expected: false},
+	"exact match same":       {workFactor: &passhash.ScryptWorkFactor{R: 1, P: 2, N: 4}, policy: passhash.UpgradeExactMatch, expected: true},
+	"if weaker stronger":     {workFactor: &passhash.ScryptWorkFactor{R: 1, P: 2, N: 8}, policy: passhash.UpgradeIfWeaker, expected: true},
+	"if weaker weaker":       {workFactor: &passhash.ScryptWorkFactor{R: 1, P: 2, N: 2}, policy: passhash.UpgradeIfWeaker, expected: false},
+	"if weaker same":         {workFactor: &passhash.ScryptWorkFactor{R: 1, P: 2, N: 4}, policy: passhash.UpgradeIfWeaker, expected: true},
+	"if weaker incomparable": {workFactor: &passhash.ScryptWorkFactor{R: 2, P: 2, N: 2}, policy: passhash.UpgradeIfWeaker, expected: false},
+}
+
+func TestMeetsConfigUpgradePolicy(t *testing.T) {
+	for name, test := range meetsConfigUpgradePolicyTests {
+		t.Run(name, func(t *testing.T) {
+			credential := passhash.Credential{Kdf: passhash.Scrypt, WorkFactor: test.workFactor}
+			config := passhash.Config{Kdf: passhash.Scrypt, WorkFactor: &passhash.ScryptWorkFactor{R: 1, P: 2, N: 4},
+				UpgradePolicy: test.policy}
+			if meets := credential.MeetsConfig(config); meets != test.expected {
+				t.Errorf("Unexpected MeetsConfig result. %v != %v", meets, test.expected)
+			}
+		})
+	}
+}
+
+func TestMatchesPasswordStrongerWorkFactorNotDowngraded(t *testing.T) {
+	origWorkFactor := &passhash.ScryptWorkFactor{N: 65536, R: 16, P: 1}
+	config := passhash.DefaultConfig
+	config.WorkFactor = origWorkFactor
+	credential, err := config.NewCredential(passhash.UserID(0), testPassword)
+	if err != nil {
+		t.Fatal("Unable to create new Credential", err)
+	}
+	matched, updated := credential.MatchesPassword(testPassword)
+	if !matched {
+		t.Error("Valid password did not match credential")
+	}
+	if updated {
+		t.Error("Credential with a stronger WorkFactor was downgraded")
+	}
+	if !passhash.WorkFactorsEqual(credential.WorkFactor, origWorkFactor) {
+		t.Errorf("Credential WorkFactor changed. %v != %v", credential.WorkFactor, origWorkFactor)
+	}
+
+	config.WorkFactor = passhash.DefaultWorkFactor[passhash.Scrypt]
+	config.UpgradePolicy = passhash.UpgradeExactMatch
+	matched, updated = credential.MatchesPasswordWithConfig(config, testPassword)
+	if !matched || !updated {
+		t.Errorf("Credential not rehashed with an exact match UpgradePolicy. matched: %v updated: %v", matched, updated)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	auditLogger := &passhash.MemoryAuditLogger{}
+	config := passhash.DefaultConfig
+	config.AuditLogger = auditLogger
+	userID := passhash.UserID(0)
+	ip := net.ParseIP("192.0.2.1")
+	credential, err := config.NewCredential(userID, testPassword)
+	if err != nil {
+		t.Fatal("Unable to create new Credential", err)
+	}
+
+	result, err := credential.Verify(context.Background(), config, testPassword, passhash.WithIP(ip))
+	if err != nil {
+		t.Fatal("Unable to verify password", err)
+	}
+	if !result.Matched {
+		t.Error("Valid password did not match credential")
+	}
+	if result.Upgraded {
+		t.Error("Up-to-date credential upgraded")
+	}
+	logs := auditLogger.LastN(userID, 1)
+	if len(logs) != 1 || logs[0].Type != passhash.AuthnSucceeded || !logs[0].IP.Equal(ip) {
+		t.Error("Unexpected audit logs", logs)
+	}
+
+	result, err = credential.Verify(context.Background(), config, "wrong password")
+	if err != nil {
+		t.Error("Wrong password returned an error", err)
+	}
+	if result.Matched || result.Upgraded {
+		t.Error("Unexpected result for wrong password", result)
+	}
+}
+
+func TestVerifyContextDone(t *testing.T) {
+	auditLogger := &passhash.MemoryAuditLogger{}
+	config := passhash.DefaultConfig
+	config.AuditLogger = auditLogger
+	userID := passhash.UserID(0)
+	credential, err := config.NewCredential(userID, testPassword)
+	if err != nil {
+		t.Fatal("Unable to create new Credential", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	result, err := credential.Verify(ctx, config, testPassword)
+	if !errors.Is(err, context.Canceled) {
+		t.Error("Expected context.Canceled. Got:", err)
+	}
+	if result.Matched {
+		t.Error("Password matched with a done context")
+	}
+	if logs := auditLogger.LastNWithTypes(userID, 1, passhash.AuthnSucceeded, passhash.AuthnFailed); len(logs) != 0 {
+		t.Error("Password was verified with a done context", logs)
+	}
+}
+
+func TestVerifyUnsupportedKdf(t *testing.T) {
+	credential := passhash.Credential{Kdf: passhash.Kdf(999999), WorkFactor: &passhash.Pbkdf2WorkFactor{Iter: 1}}
+	result, err := credential.Verify(context.Background(), passhash.DefaultConfig, testPassword)
+	if err == nil {
+		t.Error("Verified a Credential with an unsupported Kdf")
+	}
+	if result.Matched {
+		t.Error("Password matched a Credential with an unsupported Kdf")
+	}
+}
+
+func TestVerifyInvalidConfig(t *testing.T) {
+	credential, err := passhash.DefaultConfig.NewCredential(passhash.UserID(0), testPassword)
+	if err != nil {
+		t.Fatal("Unable to create new Credential", err)
+	}
+	config := passhash.DefaultConfig
+	config.SaltSize = 1
+	_, err = credential.Verify(context.Background(), config, testPassword)
+	var configErr passhash.ConfigError
+	var floorErr passhash.BelowSecurityFloorError
+	if !errors.As(err, &configErr) || !errors.As(err, &floorErr) {
+		t.Error("Expected ConfigError wrapping a BelowSecurityFloorError. Got:", err)
+	}
+}
+
+func TestVerifyNilStoreAndAuditLogger(t *testing.T) {
+	config := passhash.DefaultConfig
+	config.Store = nil
+	config.AuditLogger = nil
+	credential, err := config.NewCredential(passhash.UserID(0), testPassword)
+	if err != nil {
+		t.Fatal("Unable to create new Credential", err)
+	}
+	if result, err := credential.Verify(context.Background(), config, testPassword); err != nil || !result.Matched {
+		t.Errorf("Unexpected result %+v. Error: %v", result, err)
+	}
+	if matched, _ := credential.MatchesPasswordWithConfig(config, testPassword); !matched {
+		t.Error("Password did not match with a nil Store and AuditLogger")
+	}
+	if err := credential.ChangePasswordWithConfig(config, testPassword, testPassword+"2"); err != nil {
+		t.Error("Unable to change password with a nil Store and AuditLogger", err)
+	}
+	if err := config.Validate(); !errors.Is(err, passhash.ErrNilStore) || !errors.Is(err, passhash.ErrNilAuditLogger) {
+		t.Error("Expected ErrNilStore and ErrNilAuditLogger. Got:", err)
+	}
+}
+
+func TestVerifyUpgrade(t *testing.T) {
+	config := passhash.Config{Kdf: passhash.Pbkdf2Sha256, WorkFactor: &passhash.Pbkdf2WorkFactor{Iter: 1000},
+		SaltSize: 16, KeyLength: 32, ExpertOverride: true}
+	credential, err := config.NewCredential(passhash.UserID(0), testPassword)
+	if err != nil {
+		t.Fatal("Unable to create new Credential", err)
+	}
+	result, err := credential.Verify(context.Background(), passhash.DefaultConfig, testPassword)
+	if err != nil {
+		t.Fatal("Unable to verify password", err)
+	}
+	if !result.Matched || !result.Upgraded {
+		t.Error("Outdated credential not upgraded", result)
+	}
+	if credential.Kdf != passhash.DefaultConfig.Kdf {
+		t.Errorf("Credential Kdf not upgraded. %v != %v", credential.Kdf, passhash.DefaultConfig.Kdf)
+	}
+}
+
+func TestVerifyUpgradePasswordPoliciesNotMet(t *testing.T) {
+	password := "short"
+	config := passhash.Config{Kdf: passhash.Pbkdf2Sha256, WorkFactor: &passhash.Pbkdf2WorkFactor{Iter: 1000},
+		SaltSize: 16, KeyLength: 32, ExpertOverride: true}
+	credential, err := config.NewCredential(passhash.UserID(0), password)
+	if err != nil {
+		t.Fatal("Unable to create new Credential", err)
+	}
+	result, err := credential.Verify(context.Background(), passhash.DefaultConfig, password)
+	if err != nil {
+		t.Fatal("Unable to verify password", err)
+	}
+	if !result.Matched || !result.Upgraded || !credential.MeetsConfig(passhash.DefaultConfig) {
+		t.Error("Credential not upgraded with a password that fails the password policies", result)
+	}
+	var policiesErr passhash.PasswordPoliciesNotMet
+	if !errors.As(result.PolicyError, &policiesErr) {
+		t.Error("Expected PasswordPoliciesNotMet PolicyError. Got:", result.PolicyError)
+	}
+	if result, err := credential.Verify(context.Background(), passhash.DefaultConfig, password); err != nil ||
+		!result.Matched || result.Upgraded || result.PolicyError != nil {
+		t.Errorf("Unexpected result %+v after upgrading. Error: %v", result, err)
+	}
+}
+
+func TestVerifyUpgradeError(t *testing.T) {
+	config := passhash.Config{Kdf: passhash.Pbkdf2Sha256, WorkFactor: &passhash.Pbkdf2WorkFactor{Iter: 1000},
+		SaltSize: 16, KeyLength: 32, ExpertOverride: true}
+	credential, err := config.NewCredential(passhash.UserID(0), testPassword)
+	if err != nil {
+		t.Fatal("Unable to create new Credential", err)
+	}
+	// The WorkFactor doesn't match the Kdf, so the password can't be rehashed
+	config.Kdf = passhash.Scrypt
+	result, err := credential.Verify(context.Background(), config, testPassword)
+	var upgradeErr passhash.UpgradeError
+	if !errors.As(err, &upgradeErr) || !result.Matched || result.Upgraded {
+		t.Errorf("Expected Matched result %+v with UpgradeError. Got: %v", result, err)
+	}
+}
+
 func TestMatchesPasswordWithIP(t *testing.T) {
 	userID := passhash.UserID(0)
 
@@ -168,7 +406,7 @@ func TestMatchesPasswordMatchNoUpdate(t *testing.T) {
 			origWorkFactor, passhash.DefaultWorkFactor[passhash.DefaultConfig.Kdf])
 	}
 
-	config := passhash.Config{Kdf: origKdf, WorkFactor: origWorkFactor}
+	config := passhash.Config{Kdf: origKdf, WorkFactor: origWorkFactor, ExpertOverride: true}
 	userID := passhash.UserID(0)
 
 	credential, err := config.NewCredential(userID, testPassword)
@@ -211,7 +449,7 @@ func TestMatchesPasswordUpdateKdfAndWorkFactor(t *testing.T) {
 			origWorkFactor, passhash.DefaultWorkFactor[passhash.DefaultConfig.Kdf])
 	}
 
-	config := passhash.Config{Kdf: origKdf, WorkFactor: origWorkFactor}
+	config := passhash.Config{Kdf: origKdf, WorkFactor: origWorkFactor, ExpertOverride: true}
 	userID := passhash.UserID(0)
 
 	credential, err := config.NewCredential(userID, testPassword)
@@ -251,7 +489,7 @@ func TestMatchesPasswordUpdateWorkFactor(t *testing.T) {
 			origWorkFactor, defaultScryptWorkFactor)
 	}
 
-	config := passhash.Config{Kdf: kdf, WorkFactor: &origWorkFactor}
+	config := passhash.Config{Kdf: kdf, WorkFactor: &origWorkFactor, ExpertOverride: true}
 	userID := passhash.UserID(0)
 
 	credential, err := config.NewCredential(userID, testPassword)
@@ -282,6 +520,33 @@ func TestMatchesPasswordUpdateWorkFactor(t *testing.T) {
 	}
 }
 
+func TestMatchesPasswordUpgradeScryptToArgon2id(t *testing.T) {
+	scryptConfig := passhash.Config{Kdf: passhash.Scrypt, WorkFactor: &passhash.ScryptWorkFactor{N: 1024, R: 8, P: 1},
+		SaltSize: 16, KeyLength: 32, AuditLogger: &passhash.DummyAuditLogger{}, Store: passhash.DummyCredentialStore{},
+		ExpertOverride: true}
+	argon2Config := scryptConfig
+	argon2Config.Kdf = passhash.Argon2id
+	argon2Config.WorkFactor = &passhash.Argon2WorkFactor{Time: 1, MemoryKiB: 64, Threads: 1}
+
+	credential, err := scryptConfig.NewCredential(passhash.UserID(0), testPassword)
+	if err != nil {
+		t.Fatal("Unable to create new Credential", err)
+	}
+	matched, updated := credential.MatchesPasswordWithConfig(argon2Config, testPassword)
+	if !matched {
+		t.Error("Valid password did not match credential")
+	}
+	if !updated {
+		t.Error("Scrypt credential not upgraded to Argon2id")
+	}
+	if credential.Kdf != passhash.Argon2id {
+		t.Errorf("Upgraded credential Kdf is not Argon2id. %v", credential.Kdf)
+	}
+	if matched, updated = credential.MatchesPasswordWithConfig(argon2Config, testPassword); !matched || updated {
+		t.Errorf("Upgraded credential did not match without update. matched: %v updated: %v", matched, updated)
+	}
+}
+
 var configWorkFactorChangeDoesNotBreakExistingCredentialTests = map[string]struct {
 	kdf       passhash.Kdf
 	wf        passhash.WorkFactor
@@ -308,6 +573,13 @@ var configWorkFactorChangeDoesNotBreakExistingCredentialTests = map[string]struc
 			wf.(*passhash.ScryptWorkFactor).N /= 2
 		},
 	},
+	"argon2 WorkFactor": {
+		kdf: passhash.Argon2id,
+		wf:  &passhash.Argon2WorkFactor{Time: 2, MemoryKiB: 64, Threads: 1},
+		wfMutator: func(wf passhash.WorkFactor) {
+			wf.(*passhash.Argon2WorkFactor).Time -= 1
+		},
+	},
 }
 
 func TestConfigWorkFactorChangeDoesNotBreakExistingCredential(t *testing.T) {
@@ -322,6 +594,8 @@ func TestConfigWorkFactorChangeDoesNotBreakExistingCredential(t *testing.T) {
 				KeyLength:   32,
 				AuditLogger: &passhash.DummyAuditLogger{},
 				Store:       passhash.DummyCredentialStore{},
+				// The WorkFactors are intentionally weak to keep the test fast
+				ExpertOverride: true,
 			}
 
 			userID := passhash.UserID(1)
@@ -467,3 +741,74 @@ func TestResetWithIPNewPasswordDoesNotMeetPasswordPolicy(t *testing.T) {
 		t.Error("Should have gotten error resetting password")
 	}
 }
+
+func TestCredentialLifecycleAuditLogs(t *testing.T) {
+	auditLogger := &passhash.MemoryAuditLogger{}
+	config := passhash.DefaultConfig
+	config.AuditLogger = auditLogger
+	userID := passhash.UserID(0)
+	ip := net.ParseIP("192.0.2.1")
+	newPassword := "newInsecurePassword"
+
+	if _, err := config.NewCredential(userID, "short"); err == nil {
+		t.Fatal("Created Credential with a password that fails the password policies")
+	}
+	credential, err := config.NewCredential(userID, testPassword)
+	if err != nil {
+		t.Fatal("Unable to create new Credential", err)
+	}
+	if err := credential.ChangePasswordWithConfigAndIP(config, testPassword, testPassword, ip); err == nil {
+		t.Error("Changed password to the same password")
+	}
+	if err := credential.ChangePasswordWithConfigAndIP(config, testPassword, "short", ip); err == nil {
+		t.Error("Changed password to a password that fails the password policies")
+	}
+	if err := credential.ChangePasswordWithConfigAndIP(config, testPassword, newPassword, ip); err != nil {
+		t.Fatal("Unable to change password", err)
+	}
+	if err := credential.ResetWithConfigAndIP(config, "short", ip); err == nil {
+		t.Error("Reset password to a password that fails the password policies")
+	}
+	if err := credential.ResetWithConfigAndIP(config, testPassword, ip); err != nil {
+		t.Fatal("Unable to reset password", err)
+	}
+
+	expected := []passhash.AuditType{
+		passhash.PasswordPolicyRejected,
+		passhash.CredentialCreated,
+		passhash.AuthnSucceeded, passhash.PasswordUnchangedRejected,
+		passhash.AuthnSucceeded, passhash.PasswordPolicyRejected,
+		passhash.AuthnSucceeded, passhash.PasswordChanged,
+		passhash.PasswordPolicyRejected,
+		passhash.PasswordReset,
+	}
+	logs := auditLogger.LastN(userID, 100)
+	if len(logs) != len(expected) {
+		t.Fatalf("Unexpected number of audit logs. %d != %d: %v", len(logs), len(expected), logs)
+	}
+	for i, log := range logs {
+		if log.Type != expected[i] {
+			t.Errorf("Unexpected audit log %d. %v != %v", i, log.Type, expected[i])
+		}
+	}
+}
+
+func TestUpgradeDoesNotAuditCredentialCreated(t *testing.T) {
+	auditLogger := &passhash.MemoryAuditLogger{}
+	userID := passhash.UserID(0)
+	origConfig := passhash.Config{Kdf: passhash.Pbkdf2Sha256, WorkFactor: &passhash.Pbkdf2WorkFactor{Iter: 1000},
+		SaltSize: 16, KeyLength: 32, AuditLogger: auditLogger, ExpertOverride: true}
+	credential, err := origConfig.NewCredential(userID, testPassword)
+	if err != nil {
+		t.Fatal("Unable to create new Credential", err)
+	}
+	config := passhash.DefaultConfig
+	config.AuditLogger = auditLogger
+	if result, err := credential.Verify(context.Background(), config, testPassword); err != nil || !result.Upgraded {
+		t.Fatal("Credential not upgraded", result, err)
+	}
+	logs := auditLogger.LastNWithTypes(userID, 100, passhash.CredentialCreated, passhash.UpgradedKdf)
+	if len(logs) != 2 || logs[0].Type != passhash.UpgradedKdf || logs[1].Type != passhash.CredentialCreated {
+		t.Error("Unexpected audit logs", logs)
+	}
+}
@@ -8,6 +8,9 @@ Features:
   - Auto-upgrading KDFs and work factors
   - Password usage audit log
   - Password policies
+  - Authenticator to register users, log in, and change or reset passwords using your CredentialStore
+  - Account lockouts with exponential backoff driven by the audit log
+  - Per IP, per subnet, and global rate limiting of password verification
 
 passhash gets out of your way, yet is also flexibile to meet your security needs.
 
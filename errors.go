@@ -3,15 +3,218 @@ package passhash
 import (
 	"errors"
 	"fmt"
+	"net"
 	"strings"
+	"time"
 )
 
 var (
 	// ErrPasswordUnchanged is used when a Credential.ChangePassword*() method is called with the same old and new
 	// password
 	ErrPasswordUnchanged = errors.New("Password unchanged")
+	// ErrUnsupportedKdf is used when a Kdf hasn't been registered
+	ErrUnsupportedKdf = errors.New("Unsupported kdf")
+	// ErrVerifyOnlyKdf is used when attempting to create a new hash with a legacy Kdf that may only be used to verify
+	// existing credentials
+	ErrVerifyOnlyKdf = errors.New("Kdf may only be used to verify existing credentials")
+	// ErrNilAuditLogger is used when a Config does not specify an AuditLogger
+	ErrNilAuditLogger = errors.New("Config AuditLogger is nil")
+	// ErrNilStore is used when a Config does not specify a CredentialStore
+	ErrNilStore = errors.New("Config Store is nil")
+	// ErrOldPasswordMismatch is used when a Credential.ChangePassword*() method is called with an old password that
+	// doesn't match the Credential
+	ErrOldPasswordMismatch = errors.New("Old password does not match existing password")
+	// ErrAuthenticationFailed is used by the Authenticator when a user can't be authenticated. e.g. the password doesn't
+	// match
+	ErrAuthenticationFailed = errors.New("Authentication failed")
+	// ErrCredentialNotFound is used when a CredentialStore doesn't have a Credential for a user
+	ErrCredentialNotFound = errors.New("Credential not found")
+	// ErrUserExists is used by the Authenticator when registering a user that already has a Credential
+	ErrUserExists = errors.New("User already exists")
+	// ErrAuditLoggerClosed is used when logging to an AuditLogger that has been closed
+	ErrAuditLoggerClosed = errors.New("Audit logger closed")
+	// ErrAuditChainBroken is used when a ChainedAuditLogger's logs were deleted, reordered, or modified
+	ErrAuditChainBroken = errors.New("Audit log chain broken")
+	// ErrIncomparableWorkFactors is used when neither WorkFactor is stronger than or equivalent to the other
+	ErrIncomparableWorkFactors = errors.New("WorkFactors are incomparable")
+	// ErrAccountLocked is used when a user's account is locked by a LockoutPolicy. See AccountLockedError
+	ErrAccountLocked = errors.New("Account locked")
+	// ErrRateLimited is used when a RateLimiter rejects a password verification. See RateLimitedError
+	ErrRateLimited = errors.New("Rate limited")
+	// ErrPwnedPassword is used when a password has appeared in data breaches. e.g. by NotPwnedPassword or
+	// NotBreachedPassword
+	ErrPwnedPassword = errors.New("Password has appeared in a data breach")
+	// ErrPwnedPasswordsUnavailable is used when the Pwned Passwords API can't be queried
+	ErrPwnedPasswordsUnavailable = errors.New("Pwned Passwords API unavailable")
+	// ErrInvalidBreachFilter is used when a BreachFilter file is malformed
+	ErrInvalidBreachFilter = errors.New("Invalid breach filter")
+	// ErrCommonPassword is used when a password is a common password. See CommonPasswordError
+	ErrCommonPassword = errors.New("Password is a common password")
+	// ErrWeakPassword is used when a password's estimated strength is too low. See WeakPasswordError
+	ErrWeakPassword = errors.New("Password is too weak")
+	// ErrPasswordContainsUserInfo is used when a password contains or is similar to the user's information. See
+	// UserInfoPasswordError
+	ErrPasswordContainsUserInfo = errors.New("Password contains user information")
 )
 
+// WorkFactorMismatchError satisfies the error interface and describes a WorkFactor that can't be used with a Kdf
+type WorkFactorMismatchError struct {
+	Kdf        Kdf
+	WorkFactor WorkFactor
+}
+
+func (e WorkFactorMismatchError) Error() string {
+	return fmt.Sprintf("WorkFactor %T can not be used with Kdf %v", e.WorkFactor, e.Kdf)
+}
+
+// BelowSecurityFloorError satisfies the error interface and describes a Config parameter that is below its security
+// floor. e.g. SaltSize, KeyLength, or WorkFactor
+type BelowSecurityFloorError struct {
+	Parameter string
+	Value     interface{}
+	Minimum   interface{}
+}
+
+func (e BelowSecurityFloorError) Error() string {
+	return fmt.Sprintf("Config %s (%v) is below the security floor (%v)", e.Parameter, e.Value, e.Minimum)
+}
+
+// UpgradeError satisfies the error interface and describes why a Credential whose password matched could not be
+// upgraded to meet a Config
+type UpgradeError struct {
+	Err error
+}
+
+func (e UpgradeError) Error() string {
+	return fmt.Sprintf("Unable to upgrade credential: %v", e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e UpgradeError) Unwrap() error {
+	return e.Err
+}
+
+// AccountLockedError satisfies the error interface and describes a locked account. errors.Is(err, ErrAccountLocked)
+// returns true for an AccountLockedError
+type AccountLockedError struct {
+	UserID     UserID
+	RetryAfter time.Time // The time the account is unlocked
+}
+
+func (e AccountLockedError) Error() string {
+	return fmt.Sprintf("Account for user %d is locked until %s", e.UserID, e.RetryAfter.Format(time.RFC3339))
+}
+
+// Is returns true if the target is ErrAccountLocked
+func (e AccountLockedError) Is(target error) bool {
+	return target == ErrAccountLocked
+}
+
+// RateLimitedError satisfies the error interface and describes a password verification rejected by a RateLimiter.
+// errors.Is(err, ErrRateLimited) returns true for a RateLimitedError
+type RateLimitedError struct {
+	IP         net.IP
+	RetryAfter time.Duration // The time until the verification may be retried. 0 if unknown
+}
+
+func (e RateLimitedError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("Password verification for IP %v is rate limited. Retry after %v", e.IP, e.RetryAfter)
+	}
+	return fmt.Sprintf("Password verification for IP %v is rate limited", e.IP)
+}
+
+// Is returns true if the target is ErrRateLimited
+func (e RateLimitedError) Is(target error) bool {
+	return target == ErrRateLimited
+}
+
+// CommonPasswordError satisfies the error interface and describes the normalized form of a password that matched a
+// common password. errors.Is(err, ErrCommonPassword) returns true for a CommonPasswordError
+type CommonPasswordError struct {
+	Form          string // The normalized form that matched
+	Normalization string // The normalizations applied to get the form. e.g. "case folding, trimming digits and symbols"
+}
+
+func (e CommonPasswordError) Error() string {
+	return fmt.Sprintf("%v (matched %q after %s)", ErrCommonPassword, e.Form, e.Normalization)
+}
+
+// Is returns true if the target is ErrCommonPassword
+func (e CommonPasswordError) Is(target error) bool {
+	return target == ErrCommonPassword
+}
+
+// WeakPasswordError satisfies the error interface and describes why a password's estimated Strength is below the
+// minimum Score. errors.Is(err, ErrWeakPassword) returns true for a WeakPasswordError
+type WeakPasswordError struct {
+	Strength     Strength
+	MinimumScore int
+}
+
+func (e WeakPasswordError) Error() string {
+	msg := fmt.Sprintf("%v (score %d of %d, minimum %d)", ErrWeakPassword, e.Strength.Score, MaxStrengthScore,
+		e.MinimumScore)
+	if e.Strength.Feedback.Warning != "" {
+		msg += ". " + e.Strength.Feedback.Warning
+	}
+	if len(e.Strength.Feedback.Suggestions) > 0 {
+		msg += ". " + strings.Join(e.Strength.Feedback.Suggestions, ". ")
+	}
+	return msg
+}
+
+// Is returns true if the target is ErrWeakPassword
+func (e WeakPasswordError) Is(target error) bool {
+	return target == ErrWeakPassword
+}
+
+// UserInfoPasswordError satisfies the error interface and describes which of the user's attributes a password is too
+// similar to. errors.Is(err, ErrPasswordContainsUserInfo) returns true for a UserInfoPasswordError
+type UserInfoPasswordError struct {
+	Attribute string // e.g. username or email
+}
+
+func (e UserInfoPasswordError) Error() string {
+	return fmt.Sprintf("Password is too similar to the user's %s", e.Attribute)
+}
+
+// Is returns true if the target is ErrPasswordContainsUserInfo
+func (e UserInfoPasswordError) Is(target error) bool {
+	return target == ErrPasswordContainsUserInfo
+}
+
+// ConfigError satisfies the error interface and describes why a Config can't be used to hash or verify passwords.
+// e.g. its WorkFactor is below the SecurityFloors
+type ConfigError struct {
+	Err error
+}
+
+func (e ConfigError) Error() string {
+	return fmt.Sprintf("Invalid Config: %v", e.Err)
+}
+
+// Unwrap returns the reasons the Config is invalid. e.g. a BelowSecurityFloorError
+func (e ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// StoreError satisfies the error interface and describes a CredentialStore failure
+type StoreError struct {
+	Op     string // The failed operation. e.g. load or store
+	UserID UserID
+	Err    error
+}
+
+func (e StoreError) Error() string {
+	return fmt.Sprintf("Unable to %s credential for user %d: %v", e.Op, e.UserID, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e StoreError) Unwrap() error {
+	return e.Err
+}
+
 // PasswordPolicyError satisfies the error interface and describes the reason for a PasswordPolicy check failure
 type PasswordPolicyError struct {
 	PasswordPolicy PasswordPolicy
@@ -22,6 +225,11 @@ func (e PasswordPolicyError) Error() string {
 	return e.Err.Error()
 }
 
+// Unwrap returns the reason the PasswordPolicy wasn't met. e.g. a WeakPasswordError
+func (e PasswordPolicyError) Unwrap() error {
+	return e.Err
+}
+
 // PasswordPoliciesNotMet satisfies the error interface and tracks the unmet password policies
 type PasswordPoliciesNotMet struct {
 	UnMetPasswordPolicies []PasswordPolicyError
@@ -34,3 +242,12 @@ func (e PasswordPoliciesNotMet) Error() string {
 	}
 	return fmt.Sprintf("Password policies not met due to: %s", strings.Join(errorStrs, ", "))
 }
+
+// Unwrap returns the unmet PasswordPolicyErrors so that errors.Is and errors.As can check the reasons
+func (e PasswordPoliciesNotMet) Unwrap() []error {
+	errs := make([]error, 0, len(e.UnMetPasswordPolicies))
+	for _, ppe := range e.UnMetPasswordPolicies {
+		errs = append(errs, ppe)
+	}
+	return errs
+}
@@ -4,31 +4,23 @@ import (
 	"bytes"
 	"context"
 	"fmt"
-	"strconv"
-	"strings"
 )
 
 import (
 	"github.com/dhui/passhash"
 )
 
-const (
-	storeCredentialFormat string = "%d %s %x %x" //nolint:gosec // Using space as a separator for Sscanf compatibility
-)
-
-// StringCredentialStore is an example CredentialStore that stores the Credential as a string
+// StringCredentialStore is an example CredentialStore that stores the Credential as a PHC string
 type StringCredentialStore struct {
 	StoredCredential string
 }
 
 func (store *StringCredentialStore) Store(credential *passhash.Credential) error {
-	cfParams, _ := credential.WorkFactor.Marshal()
-	cfStrParams := make([]string, 0, len(cfParams))
-	for _, param := range cfParams {
-		cfStrParams = append(cfStrParams, strconv.Itoa(param))
+	phc, err := credential.MarshalPHC()
+	if err != nil {
+		return err
 	}
-	cfStore := strings.Join(cfStrParams, ",")
-	store.StoredCredential = fmt.Sprintf(storeCredentialFormat, credential.Kdf, cfStore, string(credential.Salt), string(credential.Hash))
+	store.StoredCredential = phc
 	return nil
 }
 
@@ -36,32 +28,13 @@ func (store *StringCredentialStore) StoreContext(ctx context.Context, credential
 	return store.Store(credential)
 }
 
-func (store *StringCredentialStore) Load(passhash.UserID) (*passhash.Credential, error) {
-	credential := passhash.Credential{}
-
-	var cfStore string
-	fmt.Sscanf(store.StoredCredential, storeCredentialFormat, &credential.Kdf, &cfStore, &credential.Salt, &credential.Hash)
-
-	cfStrParams := strings.Split(cfStore, ",")
-	cfParams := make([]int, 0, len(cfStrParams))
-	for _, paramStr := range cfStrParams {
-		i, err := strconv.Atoi(paramStr)
-		if err != nil {
-			return nil, err
-		}
-		cfParams = append(cfParams, i)
-	}
-
-	wf, err := passhash.NewWorkFactorForKdf(credential.Kdf)
+func (store *StringCredentialStore) Load(userID passhash.UserID) (*passhash.Credential, error) {
+	credential, err := passhash.ParsePHC(store.StoredCredential)
 	if err != nil {
 		return nil, err
 	}
-	if err := wf.Unmarshal(cfParams); err != nil {
-		return nil, err
-	}
-	credential.WorkFactor = wf
-
-	return &credential, nil
+	credential.UserID = userID
+	return credential, nil
 }
 
 func (store *StringCredentialStore) LoadContext(ctx context.Context, userID passhash.UserID) (*passhash.Credential,
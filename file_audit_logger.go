@@ -0,0 +1,475 @@
+package passhash
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// FileSyncPolicy determines when a FileAuditLogger fsyncs its current segment
+type FileSyncPolicy int
+
+const (
+	// SyncEveryLog fsyncs after every log. No logs are lost if the machine crashes, but it's the slowest policy
+	SyncEveryLog FileSyncPolicy = iota
+	// SyncInterval fsyncs after a log if SyncInterval has passed since the last fsync. Logs written since the last
+	// fsync may be lost if the machine crashes
+	SyncInterval
+	// SyncOnRotate only fsyncs when a segment is rotated and when the FileAuditLogger is closed
+	SyncOnRotate
+)
+
+const (
+	fileAuditSegmentPattern = "audit-*.jsonl"
+	fileAuditSegmentFormat  = "audit-%08d.jsonl"
+)
+
+const (
+	// DefaultFileAuditLoggerIndexPerUser is the default number of each user's newest logs indexed by a FileAuditLogger
+	DefaultFileAuditLoggerIndexPerUser = 1000
+	// DefaultFileAuditLoggerIndexSegments is the default number of the newest segments indexed by a FileAuditLogger
+	DefaultFileAuditLoggerIndexSegments = 4
+)
+
+// FileAuditLoggerOptions configures a FileAuditLogger
+type FileAuditLoggerOptions struct {
+	Dir             string         // The directory containing the segments. Required
+	MaxSegmentBytes int64          // The size at which a segment is rotated. Defaults to 64 MiB
+	MaxSegmentAge   time.Duration  // The age at which a segment is rotated. 0 disables rotating by age
+	MaxSegments     int            // The number of segments to keep. Older segments are deleted. 0 keeps all segments
+	Sync            FileSyncPolicy // When to fsync. Defaults to SyncEveryLog
+	SyncInterval    time.Duration  // The minimum time between fsyncs for SyncInterval. Defaults to 1 second
+	// IndexPerUser is the number of each user's newest logs indexed for LastN and LastNWithTypes. Defaults to
+	// DefaultFileAuditLoggerIndexPerUser
+	IndexPerUser int
+	// IndexSegments is the number of the newest segments indexed for LastN and LastNWithTypes. Older segments are kept
+	// according to MaxSegments, but only read by ReadEvents. Defaults to DefaultFileAuditLoggerIndexSegments
+	IndexSegments int
+	// Now returns the current time, used to timestamp logs and rotate segments by age. Defaults to time.Now
+	Now func() time.Time
+}
+
+// fileAuditRecord is the JSON line format of a FileAuditLogger log
+type fileAuditRecord struct {
+	UserID     UserID            `json:"user_id"`
+	Time       time.Time         `json:"time"`
+	Type       AuditType         `json:"audit_type"`
+	IP         string            `json:"ip,omitempty"`
+	Reason     AuditReason       `json:"reason,omitempty"`
+	RequestID  string            `json:"request_id,omitempty"`
+	UserAgent  string            `json:"user_agent,omitempty"`
+	ClientID   string            `json:"client_id,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+func (rec fileAuditRecord) event() AuditEvent {
+	return AuditEvent{UserID: rec.UserID, Time: rec.Time, Type: rec.Type, IP: net.ParseIP(rec.IP), Reason: rec.Reason,
+		RequestID: rec.RequestID, UserAgent: rec.UserAgent, ClientID: rec.ClientID, Attributes: rec.Attributes}
+}
+
+// fileAuditRef is the location of a log in a segment
+type fileAuditRef struct {
+	segment int
+	offset  int64
+	length  int
+	typ     AuditType
+}
+
+// FileAuditLogger is an append-only AuditLogger that writes each log as a JSON line to segment files in a directory.
+// Segments are rotated by size and age. LastN and LastNWithTypes read logs back from the segments using an in-memory
+// per-user index that is rebuilt from the segments when the FileAuditLogger is opened. The index only covers each
+// user's IndexPerUser newest logs in the IndexSegments newest segments, so its memory usage is bounded regardless of
+// how many segments are kept.
+// Log doesn't return errors, so use Err or WriteEvent to check for write failures.
+// A FileAuditLogger is safe for concurrent use, but only one FileAuditLogger may use a directory at a time.
+type FileAuditLogger struct {
+	mu       sync.Mutex
+	opts     FileAuditLoggerOptions
+	segments []int
+	file     *os.File
+	size     int64
+	started  time.Time
+	lastSync time.Time
+	index    map[UserID][]fileAuditRef
+	err      error
+	closed   bool
+}
+
+// OpenFileAuditLogger opens the FileAuditLogger in opts.Dir, creating the directory if necessary. Logs in existing
+// segments are indexed and new logs are appended to the newest segment. A partially written trailing line (e.g. due
+// to a crash) is truncated
+func OpenFileAuditLogger(opts FileAuditLoggerOptions) (*FileAuditLogger, error) {
+	if opts.Dir == "" {
+		return nil, errors.New("FileAuditLogger Dir is required")
+	}
+	if opts.MaxSegmentBytes <= 0 {
+		opts.MaxSegmentBytes = 64 * 1024 * 1024
+	}
+	if opts.SyncInterval <= 0 {
+		opts.SyncInterval = time.Second
+	}
+	if opts.IndexPerUser <= 0 {
+		opts.IndexPerUser = DefaultFileAuditLoggerIndexPerUser
+	}
+	if opts.IndexSegments <= 0 {
+		opts.IndexSegments = DefaultFileAuditLoggerIndexSegments
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	if err := os.MkdirAll(opts.Dir, 0o700); err != nil {
+		return nil, err
+	}
+	paths, err := filepath.Glob(filepath.Join(opts.Dir, fileAuditSegmentPattern))
+	if err != nil {
+		return nil, err
+	}
+	al := &FileAuditLogger{opts: opts, index: make(map[UserID][]fileAuditRef)}
+	for _, path := range paths {
+		var segment int
+		if _, err := fmt.Sscanf(filepath.Base(path), fileAuditSegmentFormat, &segment); err == nil {
+			al.segments = append(al.segments, segment)
+		}
+	}
+	slices.Sort(al.segments)
+
+	now := opts.Now()
+	if len(al.segments) == 0 {
+		if err := al.rotate(now); err != nil {
+			return nil, err
+		}
+		return al, nil
+	}
+	var first time.Time
+	for i, segment := range al.segments[max(0, len(al.segments)-opts.IndexSegments):] {
+		last := i == min(len(al.segments), opts.IndexSegments)-1
+		if first, al.size, err = al.indexSegment(segment, last); err != nil {
+			return nil, err
+		}
+	}
+	last := al.segments[len(al.segments)-1]
+	if al.file, err = os.OpenFile(al.segmentPath(last), os.O_WRONLY|os.O_APPEND, 0o600); err != nil {
+		return nil, err
+	}
+	al.started, al.lastSync = now, now
+	if !first.IsZero() {
+		al.started = first
+	}
+	if err := al.prune(); err != nil {
+		_ = al.file.Close()
+		return nil, err
+	}
+	return al, nil
+}
+
+func (al *FileAuditLogger) segmentPath(segment int) string {
+	return filepath.Join(al.opts.Dir, fmt.Sprintf(fileAuditSegmentFormat, segment))
+}
+
+// indexSegment indexes the logs in the segment and returns the time of its first log and its size.
+// A partially written trailing line in the last segment is truncated
+func (al *FileAuditLogger) indexSegment(segment int, last bool) (time.Time, int64, error) {
+	path := al.segmentPath(segment)
+	f, err := os.Open(path) // #nosec G304 -- the path is a segment in the configured directory
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	defer f.Close() // nolint: errcheck
+	var first time.Time
+	var offset int64
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) > 0 && last {
+				return first, offset, os.Truncate(path, offset)
+			}
+			return first, offset, nil
+		}
+		if err != nil {
+			return time.Time{}, 0, err
+		}
+		var rec fileAuditRecord
+		if err := json.Unmarshal(line, &rec); err == nil {
+			if first.IsZero() {
+				first = rec.Time
+			}
+			al.addRef(rec.UserID, fileAuditRef{segment: segment, offset: offset, length: len(line), typ: rec.Type})
+		}
+		offset += int64(len(line))
+	}
+}
+
+// rotate closes the current segment, if any, and starts a new segment
+func (al *FileAuditLogger) rotate(now time.Time) error {
+	if al.file != nil {
+		if err := al.file.Sync(); err != nil {
+			return err
+		}
+		if err := al.file.Close(); err != nil {
+			return err
+		}
+		al.file = nil
+	}
+	segment := 1
+	if len(al.segments) > 0 {
+		segment = al.segments[len(al.segments)-1] + 1
+	}
+	f, err := os.OpenFile(al.segmentPath(segment), os.O_WRONLY|os.O_APPEND|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	al.file, al.size, al.started, al.lastSync = f, 0, now, now
+	al.segments = append(al.segments, segment)
+	if len(al.segments) > al.opts.IndexSegments {
+		al.unindexBefore(al.segments[len(al.segments)-al.opts.IndexSegments])
+	}
+	return al.prune()
+}
+
+// addRef indexes the user's log, dropping the user's oldest indexed log if there are more than IndexPerUser
+func (al *FileAuditLogger) addRef(userID UserID, ref fileAuditRef) {
+	refs := al.index[userID]
+	if len(refs) >= al.opts.IndexPerUser {
+		refs = refs[len(refs)-al.opts.IndexPerUser+1:]
+	}
+	al.index[userID] = append(refs, ref)
+}
+
+// unindexBefore removes the logs in segments older than the segment from the index
+func (al *FileAuditLogger) unindexBefore(oldest int) {
+	for userID, refs := range al.index {
+		i, _ := slices.BinarySearchFunc(refs, oldest, func(ref fileAuditRef, segment int) int {
+			return ref.segment - segment
+		})
+		if i == len(refs) {
+			delete(al.index, userID)
+		} else if i > 0 {
+			al.index[userID] = slices.Clone(refs[i:])
+		}
+	}
+}
+
+// prune deletes the oldest segments and their logs from the index if there are more than MaxSegments
+func (al *FileAuditLogger) prune() error {
+	if al.opts.MaxSegments <= 0 || len(al.segments) <= al.opts.MaxSegments {
+		return nil
+	}
+	oldest := al.segments[len(al.segments)-al.opts.MaxSegments]
+	for _, segment := range al.segments[:len(al.segments)-al.opts.MaxSegments] {
+		if err := os.Remove(al.segmentPath(segment)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	al.segments = slices.Clone(al.segments[len(al.segments)-al.opts.MaxSegments:])
+	al.unindexBefore(oldest)
+	return nil
+}
+
+// Log appends the audit log to the current segment
+func (al *FileAuditLogger) Log(userID UserID, at AuditType, ip net.IP) {
+	ctx := context.Background()
+	event := newAuditEvent(ctx, userID, at, ip, "")
+	event.Time = al.opts.Now()
+	al.LogEvent(ctx, event)
+}
+
+// LogEvent appends the audit event to the current segment. Use Err to check for write failures
+func (al *FileAuditLogger) LogEvent(ctx context.Context, event AuditEvent) {
+	_ = al.WriteEvent(ctx, event)
+}
+
+// WriteEvent appends the audit event to the current segment, returning an error if it wasn't written. An fsync failure
+// after the log is written is only returned by Err
+func (al *FileAuditLogger) WriteEvent(_ context.Context, event AuditEvent) error {
+	if event.Time.IsZero() {
+		event.Time = al.opts.Now()
+	}
+	rec := fileAuditRecord{UserID: event.UserID, Time: event.Time, Type: event.Type, Reason: event.Reason,
+		RequestID: event.RequestID, UserAgent: event.UserAgent, ClientID: event.ClientID, Attributes: event.Attributes}
+	if len(event.IP) > 0 {
+		rec.IP = event.IP.String()
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		al.setErr(err)
+		return err
+	}
+	line = append(line, '\n')
+
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	if al.closed {
+		al.err = ErrAuditLoggerClosed
+		return al.err
+	}
+	now := al.opts.Now()
+	if (al.size > 0 && al.size+int64(len(line)) > al.opts.MaxSegmentBytes) ||
+		(al.opts.MaxSegmentAge > 0 && now.Sub(al.started) >= al.opts.MaxSegmentAge) {
+		if err := al.rotate(now); err != nil {
+			al.err = err
+			return err
+		}
+	}
+	offset := al.size
+	if _, err := al.file.Write(line); err != nil {
+		al.err = err
+		// Remove any partially written line so that the offsets of later logs are correct
+		if err := al.file.Truncate(offset); err != nil {
+			al.err = errors.Join(al.err, err)
+		}
+		return al.err
+	}
+	al.size += int64(len(line))
+	al.addRef(event.UserID, fileAuditRef{segment: al.segments[len(al.segments)-1], offset: offset, length: len(line),
+		typ: event.Type})
+	if al.opts.Sync == SyncEveryLog || (al.opts.Sync == SyncInterval && now.Sub(al.lastSync) >= al.opts.SyncInterval) {
+		if err := al.file.Sync(); err != nil {
+			al.err = err
+			return nil
+		}
+		al.lastSync = now
+	}
+	return nil
+}
+
+// LastN gets the last N logs for a user, from oldest to newest
+func (al *FileAuditLogger) LastN(userID UserID, n int) []Log {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	refs := al.index[userID]
+	if n <= 0 || len(refs) == 0 {
+		return []Log{}
+	}
+	return al.read(refs[max(0, len(refs)-n):])
+}
+
+// LastNWithTypes gets the last N logs for a user with the specified types, from newest to oldest
+func (al *FileAuditLogger) LastNWithTypes(userID UserID, n int, auditTypes ...AuditType) []Log {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	refs := al.index[userID]
+	if n <= 0 || len(refs) == 0 {
+		return []Log{}
+	}
+	matches := make([]fileAuditRef, 0, min(n, len(refs)))
+	for i := len(refs) - 1; i >= 0 && len(matches) < n; i-- {
+		if slices.Contains(auditTypes, refs[i].typ) {
+			matches = append(matches, refs[i])
+		}
+	}
+	return al.read(matches)
+}
+
+// read reads the referenced logs from the segments, in order
+func (al *FileAuditLogger) read(refs []fileAuditRef) []Log {
+	logs := make([]Log, 0, len(refs))
+	files := map[int]*os.File{}
+	defer func() {
+		for _, f := range files {
+			_ = f.Close()
+		}
+	}()
+	for _, ref := range refs {
+		f, ok := files[ref.segment]
+		if !ok {
+			var err error
+			// #nosec G304 -- the path is a segment in the configured directory
+			if f, err = os.Open(al.segmentPath(ref.segment)); err != nil {
+				al.err = err
+				continue
+			}
+			files[ref.segment] = f
+		}
+		line := make([]byte, ref.length)
+		if _, err := f.ReadAt(line, ref.offset); err != nil {
+			al.err = err
+			continue
+		}
+		var rec fileAuditRecord
+		if err := json.Unmarshal(bytes.TrimSpace(line), &rec); err != nil {
+			al.err = err
+			continue
+		}
+		logs = append(logs, rec.event().log())
+	}
+	return logs
+}
+
+// ReadEvents calls fn with each AuditEvent in the segments, from oldest to newest. Logging blocks until ReadEvents
+// returns. An error is returned if a log isn't valid JSON
+func (al *FileAuditLogger) ReadEvents(fn func(AuditEvent) error) error {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	for _, segment := range al.segments {
+		if err := al.readSegmentEvents(segment, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (al *FileAuditLogger) readSegmentEvents(segment int, fn func(AuditEvent) error) error {
+	f, err := os.Open(al.segmentPath(segment)) // #nosec G304 -- the path is a segment in the configured directory
+	if err != nil {
+		return err
+	}
+	defer f.Close() // nolint: errcheck
+	r := bufio.NewReader(f)
+	for offset := int64(0); ; {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var rec fileAuditRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return fmt.Errorf("Invalid audit log in segment %d at offset %d: %w", segment, offset, err)
+		}
+		if err := fn(rec.event()); err != nil {
+			return err
+		}
+		offset += int64(len(line))
+	}
+}
+
+func (al *FileAuditLogger) setErr(err error) {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	al.err = err
+}
+
+// Err returns the last error encountered while writing or reading logs, if any
+func (al *FileAuditLogger) Err() error {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	return al.err
+}
+
+// Close fsyncs and closes the current segment. Logs logged after Close are dropped and Err returns
+// ErrAuditLoggerClosed
+func (al *FileAuditLogger) Close() error {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	if al.closed {
+		return nil
+	}
+	al.closed = true
+	if err := al.file.Sync(); err != nil {
+		_ = al.file.Close()
+		return err
+	}
+	return al.file.Close()
+}
@@ -0,0 +1,358 @@
+package passhash_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dhui/passhash"
+)
+
+func openTestFileAuditLogger(t *testing.T, opts passhash.FileAuditLoggerOptions) *passhash.FileAuditLogger {
+	t.Helper()
+	al, err := passhash.OpenFileAuditLogger(opts)
+	if err != nil {
+		t.Fatal("Unable to open FileAuditLogger", err)
+	}
+	t.Cleanup(func() { _ = al.Close() })
+	return al
+}
+
+func segments(t *testing.T, dir string) []string {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join(dir, "audit-*.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return paths
+}
+
+func TestAuditTypeText(t *testing.T) {
+	for _, at := range []passhash.AuditType{passhash.AuthnFailed, passhash.PasswordReset, passhash.AuditType(1000)} {
+		text, err := at.MarshalText()
+		if err != nil {
+			t.Fatal("Unable to marshal AuditType", err)
+		}
+		var unmarshaled passhash.AuditType
+		if err := unmarshaled.UnmarshalText(text); err != nil {
+			t.Fatal("Unable to unmarshal AuditType", err)
+		}
+		if unmarshaled != at {
+			t.Errorf("AuditType changed after marshaling. %v != %v", unmarshaled, at)
+		}
+	}
+	var at passhash.AuditType
+	if err := at.UnmarshalText([]byte("unknown")); err == nil {
+		t.Error("Unmarshaled invalid AuditType")
+	}
+}
+
+func TestFileAuditLoggerRequiresDir(t *testing.T) {
+	if _, err := passhash.OpenFileAuditLogger(passhash.FileAuditLoggerOptions{}); err == nil {
+		t.Error("Opened FileAuditLogger without a directory")
+	}
+}
+
+func TestFileAuditLoggerLastN(t *testing.T) {
+	al := openTestFileAuditLogger(t, passhash.FileAuditLoggerOptions{Dir: t.TempDir()})
+	userID := passhash.UserID(1)
+	n := setupAuditLoggerTestData(userID, al)
+	setupAuditLoggerTestData(passhash.UserID(2), al)
+
+	if l := len(al.LastN(userID, n/2)); l != n/2 {
+		t.Errorf("Did not retrieve expected number of logs. Have %d logs instead of %d", l, n/2)
+	}
+	lastN := al.LastN(userID, n*2)
+	if l := len(lastN); l != n {
+		t.Fatalf("Did not retrieve expected number of logs. Have %d logs instead of %d", l, n)
+	}
+	if lastN[0].Type != passhash.AuthnSucceeded || lastN[n-1].Type != passhash.UpgradedKdf {
+		t.Error("Logs not ordered from oldest to newest", lastN)
+	}
+	for _, log := range lastN {
+		if log.UserID != userID {
+			t.Error("Got log for another user", log)
+		}
+	}
+	lastN = al.LastNWithTypes(userID, n, passhash.AuthnFailed, passhash.AuthnFailed)
+	if l := len(lastN); l != n/3 {
+		t.Errorf("Did not retrieve expected number of logs. Have %d logs instead of %d", l, n/3)
+	}
+	if l := len(al.LastNWithTypes(userID, 2, passhash.AuthnFailed)); l != 2 {
+		t.Errorf("Did not retrieve expected number of logs. Have %d logs instead of 2", l)
+	}
+	if l := len(al.LastN(passhash.UserID(3), n)); l != 0 {
+		t.Errorf("Got %d logs for a user without logs", l)
+	}
+	if err := al.Err(); err != nil {
+		t.Error("Unexpected error", err)
+	}
+}
+
+func TestFileAuditLoggerJSONLines(t *testing.T) {
+	dir := t.TempDir()
+	al := openTestFileAuditLogger(t, passhash.FileAuditLoggerOptions{Dir: dir})
+	ctx := passhash.WithRequestID(context.Background(), "request-1")
+	al.LogEvent(ctx, passhash.AuditEvent{UserID: 1, Time: time.Now(), Type: passhash.AuthnFailed,
+		IP: net.ParseIP("192.0.2.1"), Reason: passhash.ReasonWrongPassword, RequestID: "request-1"})
+	paths := segments(t, dir)
+	if len(paths) != 1 {
+		t.Fatalf("Unexpected number of segments. %d != 1", len(paths))
+	}
+	data, err := os.ReadFile(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := map[string]interface{}{}
+	if err := json.Unmarshal(data, &record); err != nil {
+		t.Fatal("Segment isn't JSON lines", err)
+	}
+	expected := map[string]interface{}{"user_id": float64(1), "audit_type": "authn_failed", "ip": "192.0.2.1",
+		"reason": "wrong_password", "request_id": "request-1"}
+	for k, v := range expected {
+		if record[k] != v {
+			t.Errorf("Unexpected %s. %v != %v", k, record[k], v)
+		}
+	}
+	logs := al.LastN(passhash.UserID(1), 1)
+	if len(logs) != 1 || !logs[0].IP.Equal(net.ParseIP("192.0.2.1")) || logs[0].Reason != passhash.ReasonWrongPassword {
+		t.Error("Unexpected logs", logs)
+	}
+}
+
+func TestFileAuditLoggerReopen(t *testing.T) {
+	dir := t.TempDir()
+	userID := passhash.UserID(1)
+	al, err := passhash.OpenFileAuditLogger(passhash.FileAuditLoggerOptions{Dir: dir, MaxSegmentBytes: 512})
+	if err != nil {
+		t.Fatal("Unable to open FileAuditLogger", err)
+	}
+	n := setupAuditLoggerTestData(userID, al)
+	if err := al.Close(); err != nil {
+		t.Fatal("Unable to close FileAuditLogger", err)
+	}
+	al.Log(userID, passhash.AuthnFailed, passhash.EmptyIP)
+	if !errors.Is(al.Err(), passhash.ErrAuditLoggerClosed) {
+		t.Error("Expected ErrAuditLoggerClosed. Got:", al.Err())
+	}
+
+	al = openTestFileAuditLogger(t, passhash.FileAuditLoggerOptions{Dir: dir, MaxSegmentBytes: 512})
+	if l := len(al.LastN(userID, n)); l != n {
+		t.Errorf("Logs not persisted. Have %d logs instead of %d", l, n)
+	}
+	al.Log(userID, passhash.PasswordReset, passhash.EmptyIP)
+	lastN := al.LastN(userID, n+1)
+	if len(lastN) != n+1 || lastN[n].Type != passhash.PasswordReset {
+		t.Error("Log not appended after reopening", lastN)
+	}
+}
+
+func TestFileAuditLoggerRotateBySize(t *testing.T) {
+	dir := t.TempDir()
+	al := openTestFileAuditLogger(t, passhash.FileAuditLoggerOptions{Dir: dir, MaxSegmentBytes: 256,
+		IndexSegments: 100})
+	userID := passhash.UserID(1)
+	n := setupAuditLoggerTestData(userID, al)
+	paths := segments(t, dir)
+	if len(paths) < 3 {
+		t.Fatalf("Segments not rotated. Have %d segments", len(paths))
+	}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() > 256 {
+			t.Errorf("Segment %s is larger than MaxSegmentBytes. %d > 256", path, info.Size())
+		}
+	}
+	if l := len(al.LastN(userID, n)); l != n {
+		t.Errorf("Did not retrieve logs across segments. Have %d logs instead of %d", l, n)
+	}
+}
+
+func TestFileAuditLoggerRotateByAge(t *testing.T) {
+	dir := t.TempDir()
+	clock := newFakeClock()
+	al := openTestFileAuditLogger(t, passhash.FileAuditLoggerOptions{Dir: dir, MaxSegmentAge: time.Hour,
+		Now: clock.Now})
+	userID := passhash.UserID(1)
+	al.Log(userID, passhash.AuthnSucceeded, passhash.EmptyIP)
+	clock.now = clock.now.Add(30 * time.Minute)
+	al.Log(userID, passhash.AuthnSucceeded, passhash.EmptyIP)
+	if l := len(segments(t, dir)); l != 1 {
+		t.Errorf("Segment rotated early. Have %d segments", l)
+	}
+	clock.now = clock.now.Add(30 * time.Minute)
+	al.Log(userID, passhash.AuthnSucceeded, passhash.EmptyIP)
+	if l := len(segments(t, dir)); l != 2 {
+		t.Errorf("Segment not rotated. Have %d segments", l)
+	}
+}
+
+func TestFileAuditLoggerTimestamps(t *testing.T) {
+	clock := newFakeClock()
+	al := openTestFileAuditLogger(t, passhash.FileAuditLoggerOptions{Dir: t.TempDir(), Now: clock.Now})
+	al.LogEvent(context.Background(), passhash.AuditEvent{UserID: 1, Type: passhash.AuthnSucceeded})
+	al.Log(passhash.UserID(1), passhash.AuthnFailed, passhash.EmptyIP)
+	logs := al.LastN(passhash.UserID(1), 2)
+	if len(logs) != 2 {
+		t.Fatalf("Unexpected number of logs. %d != 2", len(logs))
+	}
+	for _, log := range logs {
+		if !log.Time.Equal(clock.now) {
+			t.Errorf("Unexpected time for %v. %v != %v", log.Type, log.Time, clock.now)
+		}
+	}
+}
+
+func TestFileAuditLoggerMaxSegments(t *testing.T) {
+	dir := t.TempDir()
+	al := openTestFileAuditLogger(t, passhash.FileAuditLoggerOptions{Dir: dir, MaxSegmentBytes: 256, MaxSegments: 2})
+	userID := passhash.UserID(1)
+	n := setupAuditLoggerTestData(userID, al)
+	if l := len(segments(t, dir)); l != 2 {
+		t.Errorf("Old segments not deleted. Have %d segments", l)
+	}
+	lastN := al.LastN(userID, n)
+	if len(lastN) == 0 || len(lastN) >= n {
+		t.Errorf("Logs in deleted segments not removed from the index. Have %d logs", len(lastN))
+	}
+	if err := al.Err(); err != nil {
+		t.Error("Unexpected error", err)
+	}
+}
+
+func TestFileAuditLoggerTruncatesPartialLine(t *testing.T) {
+	dir := t.TempDir()
+	userID := passhash.UserID(1)
+	al, err := passhash.OpenFileAuditLogger(passhash.FileAuditLoggerOptions{Dir: dir})
+	if err != nil {
+		t.Fatal("Unable to open FileAuditLogger", err)
+	}
+	al.Log(userID, passhash.AuthnSucceeded, passhash.EmptyIP)
+	if err := al.Close(); err != nil {
+		t.Fatal("Unable to close FileAuditLogger", err)
+	}
+	path := segments(t, dir)[0]
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString(`{"user_id":1,"audit_ty`); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	al = openTestFileAuditLogger(t, passhash.FileAuditLoggerOptions{Dir: dir})
+	al.Log(userID, passhash.AuthnFailed, passhash.EmptyIP)
+	lastN := al.LastN(userID, 10)
+	if len(lastN) != 2 || lastN[1].Type != passhash.AuthnFailed {
+		t.Error("Unexpected logs after truncating partial line", lastN)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "audit_ty\"") || strings.Count(string(data), "\n") != 2 {
+		t.Error("Partial line not truncated", string(data))
+	}
+}
+
+func TestFileAuditLoggerSyncPolicies(t *testing.T) {
+	for _, policy := range []passhash.FileSyncPolicy{passhash.SyncEveryLog, passhash.SyncInterval,
+		passhash.SyncOnRotate} {
+		al := openTestFileAuditLogger(t, passhash.FileAuditLoggerOptions{Dir: t.TempDir(), Sync: policy,
+			SyncInterval: time.Millisecond})
+		userID := passhash.UserID(1)
+		n := setupAuditLoggerTestData(userID, al)
+		if l := len(al.LastN(userID, n)); l != n {
+			t.Errorf("Did not retrieve expected number of logs for policy %v. Have %d logs instead of %d", policy, l, n)
+		}
+	}
+}
+
+func TestFileAuditLoggerConcurrent(t *testing.T) {
+	al := openTestFileAuditLogger(t, passhash.FileAuditLoggerOptions{Dir: t.TempDir(), MaxSegmentBytes: 4096,
+		Sync: passhash.SyncOnRotate, IndexSegments: 100})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(userID passhash.UserID) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				al.Log(userID, passhash.AuthnSucceeded, passhash.EmptyIP)
+				al.LastN(userID, 5)
+			}
+		}(passhash.UserID(i))
+	}
+	wg.Wait()
+	for i := 0; i < 4; i++ {
+		if l := len(al.LastN(passhash.UserID(i), 100)); l != 50 {
+			t.Errorf("Unexpected number of logs for user %d. %d != 50", i, l)
+		}
+	}
+	if err := al.Err(); err != nil {
+		t.Error("Unexpected error", err)
+	}
+}
+
+func TestFileAuditLoggerIndexPerUser(t *testing.T) {
+	dir := t.TempDir()
+	al := openTestFileAuditLogger(t, passhash.FileAuditLoggerOptions{Dir: dir, IndexPerUser: 3})
+	for _, at := range []passhash.AuditType{passhash.AuthnSucceeded, passhash.AuthnFailed, passhash.UpgradedKdf,
+		passhash.PasswordReset} {
+		al.Log(passhash.UserID(1), at, passhash.EmptyIP)
+	}
+	logs := al.LastN(passhash.UserID(1), 10)
+	if len(logs) != 3 || logs[0].Type != passhash.AuthnFailed || logs[2].Type != passhash.PasswordReset {
+		t.Error("Unexpected logs", logs)
+	}
+	if err := al.Close(); err != nil {
+		t.Fatal(err)
+	}
+	al = openTestFileAuditLogger(t, passhash.FileAuditLoggerOptions{Dir: dir, IndexPerUser: 3})
+	if l := len(al.LastN(passhash.UserID(1), 10)); l != 3 {
+		t.Errorf("Unexpected number of logs after reopening. %d != 3", l)
+	}
+}
+
+func TestFileAuditLoggerIndexSegments(t *testing.T) {
+	dir := t.TempDir()
+	opts := passhash.FileAuditLoggerOptions{Dir: dir, MaxSegmentBytes: 1, IndexSegments: 2}
+	al := openTestFileAuditLogger(t, opts)
+	for i := 0; i < 5; i++ {
+		al.Log(passhash.UserID(i), passhash.AuthnSucceeded, passhash.EmptyIP)
+	}
+	check := func() {
+		t.Helper()
+		// Only the users logged in the 2 newest segments are indexed
+		for i, expected := range []int{0, 0, 0, 1, 1} {
+			if l := len(al.LastN(passhash.UserID(i), 10)); l != expected {
+				t.Errorf("Unexpected number of logs for user %d. %d != %d", i, l, expected)
+			}
+		}
+	}
+	check()
+	if err := al.Close(); err != nil {
+		t.Fatal(err)
+	}
+	al = openTestFileAuditLogger(t, opts)
+	check()
+	if n := len(segments(t, dir)); n != 5 {
+		t.Errorf("Unindexed segments deleted. %d segments instead of 5", n)
+	}
+	events := 0
+	if err := al.ReadEvents(func(passhash.AuditEvent) error { events++; return nil }); err != nil || events != 5 {
+		t.Errorf("Unexpected ReadEvents result. %d events instead of 5. Error: %v", events, err)
+	}
+}
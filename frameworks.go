@@ -0,0 +1,348 @@
+package passhash
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Importers and encoders for the password hash formats of popular web frameworks.
+// Formats that embed the salt as text (e.g. Django and Werkzeug) require Credentials created with Config.TextSalt
+
+const (
+	djangoArgon2Prefix = "argon2"
+	djangoScryptKeyLen = 64
+
+	aspNetIdentityV2           = 0x00
+	aspNetIdentityV3           = 0x01
+	aspNetIdentityV2Iter       = 1000
+	aspNetIdentityV2SaltLen    = 16
+	aspNetIdentityV2SubkeyLen  = 32
+	aspNetIdentityV3HeaderLen  = 13
+	aspNetIdentityPrfSha1      = 0
+	aspNetIdentityPrfSha256    = 1
+	aspNetIdentityPrfSha512    = 2
+	aspNetIdentityMinSaltLen   = 16
+	aspNetIdentityMinSubkeyLen = 16
+)
+
+// djangoPbkdf2Algorithms maps Django's PBKDF2 hasher algorithms to Kdfs
+var djangoPbkdf2Algorithms = map[string]Kdf{
+	"pbkdf2_sha256": Pbkdf2Sha256,
+	"pbkdf2_sha1":   Pbkdf2Sha1,
+}
+
+// werkzeugPbkdf2Methods maps Werkzeug's PBKDF2 hash names to Kdfs
+var werkzeugPbkdf2Methods = map[string]Kdf{
+	"sha256": Pbkdf2Sha256,
+	"sha512": Pbkdf2Sha512,
+	"sha1":   Pbkdf2Sha1,
+}
+
+// aspNetIdentityPrfs maps ASP.NET Identity v3 pseudo-random functions to Kdfs
+var aspNetIdentityPrfs = map[uint32]Kdf{
+	aspNetIdentityPrfSha1:   Pbkdf2Sha1,
+	aspNetIdentityPrfSha256: Pbkdf2Sha256,
+	aspNetIdentityPrfSha512: Pbkdf2Sha512,
+}
+
+// lookupName returns the name mapped to the kdf
+func lookupName[K comparable](names map[K]Kdf, kdf Kdf) (K, bool) {
+	for name, k := range names {
+		if k == kdf {
+			return name, true
+		}
+	}
+	var zero K
+	return zero, false
+}
+
+// parsePositiveInt parses a positive int
+func parsePositiveInt(s string) (int, error) {
+	i, err := strconv.Atoi(s)
+	if err != nil || i < 1 {
+		return 0, fmt.Errorf("Invalid positive integer: %q", s)
+	}
+	return i, nil
+}
+
+// textSalt returns the Credential's salt if it may be embedded as text in a hash format using $ as a separator
+func (c *Credential) textSalt() (string, error) {
+	if len(c.Salt) == 0 {
+		return "", errors.New("Credential has an empty salt")
+	}
+	for _, b := range c.Salt {
+		if b < '!' || b > '~' || b == '$' {
+			return "", errors.New("Credential salt is not text. Use Config.TextSalt to create compatible Credentials")
+		}
+	}
+	return string(c.Salt), nil
+}
+
+// pbkdf2Iter returns the Credential's PBKDF2 iterations
+func (c *Credential) pbkdf2Iter() (int, error) {
+	wf, ok := c.WorkFactor.(*Pbkdf2WorkFactor)
+	if !ok {
+		return 0, fmt.Errorf("Unsupported WorkFactor: %T", c.WorkFactor)
+	}
+	return wf.Iter, nil
+}
+
+// ParseDjango imports a password hash from Django's password hashers. The supported formats are:
+//   - pbkdf2_sha256$<iterations>$<salt>$<base64 hash>
+//   - pbkdf2_sha1$<iterations>$<salt>$<base64 hash>
+//   - scrypt$<N>$<salt>$<r>$<p>$<base64 hash>
+//   - argon2$<PHC string without the leading $>
+//
+// The UserID of the returned Credential is not set.
+func ParseDjango(s string) (*Credential, error) {
+	algorithm, rest, ok := strings.Cut(s, "$")
+	if !ok {
+		return nil, fmt.Errorf("Invalid Django hash: %q", s)
+	}
+	if algorithm == djangoArgon2Prefix {
+		return ParsePHC("$" + rest)
+	}
+	fields := strings.Split(rest, "$")
+	var credential *Credential
+	var encodedHash string
+	if kdf, ok := djangoPbkdf2Algorithms[algorithm]; ok {
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("Invalid Django hash: %q", s)
+		}
+		iter, err := parsePositiveInt(fields[0])
+		if err != nil {
+			return nil, err
+		}
+		credential = &Credential{Kdf: kdf, WorkFactor: &Pbkdf2WorkFactor{Iter: iter}, Salt: []byte(fields[1])}
+		encodedHash = fields[2]
+	} else if algorithm == "scrypt" {
+		if len(fields) != 5 {
+			return nil, fmt.Errorf("Invalid Django hash: %q", s)
+		}
+		params := make([]int, 0, 3)
+		for _, f := range []string{fields[0], fields[2], fields[3]} {
+			i, err := parsePositiveInt(f)
+			if err != nil {
+				return nil, err
+			}
+			params = append(params, i)
+		}
+		credential = &Credential{Kdf: Scrypt, WorkFactor: &ScryptWorkFactor{N: params[0], R: params[1], P: params[2]},
+			Salt: []byte(fields[1])}
+		encodedHash = fields[4]
+	} else {
+		return nil, fmt.Errorf("Unsupported Django hash algorithm: %q", algorithm)
+	}
+	if len(credential.Salt) == 0 {
+		return nil, fmt.Errorf("Invalid Django hash: %q", s)
+	}
+	hash, err := base64.StdEncoding.DecodeString(encodedHash)
+	if err != nil || len(hash) == 0 {
+		return nil, fmt.Errorf("Invalid Django hash: %q", s)
+	}
+	credential.Hash = hash
+	return credential, nil
+}
+
+// MarshalDjango encodes the Credential using the format of Django's password hashers. See ParseDjango for the supported
+// formats. Django derives scrypt hashes with a key length of 64 bytes.
+func (c *Credential) MarshalDjango() (string, error) {
+	switch c.Kdf {
+	case Argon2id, Argon2i:
+		phc, err := c.MarshalPHC()
+		if err != nil {
+			return "", err
+		}
+		return djangoArgon2Prefix + phc, nil
+	case Scrypt:
+		wf, ok := c.WorkFactor.(*ScryptWorkFactor)
+		if !ok {
+			return "", fmt.Errorf("Unsupported WorkFactor: %T", c.WorkFactor)
+		}
+		if len(c.Hash) != djangoScryptKeyLen {
+			return "", fmt.Errorf("Django requires scrypt hashes of %d bytes", djangoScryptKeyLen)
+		}
+		salt, err := c.textSalt()
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("scrypt$%d$%s$%d$%d$%s", wf.N, salt, wf.R, wf.P,
+			base64.StdEncoding.EncodeToString(c.Hash)), nil
+	}
+	algorithm, ok := lookupName(djangoPbkdf2Algorithms, c.Kdf)
+	if !ok {
+		return "", fmt.Errorf("Kdf %v is not supported by Django", c.Kdf)
+	}
+	iter, err := c.pbkdf2Iter()
+	if err != nil {
+		return "", err
+	}
+	salt, err := c.textSalt()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s$%d$%s$%s", algorithm, iter, salt, base64.StdEncoding.EncodeToString(c.Hash)), nil
+}
+
+// ParseWerkzeug imports a password hash generated by Werkzeug's generate_password_hash (e.g. Flask).
+// The supported formats are:
+//   - pbkdf2:<sha256|sha512|sha1>:<iterations>$<salt>$<hex hash>
+//   - scrypt:<N>:<r>:<p>$<salt>$<hex hash>
+//
+// The UserID of the returned Credential is not set.
+func ParseWerkzeug(s string) (*Credential, error) {
+	fields := strings.Split(s, "$")
+	if len(fields) != 3 || fields[1] == "" {
+		return nil, fmt.Errorf("Invalid Werkzeug hash: %q", s)
+	}
+	method := strings.Split(fields[0], ":")
+	var credential *Credential
+	switch method[0] {
+	case "pbkdf2":
+		if len(method) != 3 {
+			return nil, fmt.Errorf("Unsupported Werkzeug method (the iterations must be specified): %q", fields[0])
+		}
+		kdf, ok := werkzeugPbkdf2Methods[method[1]]
+		if !ok {
+			return nil, fmt.Errorf("Unsupported Werkzeug PBKDF2 hash: %q", method[1])
+		}
+		iter, err := parsePositiveInt(method[2])
+		if err != nil {
+			return nil, err
+		}
+		credential = &Credential{Kdf: kdf, WorkFactor: &Pbkdf2WorkFactor{Iter: iter}}
+	case "scrypt":
+		if len(method) != 4 {
+			return nil, fmt.Errorf("Unsupported Werkzeug method: %q", fields[0])
+		}
+		params := make([]int, 0, 3)
+		for _, m := range method[1:] {
+			i, err := parsePositiveInt(m)
+			if err != nil {
+				return nil, err
+			}
+			params = append(params, i)
+		}
+		credential = &Credential{Kdf: Scrypt, WorkFactor: &ScryptWorkFactor{N: params[0], R: params[1], P: params[2]}}
+	default:
+		return nil, fmt.Errorf("Unsupported Werkzeug method: %q", fields[0])
+	}
+	hash, err := hex.DecodeString(fields[2])
+	if err != nil || len(hash) == 0 {
+		return nil, fmt.Errorf("Invalid Werkzeug hash: %q", s)
+	}
+	credential.Salt = []byte(fields[1])
+	credential.Hash = hash
+	return credential, nil
+}
+
+// MarshalWerkzeug encodes the Credential using the format of Werkzeug's generate_password_hash. See ParseWerkzeug for
+// the supported formats. Werkzeug derives PBKDF2 hashes with the hash's digest size as the key length and scrypt hashes
+// with a key length of 64 bytes.
+func (c *Credential) MarshalWerkzeug() (string, error) {
+	var method string
+	if c.Kdf == Scrypt {
+		wf, ok := c.WorkFactor.(*ScryptWorkFactor)
+		if !ok {
+			return "", fmt.Errorf("Unsupported WorkFactor: %T", c.WorkFactor)
+		}
+		method = fmt.Sprintf("scrypt:%d:%d:%d", wf.N, wf.R, wf.P)
+	} else {
+		name, ok := lookupName(werkzeugPbkdf2Methods, c.Kdf)
+		if !ok {
+			return "", fmt.Errorf("Kdf %v is not supported by Werkzeug", c.Kdf)
+		}
+		iter, err := c.pbkdf2Iter()
+		if err != nil {
+			return "", err
+		}
+		method = fmt.Sprintf("pbkdf2:%s:%d", name, iter)
+	}
+	salt, err := c.textSalt()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s$%s$%s", method, salt, hex.EncodeToString(c.Hash)), nil
+}
+
+// ParseASPNetIdentity imports a base64 encoded password hash generated by ASP.NET Identity's PasswordHasher.
+// Both the v2 (PBKDF2 with HMAC-SHA1, 1000 iterations) and v3 (PBKDF2 with HMAC-SHA1, HMAC-SHA256, or HMAC-SHA512)
+// formats are supported.
+// The UserID of the returned Credential is not set.
+func ParseASPNetIdentity(s string) (*Credential, error) {
+	decoded, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || len(decoded) == 0 {
+		return nil, fmt.Errorf("Invalid ASP.NET Identity hash: %q", s)
+	}
+	switch decoded[0] {
+	case aspNetIdentityV2:
+		if len(decoded) != 1+aspNetIdentityV2SaltLen+aspNetIdentityV2SubkeyLen {
+			return nil, fmt.Errorf("Invalid ASP.NET Identity v2 hash: %q", s)
+		}
+		return &Credential{Kdf: Pbkdf2Sha1, WorkFactor: &Pbkdf2WorkFactor{Iter: aspNetIdentityV2Iter},
+			Salt: decoded[1 : 1+aspNetIdentityV2SaltLen], Hash: decoded[1+aspNetIdentityV2SaltLen:]}, nil
+	case aspNetIdentityV3:
+		if len(decoded) < aspNetIdentityV3HeaderLen {
+			return nil, fmt.Errorf("Invalid ASP.NET Identity v3 hash: %q", s)
+		}
+		kdf, ok := aspNetIdentityPrfs[binary.BigEndian.Uint32(decoded[1:5])]
+		if !ok {
+			return nil, fmt.Errorf("Unsupported ASP.NET Identity v3 PRF: %q", s)
+		}
+		iter := binary.BigEndian.Uint32(decoded[5:9])
+		saltLen := binary.BigEndian.Uint32(decoded[9:13])
+		rest := decoded[aspNetIdentityV3HeaderLen:]
+		if iter < 1 || iter > math.MaxInt32 || saltLen < aspNetIdentityMinSaltLen ||
+			uint64(len(rest)) < uint64(saltLen)+aspNetIdentityMinSubkeyLen {
+			return nil, fmt.Errorf("Invalid ASP.NET Identity v3 hash: %q", s)
+		}
+		return &Credential{Kdf: kdf, WorkFactor: &Pbkdf2WorkFactor{Iter: int(iter)}, Salt: rest[:saltLen],
+			Hash: rest[saltLen:]}, nil
+	default:
+		return nil, fmt.Errorf("Unsupported ASP.NET Identity format marker: %d", decoded[0])
+	}
+}
+
+// MarshalASPNetIdentity encodes the Credential using the ASP.NET Identity v3 format
+func (c *Credential) MarshalASPNetIdentity() (string, error) {
+	prf, ok := lookupName(aspNetIdentityPrfs, c.Kdf)
+	if !ok {
+		return "", fmt.Errorf("Kdf %v is not supported by ASP.NET Identity", c.Kdf)
+	}
+	iter, err := c.pbkdf2Iter()
+	if err != nil {
+		return "", err
+	}
+	if iter < 1 || int64(iter) > math.MaxInt32 || len(c.Salt) < aspNetIdentityMinSaltLen ||
+		int64(len(c.Salt)) > math.MaxInt32 || len(c.Hash) < aspNetIdentityMinSubkeyLen {
+		return "", errors.New("Credential parameters are not supported by ASP.NET Identity")
+	}
+	encoded := make([]byte, aspNetIdentityV3HeaderLen, aspNetIdentityV3HeaderLen+len(c.Salt)+len(c.Hash))
+	encoded[0] = aspNetIdentityV3
+	binary.BigEndian.PutUint32(encoded[1:5], prf)
+	binary.BigEndian.PutUint32(encoded[5:9], uint32(iter))
+	binary.BigEndian.PutUint32(encoded[9:13], uint32(len(c.Salt)))
+	encoded = append(append(encoded, c.Salt...), c.Hash...)
+	return base64.StdEncoding.EncodeToString(encoded), nil
+}
+
+// ParsePhpass imports a portable phpass hash ($P$ or $H$) as used by WordPress, phpBB, and others.
+// The UserID of the returned Credential is not set.
+func ParsePhpass(s string) (*Credential, error) {
+	if (!strings.HasPrefix(s, "$P$") && !strings.HasPrefix(s, "$H$")) ||
+		len(s) != 4+phpassSaltLen+phpassHashLen || !isCryptB64(s[3:]) {
+		return nil, fmt.Errorf("Invalid phpass hash: %q", s)
+	}
+	log2Rounds := strings.IndexByte(cryptB64Alphabet, s[3])
+	if log2Rounds < phpassMinLog2Rounds || log2Rounds > phpassMaxLog2Rounds {
+		return nil, fmt.Errorf("Invalid phpass rounds: %q", s)
+	}
+	return &Credential{Kdf: Phpass, WorkFactor: &LegacyWorkFactor{Rounds: 1 << log2Rounds},
+		Salt: []byte(s[4 : 4+phpassSaltLen]), Hash: []byte(s[4+phpassSaltLen:])}, nil
+}
@@ -0,0 +1,284 @@
+package passhash_test
+
+import (
+	"testing"
+
+	"github.com/dhui/passhash"
+)
+
+// Hashes of testPassword generated by Python's hashlib in each framework's format
+var frameworkHashTests = map[string]struct {
+	hash      string
+	parse     func(string) (*passhash.Credential, error)
+	marshal   func(*passhash.Credential) (string, error)
+	kdf       passhash.Kdf
+	canCreate bool
+}{
+	"django pbkdf2_sha256": {
+		hash:    "pbkdf2_sha256$1000$Y8wlXqB2Nmhg3Jtz7cSp4a$kDCyyC1c4JIZft65fSKptebT1Q3lpT86eHS/QwxCZxc=",
+		parse:   passhash.ParseDjango,
+		marshal: (*passhash.Credential).MarshalDjango,
+		kdf:     passhash.Pbkdf2Sha256,
+	},
+	"django pbkdf2_sha1": {
+		hash:    "pbkdf2_sha1$1000$Y8wlXqB2Nmhg3Jtz7cSp4a$aF4aSLuzSqgaNVWzxzlJg4aueqw=",
+		parse:   passhash.ParseDjango,
+		marshal: (*passhash.Credential).MarshalDjango,
+		kdf:     passhash.Pbkdf2Sha1,
+	},
+	"django scrypt": {
+		hash: "scrypt$1024$Y8wlXqB2Nmhg3Jtz7cSp4a$8$1$" +
+			"6qYKoMVv7++Vk0OMzo9e8jqbFMvEsf1oHqcgvD4QUbhve4OfFqq2sYvIINv+B1dEAY0rwqMpaFltObHV/uOMJg==",
+		parse:   passhash.ParseDjango,
+		marshal: (*passhash.Credential).MarshalDjango,
+		kdf:     passhash.Scrypt,
+	},
+	"werkzeug pbkdf2:sha256": {
+		hash:    "pbkdf2:sha256:1000$ExWM4Hm7b7wHbFqD$e74fb8f13e9084fab9e83fcf3c627c2bd7da0a2297d6b4a126dfe8af3ba074d4",
+		parse:   passhash.ParseWerkzeug,
+		marshal: (*passhash.Credential).MarshalWerkzeug,
+		kdf:     passhash.Pbkdf2Sha256,
+	},
+	"werkzeug pbkdf2:sha512": {
+		hash: "pbkdf2:sha512:1000$ExWM4Hm7b7wHbFqD$fc241da416705c53ee4cb69dfd6bdbbe9e7795f353f918b6e3a3137f9dda965e" +
+			"acd41d36b073e3f05cf6fbf2c156a91b307c881553a2bf6fdc9fd6ecfab9db23",
+		parse:   passhash.ParseWerkzeug,
+		marshal: (*passhash.Credential).MarshalWerkzeug,
+		kdf:     passhash.Pbkdf2Sha512,
+	},
+	"werkzeug scrypt": {
+		hash: "scrypt:1024:8:1$ExWM4Hm7b7wHbFqD$960d594233531ec12cb0bac8a1194221a0787a6173c66e52279cd3bffc8db580" +
+			"8530301f91a469a17ae4cae5db09bcf48f9429b54ebbb85092a1895029898e1b",
+		parse:   passhash.ParseWerkzeug,
+		marshal: (*passhash.Credential).MarshalWerkzeug,
+		kdf:     passhash.Scrypt,
+	},
+	"aspnet identity v2": {
+		hash:  "AAABAgMEBQYHCAkKCwwNDg+nCVraCHm10YQ9FexFJkzsYlVo9TTUEMj25vaor/+ERg==",
+		parse: passhash.ParseASPNetIdentity,
+		kdf:   passhash.Pbkdf2Sha1,
+	},
+	"aspnet identity v3 sha256": {
+		hash:    "AQAAAAEAACcQAAAAEAABAgMEBQYHCAkKCwwNDg+5n1FaFeK5/K6obxMkLTYve4e+2w0u+fyEc7KqCL9eTg==",
+		parse:   passhash.ParseASPNetIdentity,
+		marshal: (*passhash.Credential).MarshalASPNetIdentity,
+		kdf:     passhash.Pbkdf2Sha256,
+	},
+	"aspnet identity v3 sha512": {
+		hash:    "AQAAAAIAAAPoAAAAEAABAgMEBQYHCAkKCwwNDg92tIpTiSPyleWuzUIk15tIAEuWZRmYvWQl5H1Xd4eQHw==",
+		parse:   passhash.ParseASPNetIdentity,
+		marshal: (*passhash.Credential).MarshalASPNetIdentity,
+		kdf:     passhash.Pbkdf2Sha512,
+	},
+	"phpass": {
+		hash:  "$P$BsaltsaltVSeelx0XgBnieUY2wpXZ2.",
+		parse: passhash.ParsePhpass,
+		kdf:   passhash.Phpass,
+	},
+	"phpass (phpBB)": {
+		hash:  "$H$9abcdefgh6r2JwDGqIdkVr/hKZ6GA8/",
+		parse: passhash.ParsePhpass,
+		kdf:   passhash.Phpass,
+	},
+}
+
+func TestFrameworkHashes(t *testing.T) {
+	for name, test := range frameworkHashTests {
+		t.Run(name, func(t *testing.T) {
+			credential, err := test.parse(test.hash)
+			if err != nil {
+				t.Fatal("Unable to parse hash", err)
+			}
+			if credential.Kdf != test.kdf {
+				t.Errorf("Unexpected Kdf. %v != %v", credential.Kdf, test.kdf)
+			}
+			if test.marshal != nil {
+				encoded, err := test.marshal(credential)
+				if err != nil {
+					t.Fatal("Unable to marshal Credential", err)
+				}
+				if encoded != test.hash {
+					t.Errorf("Hash did not round trip. %q != %q", encoded, test.hash)
+				}
+			}
+			config := passhash.Config{Kdf: credential.Kdf, WorkFactor: credential.WorkFactor,
+				AuditLogger: &passhash.DummyAuditLogger{}, ExpertOverride: true}
+			if matched, _ := credential.MatchesPasswordWithConfig(config, testPassword+"extra"); matched {
+				t.Error("Wrong password matched imported Credential")
+			}
+			if matched, _ := credential.MatchesPasswordWithConfig(config, testPassword); !matched {
+				t.Error("Password did not match imported Credential")
+			}
+		})
+	}
+}
+
+func TestPhpassKnownHash(t *testing.T) {
+	// https://hashcat.net/wiki/doku.php?id=example_hashes
+	credential, err := passhash.ParsePhpass("$P$984478476IagS59wHZvyQMArzfx58u.")
+	if err != nil {
+		t.Fatal("Unable to parse phpass hash", err)
+	}
+	if matched, _ := credential.MatchesPasswordWithConfig(passhash.Config{AuditLogger: &passhash.DummyAuditLogger{},
+		ExpertOverride: true},
+		"hashcat"); !matched {
+		t.Error("Password did not match phpass Credential")
+	}
+}
+
+var frameworkRoundTripTests = map[string]struct {
+	config  passhash.Config
+	parse   func(string) (*passhash.Credential, error)
+	marshal func(*passhash.Credential) (string, error)
+}{
+	"django pbkdf2_sha256": {
+		config:  passhash.Config{Kdf: passhash.Pbkdf2Sha256, WorkFactor: &passhash.Pbkdf2WorkFactor{Iter: 1000}, KeyLength: 32},
+		parse:   passhash.ParseDjango,
+		marshal: (*passhash.Credential).MarshalDjango,
+	},
+	"django scrypt": {
+		config:  passhash.Config{Kdf: passhash.Scrypt, WorkFactor: &passhash.ScryptWorkFactor{N: 1024, R: 8, P: 1}, KeyLength: 64},
+		parse:   passhash.ParseDjango,
+		marshal: (*passhash.Credential).MarshalDjango,
+	},
+	"django argon2": {
+		config: passhash.Config{Kdf: passhash.Argon2id, WorkFactor: &passhash.Argon2WorkFactor{Time: 1, MemoryKiB: 64,
+			Threads: 1}, KeyLength: 32},
+		parse:   passhash.ParseDjango,
+		marshal: (*passhash.Credential).MarshalDjango,
+	},
+	"werkzeug pbkdf2:sha512": {
+		config:  passhash.Config{Kdf: passhash.Pbkdf2Sha512, WorkFactor: &passhash.Pbkdf2WorkFactor{Iter: 1000}, KeyLength: 64},
+		parse:   passhash.ParseWerkzeug,
+		marshal: (*passhash.Credential).MarshalWerkzeug,
+	},
+	"werkzeug scrypt": {
+		config:  passhash.Config{Kdf: passhash.Scrypt, WorkFactor: &passhash.ScryptWorkFactor{N: 1024, R: 8, P: 1}, KeyLength: 64},
+		parse:   passhash.ParseWerkzeug,
+		marshal: (*passhash.Credential).MarshalWerkzeug,
+	},
+	"aspnet identity": {
+		config:  passhash.Config{Kdf: passhash.Pbkdf2Sha256, WorkFactor: &passhash.Pbkdf2WorkFactor{Iter: 1000}, KeyLength: 32},
+		parse:   passhash.ParseASPNetIdentity,
+		marshal: (*passhash.Credential).MarshalASPNetIdentity,
+	},
+}
+
+func TestFrameworkRoundTrip(t *testing.T) {
+	for name, test := range frameworkRoundTripTests {
+		t.Run(name, func(t *testing.T) {
+			config := test.config
+			config.SaltSize = 16
+			config.TextSalt = true
+			config.ExpertOverride = true
+			config.AuditLogger = &passhash.DummyAuditLogger{}
+			credential, err := config.NewCredential(passhash.UserID(0), testPassword)
+			if err != nil {
+				t.Fatal("Unable to create new Credential", err)
+			}
+			encoded, err := test.marshal(credential)
+			if err != nil {
+				t.Fatal("Unable to marshal Credential", err)
+			}
+			parsed, err := test.parse(encoded)
+			if err != nil {
+				t.Fatalf("Unable to parse %q. %v", encoded, err)
+			}
+			if matched, updated := parsed.MatchesPasswordWithConfig(config, testPassword); !matched || updated {
+				t.Errorf("Parsed Credential did not match without update. matched: %v updated: %v", matched, updated)
+			}
+		})
+	}
+}
+
+func TestTextSalt(t *testing.T) {
+	config := passhash.Config{Kdf: passhash.Pbkdf2Sha256, WorkFactor: &passhash.Pbkdf2WorkFactor{Iter: 1},
+		SaltSize: 1024, KeyLength: 32, TextSalt: true, ExpertOverride: true}
+	credential, err := config.NewCredential(passhash.UserID(0), testPassword)
+	if err != nil {
+		t.Fatal("Unable to create new Credential", err)
+	}
+	for _, b := range credential.Salt {
+		if !('0' <= b && b <= '9' || 'A' <= b && b <= 'Z' || 'a' <= b && b <= 'z') {
+			t.Fatalf("Text salt contains non-alphanumeric byte: %q", b)
+		}
+	}
+}
+
+func TestMarshalFrameworkBinarySaltError(t *testing.T) {
+	credential := passhash.Credential{Kdf: passhash.Pbkdf2Sha256, WorkFactor: &passhash.Pbkdf2WorkFactor{Iter: 1},
+		Salt: []byte{0, '$', 0xff}, Hash: []byte("hash")}
+	if _, err := credential.MarshalDjango(); err == nil {
+		t.Error("Marshaled binary salt as a Django hash")
+	}
+	if _, err := credential.MarshalWerkzeug(); err == nil {
+		t.Error("Marshaled binary salt as a Werkzeug hash")
+	}
+}
+
+func TestMarshalFrameworkUnsupportedKdfError(t *testing.T) {
+	credential := passhash.Credential{Kdf: passhash.Bcrypt, WorkFactor: &passhash.BcryptWorkFactor{Cost: 4},
+		Salt: []byte("salt"), Hash: []byte("hash")}
+	if _, err := credential.MarshalDjango(); err == nil {
+		t.Error("Marshaled bcrypt Credential as a Django hash")
+	}
+	if _, err := credential.MarshalWerkzeug(); err == nil {
+		t.Error("Marshaled bcrypt Credential as a Werkzeug hash")
+	}
+	if _, err := credential.MarshalASPNetIdentity(); err == nil {
+		t.Error("Marshaled bcrypt Credential as an ASP.NET Identity hash")
+	}
+}
+
+func TestParseFrameworkHashError(t *testing.T) {
+	invalid := map[string][]string{
+		"django": {
+			"",
+			"md5$salt$hash",
+			"pbkdf2_sha256$x$salt$aGFzaA==",
+			"pbkdf2_sha256$1000$$aGFzaA==",
+			"pbkdf2_sha256$1000$salt$!!!",
+			"pbkdf2_sha256$1000$salt",
+			"scrypt$1024$salt$8$aGFzaA==",
+			"argon2$argon2id$m=64,t=1,p=1$c2FsdA$aGFzaA",
+		},
+		"werkzeug": {
+			"",
+			"pbkdf2:sha256$salt$00",
+			"pbkdf2:md5:1000$salt$00",
+			"pbkdf2:sha256:0$salt$00",
+			"pbkdf2:sha256:1000$salt$zz",
+			"pbkdf2:sha256:1000$$00",
+			"scrypt:1024:8$salt$00",
+			"plain$salt$00",
+		},
+		"aspnet": {
+			"",
+			"!!!",
+			"AA==",
+			"AgAAAA==",
+			"AQAAAAEAACcQAAAAEA==",
+			"AQAAAAMAACcQAAAAEAABAgMEBQYHCAkKCwwNDg+5n1FaFeK5/K6obxMkLTYve4e+2w0u+fyEc7KqCL9eTg==",
+		},
+		"phpass": {
+			"",
+			"$P$984478476IagS59wHZvyQMArzfx58u",
+			"$X$984478476IagS59wHZvyQMArzfx58u.",
+			"$P$.84478476IagS59wHZvyQMArzfx58u.",
+			"$P$984478476IagS59wHZvyQMArzfx58u!",
+		},
+	}
+	parsers := map[string]func(string) (*passhash.Credential, error){
+		"django":   passhash.ParseDjango,
+		"werkzeug": passhash.ParseWerkzeug,
+		"aspnet":   passhash.ParseASPNetIdentity,
+		"phpass":   passhash.ParsePhpass,
+	}
+	for name, hashes := range invalid {
+		for _, hash := range hashes {
+			if _, err := parsers[name](hash); err == nil {
+				t.Errorf("Parsed invalid %s hash: %q", name, hash)
+			}
+		}
+	}
+}
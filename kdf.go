@@ -0,0 +1,218 @@
+package passhash
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"hash"
+	"math"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/crypto/sha3"
+)
+
+// KdfImplementation implements a Kdf. Custom Kdfs may be added using RegisterKdf
+type KdfImplementation interface {
+	// Hash derives a key (e.g. hash) of keyLength bytes from the password
+	Hash(workFactor WorkFactor, salt []byte, keyLength int, password string) ([]byte, error)
+	// Verify determines if the password matches the previously derived hash
+	Verify(workFactor WorkFactor, salt, hash []byte, password string) (bool, error)
+	// NewWorkFactor returns an empty new WorkFactor for the Kdf
+	NewWorkFactor() WorkFactor
+	// CloneWorkFactor returns an independent copy of the provided WorkFactor
+	CloneWorkFactor(WorkFactor) (WorkFactor, error)
+}
+
+var (
+	kdfsMu sync.RWMutex
+	kdfs   = map[Kdf]KdfImplementation{
+		Pbkdf2Sha256:   pbkdf2Kdf{hashFunc: crypto.SHA256.New},
+		Pbkdf2Sha512:   pbkdf2Kdf{hashFunc: crypto.SHA512.New},
+		Pbkdf2Sha3_256: pbkdf2Kdf{hashFunc: sha3.New256},
+		Pbkdf2Sha3_512: pbkdf2Kdf{hashFunc: sha3.New512},
+		Bcrypt:         bcryptKdf{},
+		Scrypt:         scryptKdf{},
+		Argon2id:       argon2Kdf{id: true},
+		Argon2i:        argon2Kdf{id: false},
+		Md5Crypt:       md5CryptKdf{},
+		Sha256Crypt:    shaCryptKdf{hashFunc: sha256.New, permutation: sha256CryptPermutation},
+		Sha512Crypt:    shaCryptKdf{hashFunc: sha512.New, permutation: sha512CryptPermutation},
+		LdapSsha:       sshaKdf{},
+		Pbkdf2Sha1:     pbkdf2Sha1Kdf{},
+		Phpass:         phpassKdf{},
+	}
+)
+
+// RegisterKdf makes a Kdf implementation available to passhash.
+// If RegisterKdf is called twice with the same Kdf or if impl is nil, it panics.
+// Custom Kdfs should use values well beyond the Kdfs provided by passhash to avoid future collisions.
+func RegisterKdf(kdf Kdf, impl KdfImplementation) {
+	kdfsMu.Lock()
+	defer kdfsMu.Unlock()
+	if impl == nil {
+		panic("passhash: RegisterKdf implementation is nil")
+	}
+	if _, dup := kdfs[kdf]; dup {
+		panic(fmt.Sprintf("passhash: RegisterKdf called twice for kdf %v", kdf))
+	}
+	kdfs[kdf] = impl
+}
+
+// getKdf returns the registered implementation for the given kdf
+func getKdf(kdf Kdf) (KdfImplementation, error) {
+	kdfsMu.RLock()
+	defer kdfsMu.RUnlock()
+	impl, ok := kdfs[kdf]
+	if !ok {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedKdf, kdf)
+	}
+	return impl, nil
+}
+
+// verifyOnly is implemented by Kdfs that may only be used to verify existing credentials
+type verifyOnly interface {
+	verifyOnly()
+}
+
+// verifyByHashing verifies the password by re-deriving the hash and comparing it in constant time
+func verifyByHashing(impl KdfImplementation, workFactor WorkFactor, salt, hash []byte, password string) (bool, error) {
+	newHash, err := impl.Hash(workFactor, salt, len(hash), password)
+	if err != nil {
+		return false, err
+	}
+	return subtle.ConstantTimeCompare(hash, newHash) == 1, nil
+}
+
+type pbkdf2Kdf struct {
+	hashFunc func() hash.Hash
+}
+
+func (k pbkdf2Kdf) Hash(workFactor WorkFactor, salt []byte, keyLength int, password string) ([]byte, error) {
+	wf, ok := workFactor.(*Pbkdf2WorkFactor)
+	if !ok {
+		return []byte{}, errors.New("Pbkdf2WorkFactor can only be specified with the Pbkdf2 Kdf")
+	}
+	return pbkdf2.Key([]byte(password), salt, wf.Iter, keyLength, k.hashFunc), nil
+}
+
+func (k pbkdf2Kdf) Verify(workFactor WorkFactor, salt, hash []byte, password string) (bool, error) {
+	return verifyByHashing(k, workFactor, salt, hash, password)
+}
+
+func (k pbkdf2Kdf) NewWorkFactor() WorkFactor {
+	return &Pbkdf2WorkFactor{}
+}
+
+func (k pbkdf2Kdf) CloneWorkFactor(workFactor WorkFactor) (WorkFactor, error) {
+	wf, ok := workFactor.(*Pbkdf2WorkFactor)
+	if !ok {
+		return nil, fmt.Errorf("unsupported WorkFactor type: %T", workFactor)
+	}
+	c := *wf
+	return &c, nil
+}
+
+type bcryptKdf struct{}
+
+func (k bcryptKdf) Hash(workFactor WorkFactor, salt []byte, keyLength int, password string) ([]byte, error) {
+	wf, ok := workFactor.(*BcryptWorkFactor)
+	if !ok {
+		return []byte{}, errors.New("BcryptWorkFactor can only be specified with the Bcrypt Kdf")
+	}
+	// bcrypt generates its own salt and embeds it in the hash
+	return bcrypt.GenerateFromPassword([]byte(password), wf.Cost)
+}
+
+func (k bcryptKdf) Verify(workFactor WorkFactor, salt, hash []byte, password string) (bool, error) {
+	// Bcrypt's API compares the password and hash for you
+	err := bcrypt.CompareHashAndPassword(hash, []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (k bcryptKdf) NewWorkFactor() WorkFactor {
+	return &BcryptWorkFactor{}
+}
+
+func (k bcryptKdf) CloneWorkFactor(workFactor WorkFactor) (WorkFactor, error) {
+	wf, ok := workFactor.(*BcryptWorkFactor)
+	if !ok {
+		return nil, fmt.Errorf("unsupported WorkFactor type: %T", workFactor)
+	}
+	c := *wf
+	return &c, nil
+}
+
+type scryptKdf struct{}
+
+func (k scryptKdf) Hash(workFactor WorkFactor, salt []byte, keyLength int, password string) ([]byte, error) {
+	wf, ok := workFactor.(*ScryptWorkFactor)
+	if !ok {
+		return []byte{}, errors.New("ScryptWorkFactor can only be specified with the Scrypt Kdf")
+	}
+	return scrypt.Key([]byte(password), salt, wf.N, wf.R, wf.P, keyLength)
+}
+
+func (k scryptKdf) Verify(workFactor WorkFactor, salt, hash []byte, password string) (bool, error) {
+	return verifyByHashing(k, workFactor, salt, hash, password)
+}
+
+func (k scryptKdf) NewWorkFactor() WorkFactor {
+	return &ScryptWorkFactor{}
+}
+
+func (k scryptKdf) CloneWorkFactor(workFactor WorkFactor) (WorkFactor, error) {
+	wf, ok := workFactor.(*ScryptWorkFactor)
+	if !ok {
+		return nil, fmt.Errorf("unsupported WorkFactor type: %T", workFactor)
+	}
+	c := *wf
+	return &c, nil
+}
+
+type argon2Kdf struct {
+	id bool // Argon2id if true, Argon2i otherwise
+}
+
+func (k argon2Kdf) Hash(workFactor WorkFactor, salt []byte, keyLength int, password string) ([]byte, error) {
+	wf, ok := workFactor.(*Argon2WorkFactor)
+	if !ok {
+		return []byte{}, errors.New("Argon2WorkFactor can only be specified with the Argon2 Kdfs")
+	}
+	if wf.Time < 1 || int64(wf.Time) > math.MaxUint32 || wf.MemoryKiB < 1 || int64(wf.MemoryKiB) > math.MaxUint32 ||
+		wf.Threads < 1 || wf.Threads > math.MaxUint8 || keyLength < 1 || int64(keyLength) > math.MaxUint32 {
+		return []byte{}, fmt.Errorf("Invalid Argon2WorkFactor (%+v) or key length (%d)", *wf, keyLength)
+	}
+	if k.id {
+		return argon2.IDKey([]byte(password), salt, uint32(wf.Time), uint32(wf.MemoryKiB), uint8(wf.Threads),
+			uint32(keyLength)), nil
+	}
+	return argon2.Key([]byte(password), salt, uint32(wf.Time), uint32(wf.MemoryKiB), uint8(wf.Threads),
+		uint32(keyLength)), nil
+}
+
+func (k argon2Kdf) Verify(workFactor WorkFactor, salt, hash []byte, password string) (bool, error) {
+	return verifyByHashing(k, workFactor, salt, hash, password)
+}
+
+func (k argon2Kdf) NewWorkFactor() WorkFactor {
+	return &Argon2WorkFactor{}
+}
+
+func (k argon2Kdf) CloneWorkFactor(workFactor WorkFactor) (WorkFactor, error) {
+	wf, ok := workFactor.(*Argon2WorkFactor)
+	if !ok {
+		return nil, fmt.Errorf("unsupported WorkFactor type: %T", workFactor)
+	}
+	c := *wf
+	return &c, nil
+}
@@ -0,0 +1,107 @@
+package passhash_test
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/dhui/passhash"
+)
+
+const testCustomKdf = passhash.Kdf(1000)
+
+// sha256Kdf is an (insecure) custom Kdf used to test the Kdf registry
+type sha256Kdf struct{}
+
+func (k sha256Kdf) Hash(workFactor passhash.WorkFactor, salt []byte, keyLength int, password string) ([]byte, error) {
+	wf, ok := workFactor.(*passhash.Pbkdf2WorkFactor)
+	if !ok {
+		return nil, fmt.Errorf("unsupported WorkFactor type: %T", workFactor)
+	}
+	hash := make([]byte, 0, len(salt)+len(password))
+	hash = append(append(hash, salt...), password...)
+	for i := 0; i < wf.Iter; i++ {
+		sum := sha256.Sum256(hash)
+		hash = sum[:]
+	}
+	if keyLength > len(hash) {
+		return nil, errors.New("key length too long")
+	}
+	return hash[:keyLength], nil
+}
+
+func (k sha256Kdf) Verify(workFactor passhash.WorkFactor, salt, hash []byte, password string) (bool, error) {
+	newHash, err := k.Hash(workFactor, salt, len(hash), password)
+	if err != nil {
+		return false, err
+	}
+	return subtle.ConstantTimeCompare(hash, newHash) == 1, nil
+}
+
+func (k sha256Kdf) NewWorkFactor() passhash.WorkFactor {
+	return &passhash.Pbkdf2WorkFactor{}
+}
+
+func (k sha256Kdf) CloneWorkFactor(workFactor passhash.WorkFactor) (passhash.WorkFactor, error) {
+	wf, ok := workFactor.(*passhash.Pbkdf2WorkFactor)
+	if !ok {
+		return nil, fmt.Errorf("unsupported WorkFactor type: %T", workFactor)
+	}
+	c := *wf
+	return &c, nil
+}
+
+func init() {
+	passhash.RegisterKdf(testCustomKdf, sha256Kdf{})
+}
+
+func expectPanic(t *testing.T, f func()) {
+	t.Helper()
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("Expected panic")
+		}
+	}()
+	f()
+}
+
+func TestRegisterKdfCustom(t *testing.T) {
+	config := passhash.Config{Kdf: testCustomKdf, WorkFactor: &passhash.Pbkdf2WorkFactor{Iter: 10}, SaltSize: 16,
+		KeyLength: 32, AuditLogger: &passhash.DummyAuditLogger{}, Store: passhash.DummyCredentialStore{}}
+	credential, err := config.NewCredential(passhash.UserID(0), testPassword)
+	if err != nil {
+		t.Fatal("Unable to create new Credential with custom Kdf", err)
+	}
+	if matched, _ := credential.MatchesPasswordWithConfig(config, testPassword); !matched {
+		t.Error("Password did not match Credential for custom Kdf")
+	}
+	if matched, _ := credential.MatchesPasswordWithConfig(config, testPassword+"extra"); matched {
+		t.Error("Password matched Credential for custom Kdf")
+	}
+	wf, err := passhash.NewWorkFactorForKdf(testCustomKdf)
+	if err != nil {
+		t.Error("Got error getting WorkFactor for custom Kdf", err)
+	}
+	if _, ok := wf.(*passhash.Pbkdf2WorkFactor); !ok {
+		t.Errorf("Unexpected WorkFactor type for custom Kdf: %T", wf)
+	}
+}
+
+func TestRegisterKdfDuplicate(t *testing.T) {
+	expectPanic(t, func() { passhash.RegisterKdf(passhash.Scrypt, sha256Kdf{}) })
+	expectPanic(t, func() { passhash.RegisterKdf(testCustomKdf, sha256Kdf{}) })
+}
+
+func TestRegisterKdfNil(t *testing.T) {
+	expectPanic(t, func() { passhash.RegisterKdf(passhash.Kdf(1001), nil) })
+}
+
+func TestMatchesPasswordMalformedBcryptHash(t *testing.T) {
+	credential := passhash.Credential{Kdf: passhash.Bcrypt, WorkFactor: &passhash.BcryptWorkFactor{Cost: 4},
+		Hash: []byte("not a bcrypt hash")}
+	if matched, _ := credential.MatchesPassword(testPassword); matched {
+		t.Error("Malformed bcrypt hash matched password")
+	}
+}
@@ -0,0 +1,387 @@
+package passhash
+
+import (
+	"bytes"
+	"crypto/md5"  // nolint: gosec
+	"crypto/sha1" // nolint: gosec
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Legacy Kdfs are verify only. Their Credentials store the salt and the encoded hash as found in the original hash
+// string so that they may be verified without re-encoding. LdapSsha Credentials store the raw salt and digest.
+
+const (
+	cryptB64Alphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+	md5CryptPrefix    = "$1$"
+	md5CryptRounds    = 1000
+	md5CryptMaxSalt   = 8
+	sha256CryptPrefix = "$5$"
+	sha512CryptPrefix = "$6$"
+	shaCryptRoundsKey = "rounds="
+	shaCryptRounds    = 5000
+	shaCryptMinRounds = 1000
+	shaCryptMaxRounds = 999999999
+	shaCryptMaxSalt   = 16
+	sshaPrefix        = "{SSHA}"
+
+	phpassSaltLen       = 8
+	phpassHashLen       = 22
+	phpassMinLog2Rounds = 7
+	phpassMaxLog2Rounds = 30
+)
+
+// cryptB64 encodes the 24 bit value w as n characters using the crypt(3) base64 alphabet
+func cryptB64(buf *strings.Builder, w uint, n int) {
+	for ; n > 0; n-- {
+		buf.WriteByte(cryptB64Alphabet[w&0x3f])
+		w >>= 6
+	}
+}
+
+// cryptPermutation describes how the digest bytes are grouped and ordered when encoded by crypt(3).
+// Each group is encoded as a 24 bit value (first byte most significant) using n characters
+type cryptPermutation []struct {
+	indices [3]int // -1 is a zero byte
+	n       int
+}
+
+func (p cryptPermutation) encode(digest []byte) string {
+	var buf strings.Builder
+	for _, group := range p {
+		var w uint
+		for _, i := range group.indices {
+			w <<= 8
+			if i >= 0 {
+				w |= uint(digest[i])
+			}
+		}
+		cryptB64(&buf, w, group.n)
+	}
+	return buf.String()
+}
+
+var md5CryptPermutation = cryptPermutation{
+	{[3]int{0, 6, 12}, 4}, {[3]int{1, 7, 13}, 4}, {[3]int{2, 8, 14}, 4}, {[3]int{3, 9, 15}, 4},
+	{[3]int{4, 10, 5}, 4}, {[3]int{-1, -1, 11}, 2},
+}
+
+var sha256CryptPermutation = cryptPermutation{
+	{[3]int{0, 10, 20}, 4}, {[3]int{21, 1, 11}, 4}, {[3]int{12, 22, 2}, 4}, {[3]int{3, 13, 23}, 4},
+	{[3]int{24, 4, 14}, 4}, {[3]int{15, 25, 5}, 4}, {[3]int{6, 16, 26}, 4}, {[3]int{27, 7, 17}, 4},
+	{[3]int{18, 28, 8}, 4}, {[3]int{9, 19, 29}, 4}, {[3]int{-1, 31, 30}, 3},
+}
+
+var sha512CryptPermutation = cryptPermutation{
+	{[3]int{0, 21, 42}, 4}, {[3]int{22, 43, 1}, 4}, {[3]int{44, 2, 23}, 4}, {[3]int{3, 24, 45}, 4},
+	{[3]int{25, 46, 4}, 4}, {[3]int{47, 5, 26}, 4}, {[3]int{6, 27, 48}, 4}, {[3]int{28, 49, 7}, 4},
+	{[3]int{50, 8, 29}, 4}, {[3]int{9, 30, 51}, 4}, {[3]int{31, 52, 10}, 4}, {[3]int{53, 11, 32}, 4},
+	{[3]int{12, 33, 54}, 4}, {[3]int{34, 55, 13}, 4}, {[3]int{56, 14, 35}, 4}, {[3]int{15, 36, 57}, 4},
+	{[3]int{37, 58, 16}, 4}, {[3]int{59, 17, 38}, 4}, {[3]int{18, 39, 60}, 4}, {[3]int{40, 61, 19}, 4},
+	{[3]int{62, 20, 41}, 4}, {[3]int{-1, -1, 63}, 2},
+}
+
+// md5Crypt implements the MD5-crypt algorithm by Poul-Henning Kamp
+func md5Crypt(password, salt []byte) string {
+	alt := md5.New() // nolint: gosec
+	alt.Write(password)
+	alt.Write(salt)
+	alt.Write(password)
+	altSum := alt.Sum(nil)
+
+	ctx := md5.New() // nolint: gosec
+	ctx.Write(password)
+	ctx.Write([]byte(md5CryptPrefix))
+	ctx.Write(salt)
+	for pl := len(password); pl > 0; pl -= md5.Size {
+		ctx.Write(altSum[:min(pl, md5.Size)])
+	}
+	for i := len(password); i > 0; i >>= 1 {
+		if i&1 == 1 {
+			ctx.Write([]byte{0})
+		} else {
+			ctx.Write(password[:1])
+		}
+	}
+	final := ctx.Sum(nil)
+
+	for i := 0; i < md5CryptRounds; i++ {
+		ctx = md5.New() // nolint: gosec
+		if i&1 == 1 {
+			ctx.Write(password)
+		} else {
+			ctx.Write(final)
+		}
+		if i%3 != 0 {
+			ctx.Write(salt)
+		}
+		if i%7 != 0 {
+			ctx.Write(password)
+		}
+		if i&1 == 1 {
+			ctx.Write(final)
+		} else {
+			ctx.Write(password)
+		}
+		final = ctx.Sum(nil)
+	}
+	return md5CryptPermutation.encode(final)
+}
+
+// phpass implements the portable phpass algorithm by Solar Designer
+// https://www.openwall.com/phpass/
+func phpass(password, salt []byte, rounds int) string {
+	h := md5.New() // nolint: gosec
+	h.Write(salt)
+	h.Write(password)
+	sum := h.Sum(nil)
+	for i := 0; i < rounds; i++ {
+		h = md5.New() // nolint: gosec
+		h.Write(sum)
+		h.Write(password)
+		sum = h.Sum(nil)
+	}
+	// phpass encodes little endian 24 bit groups, unlike crypt(3)
+	var buf strings.Builder
+	for i := 0; i < len(sum); i += 3 {
+		var w uint
+		n := min(3, len(sum)-i)
+		for j := n - 1; j >= 0; j-- {
+			w = w<<8 | uint(sum[i+j])
+		}
+		cryptB64(&buf, w, n+1)
+	}
+	return buf.String()
+}
+
+// repeatTo returns the digest repeated (and truncated) to n bytes
+func repeatTo(digest []byte, n int) []byte {
+	return bytes.Repeat(digest, n/len(digest)+1)[:n]
+}
+
+// shaCrypt implements the SHA-crypt algorithm by Ulrich Drepper
+// https://www.akkadia.org/drepper/SHA-crypt.txt
+func shaCrypt(hashFunc func() hash.Hash, permutation cryptPermutation, password, salt []byte, rounds int) string {
+	b := hashFunc()
+	b.Write(password)
+	b.Write(salt)
+	b.Write(password)
+	bSum := b.Sum(nil)
+
+	a := hashFunc()
+	a.Write(password)
+	a.Write(salt)
+	a.Write(repeatTo(bSum, len(password)))
+	for i := len(password); i > 0; i >>= 1 {
+		if i&1 == 1 {
+			a.Write(bSum)
+		} else {
+			a.Write(password)
+		}
+	}
+	aSum := a.Sum(nil)
+
+	dp := hashFunc()
+	for i := 0; i < len(password); i++ {
+		dp.Write(password)
+	}
+	p := repeatTo(dp.Sum(nil), len(password))
+
+	ds := hashFunc()
+	for i := 0; i < 16+int(aSum[0]); i++ {
+		ds.Write(salt)
+	}
+	s := repeatTo(ds.Sum(nil), len(salt))
+
+	for i := 0; i < rounds; i++ {
+		c := hashFunc()
+		if i&1 == 1 {
+			c.Write(p)
+		} else {
+			c.Write(aSum)
+		}
+		if i%3 != 0 {
+			c.Write(s)
+		}
+		if i%7 != 0 {
+			c.Write(p)
+		}
+		if i&1 == 1 {
+			c.Write(aSum)
+		} else {
+			c.Write(p)
+		}
+		aSum = c.Sum(nil)
+	}
+	return permutation.encode(aSum)
+}
+
+// verifyOnlyKdf implements the KdfImplementation methods shared by the legacy (verify only) Kdfs
+type verifyOnlyKdf struct{}
+
+func (k verifyOnlyKdf) verifyOnly() {}
+
+func (k verifyOnlyKdf) Hash(WorkFactor, []byte, int, string) ([]byte, error) {
+	return []byte{}, ErrVerifyOnlyKdf
+}
+
+func (k verifyOnlyKdf) NewWorkFactor() WorkFactor {
+	return &LegacyWorkFactor{}
+}
+
+func (k verifyOnlyKdf) CloneWorkFactor(workFactor WorkFactor) (WorkFactor, error) {
+	wf, ok := workFactor.(*LegacyWorkFactor)
+	if !ok {
+		return nil, fmt.Errorf("unsupported WorkFactor type: %T", workFactor)
+	}
+	c := *wf
+	return &c, nil
+}
+
+type md5CryptKdf struct {
+	verifyOnlyKdf
+}
+
+func (k md5CryptKdf) Verify(workFactor WorkFactor, salt, hash []byte, password string) (bool, error) {
+	return subtle.ConstantTimeCompare(hash, []byte(md5Crypt([]byte(password), salt))) == 1, nil
+}
+
+type shaCryptKdf struct {
+	verifyOnlyKdf
+	hashFunc    func() hash.Hash
+	permutation cryptPermutation
+}
+
+func (k shaCryptKdf) Verify(workFactor WorkFactor, salt, hash []byte, password string) (bool, error) {
+	wf, ok := workFactor.(*LegacyWorkFactor)
+	if !ok {
+		return false, fmt.Errorf("unsupported WorkFactor type: %T", workFactor)
+	}
+	if wf.Rounds < shaCryptMinRounds || wf.Rounds > shaCryptMaxRounds {
+		return false, fmt.Errorf("Invalid SHA-crypt rounds: %d", wf.Rounds)
+	}
+	computed := shaCrypt(k.hashFunc, k.permutation, []byte(password), salt, wf.Rounds)
+	return subtle.ConstantTimeCompare(hash, []byte(computed)) == 1, nil
+}
+
+type sshaKdf struct {
+	verifyOnlyKdf
+}
+
+func (k sshaKdf) Verify(workFactor WorkFactor, salt, hash []byte, password string) (bool, error) {
+	h := sha1.New() // nolint: gosec
+	h.Write([]byte(password))
+	h.Write(salt)
+	return subtle.ConstantTimeCompare(hash, h.Sum(nil)) == 1, nil
+}
+
+type pbkdf2Sha1Kdf struct {
+	verifyOnlyKdf
+}
+
+func (k pbkdf2Sha1Kdf) Verify(workFactor WorkFactor, salt, hash []byte, password string) (bool, error) {
+	wf, ok := workFactor.(*Pbkdf2WorkFactor)
+	if !ok {
+		return false, fmt.Errorf("unsupported WorkFactor type: %T", workFactor)
+	}
+	computed := pbkdf2.Key([]byte(password), salt, wf.Iter, len(hash), sha1.New)
+	return subtle.ConstantTimeCompare(hash, computed) == 1, nil
+}
+
+func (k pbkdf2Sha1Kdf) NewWorkFactor() WorkFactor {
+	return &Pbkdf2WorkFactor{}
+}
+
+func (k pbkdf2Sha1Kdf) CloneWorkFactor(workFactor WorkFactor) (WorkFactor, error) {
+	return pbkdf2Kdf{}.CloneWorkFactor(workFactor)
+}
+
+type phpassKdf struct {
+	verifyOnlyKdf
+}
+
+func (k phpassKdf) Verify(workFactor WorkFactor, salt, hash []byte, password string) (bool, error) {
+	wf, ok := workFactor.(*LegacyWorkFactor)
+	if !ok {
+		return false, fmt.Errorf("unsupported WorkFactor type: %T", workFactor)
+	}
+	if wf.Rounds < 1<<phpassMinLog2Rounds || wf.Rounds > 1<<phpassMaxLog2Rounds {
+		return false, fmt.Errorf("Invalid phpass rounds: %d", wf.Rounds)
+	}
+	return subtle.ConstantTimeCompare(hash, []byte(phpass([]byte(password), salt, wf.Rounds))) == 1, nil
+}
+
+// isCryptB64 determines if s only contains characters from the crypt(3) base64 alphabet
+func isCryptB64(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if strings.IndexByte(cryptB64Alphabet, s[i]) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseLegacyHash imports a legacy hash from another system so that it may be verified once and then upgraded using the
+// MatchesPassword methods. The supported formats are:
+//   - MD5-crypt: $1$<salt>$<hash>
+//   - SHA-256-crypt: $5$[rounds=<rounds>$]<salt>$<hash>
+//   - SHA-512-crypt: $6$[rounds=<rounds>$]<salt>$<hash>
+//   - LDAP salted SHA-1: {SSHA}<base64 digest and salt>
+//
+// The UserID of the returned Credential is not set.
+func ParseLegacyHash(s string) (*Credential, error) {
+	switch {
+	case strings.HasPrefix(s, md5CryptPrefix):
+		salt, hash, ok := strings.Cut(strings.TrimPrefix(s, md5CryptPrefix), "$")
+		if !ok || len(salt) > md5CryptMaxSalt || strings.Contains(hash, "$") || len(hash) != 22 ||
+			!isCryptB64(hash) {
+			return nil, fmt.Errorf("Invalid MD5-crypt hash: %q", s)
+		}
+		return &Credential{Kdf: Md5Crypt, WorkFactor: &LegacyWorkFactor{Rounds: md5CryptRounds}, Salt: []byte(salt),
+			Hash: []byte(hash)}, nil
+	case strings.HasPrefix(s, sha256CryptPrefix):
+		return parseShaCrypt(s, Sha256Crypt, sha256CryptPrefix, 43)
+	case strings.HasPrefix(s, sha512CryptPrefix):
+		return parseShaCrypt(s, Sha512Crypt, sha512CryptPrefix, 86)
+	case strings.HasPrefix(s, sshaPrefix):
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(s, sshaPrefix))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid {SSHA} hash: %w", err)
+		}
+		if len(decoded) <= sha1.Size {
+			return nil, fmt.Errorf("Invalid {SSHA} hash: %q", s)
+		}
+		return &Credential{Kdf: LdapSsha, WorkFactor: &LegacyWorkFactor{Rounds: 1}, Salt: decoded[sha1.Size:],
+			Hash: decoded[:sha1.Size]}, nil
+	default:
+		return nil, fmt.Errorf("Unsupported legacy hash: %q", s)
+	}
+}
+
+func parseShaCrypt(s string, kdf Kdf, prefix string, hashLen int) (*Credential, error) {
+	rest := strings.TrimPrefix(s, prefix)
+	rounds := shaCryptRounds
+	if strings.HasPrefix(rest, shaCryptRoundsKey) {
+		var roundsStr string
+		roundsStr, rest, _ = strings.Cut(strings.TrimPrefix(rest, shaCryptRoundsKey), "$")
+		var err error
+		if rounds, err = strconv.Atoi(roundsStr); err != nil {
+			return nil, fmt.Errorf("Invalid SHA-crypt rounds: %q", s)
+		}
+		// Out of range rounds are clamped as done by the reference implementation
+		rounds = max(shaCryptMinRounds, min(rounds, shaCryptMaxRounds))
+	}
+	salt, hash, ok := strings.Cut(rest, "$")
+	if !ok || len(salt) > shaCryptMaxSalt || strings.Contains(hash, "$") || len(hash) != hashLen || !isCryptB64(hash) {
+		return nil, fmt.Errorf("Invalid SHA-crypt hash: %q", s)
+	}
+	return &Credential{Kdf: kdf, WorkFactor: &LegacyWorkFactor{Rounds: rounds}, Salt: []byte(salt),
+		Hash: []byte(hash)}, nil
+}
@@ -0,0 +1,138 @@
+package passhash_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/dhui/passhash"
+)
+
+// Legacy hashes of testPassword generated by glibc/libxcrypt crypt(3) and Python
+var parseLegacyHashTests = map[string]struct {
+	hash   string
+	kdf    passhash.Kdf
+	rounds int
+}{
+	"md5-crypt": {
+		hash: "$1$saltsalt$juQFLm9fXX.cHr2V4K.1v0",
+		kdf:  passhash.Md5Crypt, rounds: 1000,
+	},
+	"sha256-crypt": {
+		hash: "$5$saltstring$uOyYDMSburqlhLal4ltTMKA3khx1L0IBNh5Xq6Fs950",
+		kdf:  passhash.Sha256Crypt, rounds: 5000,
+	},
+	"sha256-crypt with rounds": {
+		hash: "$5$rounds=10000$saltstringsaltst$zQrW1zVrpqFFsJZjlt6sckg..oRL.fDfm1UN97VibQ5",
+		kdf:  passhash.Sha256Crypt, rounds: 10000,
+	},
+	"sha512-crypt": {
+		hash: "$6$saltstring$DkIeWL/1nNeEajjblX6rNCbv/WV94ZwdjDMDIcWM7TNSL2QNv/ditX.OGA2kHQ9nw7J9H7xa7NDguP9joqGmf/",
+		kdf:  passhash.Sha512Crypt, rounds: 5000,
+	},
+	"sha512-crypt with rounds": {
+		hash: "$6$rounds=1000$short$UfXcFRSkKaZjoPfpXHO/Xcbuskc9O0obkmj/ty7MPho6ATq6NFamH4n8YoaFZJhHBr6VynsM4vhmSQ7UzoIrB.",
+		kdf:  passhash.Sha512Crypt, rounds: 1000,
+	},
+	"ldap ssha": {
+		hash: "{SSHA}IwJuInkkuPBbEMcjvgticCN45uUBAgME",
+		kdf:  passhash.LdapSsha, rounds: 1,
+	},
+}
+
+func TestParseLegacyHash(t *testing.T) {
+	for name, test := range parseLegacyHashTests {
+		t.Run(name, func(t *testing.T) {
+			credential, err := passhash.ParseLegacyHash(test.hash)
+			if err != nil {
+				t.Fatal("Unable to parse legacy hash", err)
+			}
+			if credential.Kdf != test.kdf {
+				t.Errorf("Unexpected Kdf. %v != %v", credential.Kdf, test.kdf)
+			}
+			if rounds := credential.WorkFactor.(*passhash.LegacyWorkFactor).Rounds; rounds != test.rounds {
+				t.Errorf("Unexpected rounds. %d != %d", rounds, test.rounds)
+			}
+			if matched, updated := credential.MatchesPassword(testPassword + "extra"); matched || updated {
+				t.Error("Wrong password matched legacy Credential")
+			}
+			matched, updated := credential.MatchesPassword(testPassword)
+			if !matched {
+				t.Error("Password did not match legacy Credential")
+			}
+			if !updated {
+				t.Error("Legacy Credential was not upgraded")
+			}
+			if !credential.MeetsConfig(passhash.DefaultConfig) {
+				t.Error("Legacy Credential was not upgraded to the DefaultConfig")
+			}
+		})
+	}
+}
+
+func TestParseLegacyHashEmptyPassword(t *testing.T) {
+	hashes := []string{
+		"$1$abc$Or2rbeUYTvt12aiVzMuS/.",
+		"$6$rounds=1000$short$Ocl6K/qPAcDqPeFvc9A.3r9CpINjXCDnNaLAGbHGaUfW/VAnUhMnVHLP9fLC0f.gFxi5W6DCYe3HkDMICsYY21",
+	}
+	for _, hash := range hashes {
+		credential, err := passhash.ParseLegacyHash(hash)
+		if err != nil {
+			t.Fatal("Unable to parse legacy hash", err)
+		}
+		if matched, _ := credential.MatchesPassword(""); !matched {
+			t.Errorf("Empty password did not match legacy Credential: %q", hash)
+		}
+	}
+}
+
+func TestParseLegacyHashUpgradesShortPassword(t *testing.T) {
+	// md5-crypt of "shortpw", which is shorter than the DefaultConfig's AtLeastNRunes policy
+	credential, err := passhash.ParseLegacyHash("$1$abcdefgh$EJNBOqBpycQFRSFPUFOSs.")
+	if err != nil {
+		t.Fatal("Unable to parse legacy hash", err)
+	}
+	result, err := credential.Verify(context.Background(), passhash.DefaultConfig, "shortpw")
+	if err != nil {
+		t.Fatal("Unable to verify password", err)
+	}
+	if !result.Matched || !result.Upgraded || !credential.MeetsConfig(passhash.DefaultConfig) {
+		t.Errorf("Legacy Credential not upgraded. %+v", result)
+	}
+	var policiesErr passhash.PasswordPoliciesNotMet
+	if !errors.As(result.PolicyError, &policiesErr) {
+		t.Error("Expected PolicyError for a password that fails the DefaultConfig's PasswordPolicies. Got:",
+			result.PolicyError)
+	}
+}
+
+func TestParseLegacyHashError(t *testing.T) {
+	invalid := []string{
+		"",
+		"$2b$04$abcdefghijklmnopqrstuucsXoFOD.1GGErI5sPVse9jaGvqroysS",
+		"$1$saltsalt",
+		"$1$saltsaltsalt$juQFLm9fXX.cHr2V4K.1v0",
+		"$1$saltsalt$juQFLm9fXX.cHr2V4K.1v",
+		"$1$saltsalt$juQFLm9fXX.cHr2V4K.1v!",
+		"$5$rounds=x$saltstring$uOyYDMSburqlhLal4ltTMKA3khx1L0IBNh5Xq6Fs950",
+		"$5$saltstring$uOyYDMSburqlhLal4ltTMKA3khx1L0IBNh5Xq6Fs95",
+		"$6$saltstring$extra$DkIeWL/1nNeEajjblX6rNCbv/WV94ZwdjDMDIcWM7TNSL2QNv/ditX.OGA2kHQ9nw7J9H7xa7NDguP9joqGmf/",
+		"{SSHA}!!!",
+		"{SSHA}IwJuInkkuPBbEMcjvgticCN45uU=",
+	}
+	for _, hash := range invalid {
+		if _, err := passhash.ParseLegacyHash(hash); err == nil {
+			t.Errorf("Parsed invalid legacy hash: %q", hash)
+		}
+	}
+}
+
+func TestLegacyKdfCannotCreateCredentials(t *testing.T) {
+	for _, kdf := range []passhash.Kdf{passhash.Md5Crypt, passhash.Sha256Crypt, passhash.Sha512Crypt, passhash.LdapSsha} {
+		config := passhash.Config{Kdf: kdf, WorkFactor: &passhash.LegacyWorkFactor{Rounds: 5000}, SaltSize: 16,
+			KeyLength: 32, AuditLogger: &passhash.DummyAuditLogger{}}
+		if _, err := config.NewCredential(passhash.UserID(0), testPassword); !errors.Is(err, passhash.ErrVerifyOnlyKdf) {
+			t.Errorf("Expected ErrVerifyOnlyKdf creating a Credential with Kdf %v. Got: %v", kdf, err)
+		}
+	}
+}
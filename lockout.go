@@ -0,0 +1,150 @@
+package passhash
+
+import (
+	"context"
+	"math/bits"
+	"net"
+	"time"
+)
+
+const (
+	defaultLockoutWindow   = 15 * time.Minute
+	defaultLockoutDuration = 15 * time.Minute
+	maxLockoutLevels       = 32
+)
+
+// LockoutPolicy throttles brute-force attacks by locking a user's account after too many failed authentication
+// attempts. The policy is driven by the AuthnFailed, AuthnSucceeded, and AccountLocked logs returned by the Config's
+// AuditLogger, so the AuditLogger must support LastNWithTypes (e.g. not the DummyAuditLogger) and be shared by every
+// process authenticating the user.
+// Once MaxFailures attempts have failed within the Window, AccountLocked is logged and attempts are rejected with an
+// AccountLockedError before any password is hashed. Rejected attempts aren't logged. Each consecutive lockout doubles
+// the lockout duration, up to MaxLockoutDuration, until the user successfully authenticates.
+// Only failures due to a wrong password or an unknown user count towards a lockout, so that e.g. a CredentialStore
+// outage doesn't lock out every user. AuditLoggers that don't record the Reason of a log (see Log.Reason) count every
+// AuthnFailed log.
+type LockoutPolicy struct {
+	MaxFailures        int              // The number of failures within the Window that lock the account. 0 disables
+	Window             time.Duration    // The sliding window in which failures are counted. Defaults to 15 minutes
+	LockoutDuration    time.Duration    // The duration of the first lockout. Defaults to 15 minutes
+	MaxLockoutDuration time.Duration    // The maximum duration of consecutive lockouts. Defaults to LockoutDuration
+	ResetOnSuccess     bool             // Don't count failures before a successful authentication
+	Now                func() time.Time // Returns the current time. Defaults to time.Now
+}
+
+func (p *LockoutPolicy) now() time.Time {
+	if p.Now == nil {
+		return time.Now()
+	}
+	return p.Now()
+}
+
+func (p *LockoutPolicy) window() time.Duration {
+	if p.Window <= 0 {
+		return defaultLockoutWindow
+	}
+	return p.Window
+}
+
+// baseLockoutDuration returns the duration of the first lockout
+func (p *LockoutPolicy) baseLockoutDuration() time.Duration {
+	if p.LockoutDuration <= 0 {
+		return defaultLockoutDuration
+	}
+	return p.LockoutDuration
+}
+
+// lockoutDuration returns the duration of the level-th consecutive lockout
+func (p *LockoutPolicy) lockoutDuration(level int) time.Duration {
+	duration := p.baseLockoutDuration()
+	maxDuration := max(p.MaxLockoutDuration, duration)
+	for i := 1; i < level && duration < maxDuration; i++ {
+		duration *= 2
+	}
+	return min(duration, maxDuration)
+}
+
+// historyLimit returns the number of logs needed to determine the lockout state
+func (p *LockoutPolicy) historyLimit() int {
+	levels := 1
+	if base := p.baseLockoutDuration(); p.MaxLockoutDuration > base {
+		levels = min(bits.Len64(uint64(p.MaxLockoutDuration/base))+1, maxLockoutLevels)
+	}
+	return (p.MaxFailures + 1) * (levels + 1)
+}
+
+type lockoutState struct {
+	failures    int       // The number of failures counting towards the next lockout
+	level       int       // The number of consecutive lockouts
+	lockedUntil time.Time // The end of the latest lockout
+}
+
+func (p *LockoutPolicy) state(al AuditLogger, userID UserID, now time.Time) lockoutState {
+	var st lockoutState
+	var lockedAt time.Time
+	countFailures, succeeded := true, false
+	for _, log := range al.LastNWithTypes(userID, p.historyLimit(), AuthnFailed, AuthnSucceeded, AccountLocked) {
+		switch log.Type {
+		case AuthnSucceeded:
+			succeeded = true
+			countFailures = countFailures && !p.ResetOnSuccess
+		case AccountLocked:
+			countFailures = false
+			if !succeeded {
+				st.level++
+				if lockedAt.IsZero() {
+					lockedAt = log.Time
+				}
+			}
+		case AuthnFailed:
+			if countFailures && countsTowardsLockout(log.Reason) && now.Sub(log.Time) < p.window() {
+				st.failures++
+			}
+		}
+	}
+	if st.level > 0 {
+		st.lockedUntil = lockedAt.Add(p.lockoutDuration(st.level))
+	}
+	return st
+}
+
+// countsTowardsLockout determines if an AuthnFailed log with the reason counts towards a lockout. Failures caused by
+// the system (e.g. a CredentialStore or Kdf error) rather than the password don't count. Unknown reasons do
+func countsTowardsLockout(reason AuditReason) bool {
+	switch reason {
+	case "", ReasonWrongPassword, ReasonCredentialNotFound:
+		return true
+	}
+	return false
+}
+
+// Check returns an AccountLockedError if the user's account is locked according to the AuditLogger's logs
+func (p *LockoutPolicy) Check(al AuditLogger, userID UserID) error {
+	if p.MaxFailures <= 0 {
+		return nil
+	}
+	now := p.now()
+	if st := p.state(al, userID, now); now.Before(st.lockedUntil) {
+		return AccountLockedError{UserID: userID, RetryAfter: st.lockedUntil}
+	}
+	return nil
+}
+
+// checkLockout returns an AccountLockedError if the Config has a LockoutPolicy and the user's account is locked
+func (c Config) checkLockout(userID UserID) error {
+	if c.LockoutPolicy == nil || c.AuditLogger == nil {
+		return nil
+	}
+	return c.LockoutPolicy.Check(c.AuditLogger, userID)
+}
+
+// lockoutAfterFailure logs AccountLocked if the failure that was just logged locks the user's account
+func (c Config) lockoutAfterFailure(ctx context.Context, userID UserID, ip net.IP) {
+	p := c.LockoutPolicy
+	if p == nil || p.MaxFailures <= 0 || c.AuditLogger == nil {
+		return
+	}
+	if st := p.state(c.AuditLogger, userID, p.now()); st.failures >= p.MaxFailures {
+		c.auditLog(ctx, userID, AccountLocked, ip, ReasonTooManyFailures)
+	}
+}
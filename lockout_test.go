@@ -0,0 +1,214 @@
+package passhash_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dhui/passhash"
+)
+
+func setupLockoutTest(t *testing.T, policy passhash.LockoutPolicy) (*passhash.Credential, passhash.Config,
+	*fakeAuditLogger) {
+	t.Helper()
+	al := &fakeAuditLogger{fakeClock: newFakeClock()}
+	policy.Now = al.Now
+	config := countingKdfConfig(14)
+	config.AuditLogger = al
+	config.LockoutPolicy = &policy
+	credential, err := config.NewCredential(passhash.UserID(1), testPassword)
+	if err != nil {
+		t.Fatal("Unable to create credential", err)
+	}
+	return credential, config, al
+}
+
+func failLogins(t *testing.T, credential *passhash.Credential, config passhash.Config, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if result, err := credential.Verify(context.Background(), config, "wrong"); err != nil || result.Matched {
+			t.Fatalf("Unexpected login result %+v. Error: %v", result, err)
+		}
+	}
+}
+
+func expectLocked(t *testing.T, credential *passhash.Credential, config passhash.Config, retryAfter time.Time) {
+	t.Helper()
+	verifies := testCountingKdfImpl.verifies.Load()
+	_, err := credential.Verify(context.Background(), config, testPassword)
+	if !errors.Is(err, passhash.ErrAccountLocked) {
+		t.Fatal("Expected ErrAccountLocked. Got:", err)
+	}
+	var lockedErr passhash.AccountLockedError
+	if !errors.As(err, &lockedErr) || !lockedErr.RetryAfter.Equal(retryAfter) {
+		t.Errorf("Unexpected retry after. %v != %v", lockedErr.RetryAfter, retryAfter)
+	}
+	if n := testCountingKdfImpl.verifies.Load() - verifies; n != 0 {
+		t.Errorf("Locked account verified %d passwords", n)
+	}
+}
+
+func expectUnlocked(t *testing.T, credential *passhash.Credential, config passhash.Config) {
+	t.Helper()
+	if result, err := credential.Verify(context.Background(), config, testPassword); err != nil || !result.Matched {
+		t.Fatalf("Unexpected login result %+v. Error: %v", result, err)
+	}
+}
+
+func TestLockoutPolicyLocksAfterMaxFailures(t *testing.T) {
+	credential, config, al := setupLockoutTest(t, passhash.LockoutPolicy{MaxFailures: 3,
+		LockoutDuration: time.Minute})
+	failLogins(t, credential, config, 2)
+	if n := al.count(passhash.AccountLocked); n != 0 {
+		t.Fatalf("Locked after 2 failures. %d locks", n)
+	}
+	failLogins(t, credential, config, 1)
+	if n := al.count(passhash.AccountLocked); n != 1 {
+		t.Fatalf("Unexpected number of locks. %d != 1", n)
+	}
+	expectLocked(t, credential, config, al.now.Add(time.Minute))
+
+	al.now = al.now.Add(time.Minute)
+	expectUnlocked(t, credential, config)
+}
+
+func TestLockoutPolicyChangePasswordLocked(t *testing.T) {
+	credential, config, al := setupLockoutTest(t, passhash.LockoutPolicy{MaxFailures: 1})
+	failLogins(t, credential, config, 1)
+	err := credential.ChangePasswordWithConfigAndIP(config, testPassword, "new password", passhash.EmptyIP)
+	var lockedErr passhash.AccountLockedError
+	if !errors.As(err, &lockedErr) || !lockedErr.RetryAfter.Equal(al.now.Add(15*time.Minute)) {
+		t.Error("Expected AccountLockedError with the default lockout duration. Got:", err)
+	}
+}
+
+func TestLockoutPolicyWindow(t *testing.T) {
+	credential, config, al := setupLockoutTest(t, passhash.LockoutPolicy{MaxFailures: 2, Window: time.Minute})
+	failLogins(t, credential, config, 1)
+	al.now = al.now.Add(time.Minute)
+	failLogins(t, credential, config, 1)
+	if n := al.count(passhash.AccountLocked); n != 0 {
+		t.Fatalf("Failures outside of the window locked the account. %d locks", n)
+	}
+	failLogins(t, credential, config, 1)
+	if n := al.count(passhash.AccountLocked); n != 1 {
+		t.Fatalf("Unexpected number of locks. %d != 1", n)
+	}
+}
+
+func TestLockoutPolicyExponentialBackoff(t *testing.T) {
+	credential, config, al := setupLockoutTest(t, passhash.LockoutPolicy{MaxFailures: 2,
+		LockoutDuration: time.Minute, MaxLockoutDuration: 3 * time.Minute, ResetOnSuccess: true})
+	for _, duration := range []time.Duration{time.Minute, 2 * time.Minute, 3 * time.Minute, 3 * time.Minute} {
+		failLogins(t, credential, config, 2)
+		expectLocked(t, credential, config, al.now.Add(duration))
+		al.now = al.now.Add(duration)
+	}
+	expectUnlocked(t, credential, config)
+	failLogins(t, credential, config, 2)
+	expectLocked(t, credential, config, al.now.Add(time.Minute))
+}
+
+func TestLockoutPolicyExponentialBackoffDefaultDuration(t *testing.T) {
+	credential, config, al := setupLockoutTest(t, passhash.LockoutPolicy{MaxFailures: 2,
+		MaxLockoutDuration: 4 * time.Hour})
+	for _, duration := range []time.Duration{15 * time.Minute, 30 * time.Minute, time.Hour, 2 * time.Hour,
+		4 * time.Hour, 4 * time.Hour} {
+		failLogins(t, credential, config, 2)
+		expectLocked(t, credential, config, al.now.Add(duration))
+		al.now = al.now.Add(duration)
+	}
+}
+
+func TestLockoutPolicyResetOnSuccess(t *testing.T) {
+	for _, reset := range []bool{false, true} {
+		credential, config, al := setupLockoutTest(t, passhash.LockoutPolicy{MaxFailures: 2,
+			ResetOnSuccess: reset})
+		failLogins(t, credential, config, 1)
+		expectUnlocked(t, credential, config)
+		failLogins(t, credential, config, 1)
+		if n, expected := al.count(passhash.AccountLocked), map[bool]int{false: 1, true: 0}[reset]; n != expected {
+			t.Errorf("Unexpected number of locks with ResetOnSuccess: %v. %d != %d", reset, n, expected)
+		}
+	}
+}
+
+func TestLockoutPolicyDisabled(t *testing.T) {
+	credential, config, al := setupLockoutTest(t, passhash.LockoutPolicy{})
+	failLogins(t, credential, config, 10)
+	if n := al.count(passhash.AccountLocked); n != 0 {
+		t.Errorf("Disabled LockoutPolicy locked the account. %d locks", n)
+	}
+	expectUnlocked(t, credential, config)
+}
+
+func TestAuthenticatorLoginLocked(t *testing.T) {
+	al := &fakeAuditLogger{fakeClock: newFakeClock()}
+	config := countingKdfConfig(14)
+	config.AuditLogger = al
+	config.LockoutPolicy = &passhash.LockoutPolicy{MaxFailures: 2, Now: al.Now}
+	authenticator, err := passhash.NewAuthenticator(config)
+	if err != nil {
+		t.Fatal("Unable to create Authenticator", err)
+	}
+	ctx := context.Background()
+	for _, userID := range []passhash.UserID{1, 2} {
+		if userID == 1 {
+			if err := authenticator.Register(ctx, userID, testPassword); err != nil {
+				t.Fatal("Unable to register user", err)
+			}
+		}
+		for i := 0; i < 2; i++ {
+			if _, err := authenticator.Login(ctx, userID, "wrong", passhash.EmptyIP); errors.Is(err,
+				passhash.ErrAccountLocked) {
+				t.Fatalf("User %d locked after %d failures", userID, i)
+			}
+		}
+		// Unknown users are locked out just like known users so that lockouts don't reveal which users exist
+		if _, err := authenticator.Login(ctx, userID, testPassword, passhash.EmptyIP); !errors.Is(err,
+			passhash.ErrAccountLocked) {
+			t.Errorf("Expected ErrAccountLocked for user %d. Got: %v", userID, err)
+		}
+	}
+}
+
+func TestAuthenticatorLoginStoreErrorNotLocked(t *testing.T) {
+	al := &fakeAuditLogger{fakeClock: newFakeClock()}
+	store := newMemoryCredentialStore()
+	config := countingKdfConfig(14)
+	config.Store = store
+	config.AuditLogger = al
+	config.LockoutPolicy = &passhash.LockoutPolicy{MaxFailures: 2, Now: al.Now}
+	authenticator, err := passhash.NewAuthenticator(config)
+	if err != nil {
+		t.Fatal("Unable to create Authenticator", err)
+	}
+	ctx := context.Background()
+	if err := authenticator.Register(ctx, passhash.UserID(1), testPassword); err != nil {
+		t.Fatal("Unable to register user", err)
+	}
+	store.loadErr = errors.New("store unavailable")
+	for i := 0; i < 3; i++ {
+		var storeErr passhash.StoreError
+		if _, err := authenticator.Login(ctx, passhash.UserID(1), testPassword, passhash.EmptyIP); !errors.As(err,
+			&storeErr) {
+			t.Fatal("Expected StoreError. Got:", err)
+		}
+	}
+	if n := al.count(passhash.AccountLocked); n != 0 {
+		t.Fatalf("Store errors locked the account. %d locks", n)
+	}
+	store.loadErr = nil
+	if result, err := authenticator.Login(ctx, passhash.UserID(1), testPassword, passhash.EmptyIP); err != nil ||
+		!result.Matched {
+		t.Errorf("Unexpected login result %+v after the store recovered. Error: %v", result, err)
+	}
+	// Wrong passwords still lock the account
+	for i := 0; i < 2; i++ {
+		_, _ = authenticator.Login(ctx, passhash.UserID(1), "wrong", passhash.EmptyIP)
+	}
+	if n := al.count(passhash.AccountLocked); n != 1 {
+		t.Errorf("Unexpected number of locks. %d != 1", n)
+	}
+}
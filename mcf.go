@@ -0,0 +1,36 @@
+package passhash
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// bcryptPrefixes are the Modular Crypt Format prefixes of bcrypt hashes
+var bcryptPrefixes = []string{"$2a$", "$2b$", "$2y$"}
+
+// isBcryptHash determines if the string looks like a bcrypt hash in the Modular Crypt Format
+func isBcryptHash(s string) bool {
+	for _, prefix := range bcryptPrefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseBcrypt imports a bcrypt hash in the Modular Crypt Format (e.g. $2a$, $2b$, or $2y$) from another system.
+// The cost is extracted into the BcryptWorkFactor and the hash is stored as-is, so the returned Credential may be
+// verified and auto-upgraded using the MatchesPassword methods.
+// The UserID of the returned Credential is not set.
+func ParseBcrypt(hash string) (*Credential, error) {
+	if !isBcryptHash(hash) {
+		return nil, fmt.Errorf("Unsupported bcrypt hash prefix: %q", hash)
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid bcrypt hash: %w", err)
+	}
+	return &Credential{Kdf: Bcrypt, WorkFactor: &BcryptWorkFactor{Cost: cost}, Hash: []byte(hash)}, nil
+}
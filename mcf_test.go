@@ -0,0 +1,74 @@
+package passhash_test
+
+import (
+	"testing"
+
+	"github.com/dhui/passhash"
+)
+
+// bcrypt hashes of testPassword generated by libxcrypt
+var parseBcryptTests = map[string]struct {
+	hash string
+	cost int
+}{
+	"2b": {hash: "$2b$04$abcdefghijklmnopqrstuucsXoFOD.1GGErI5sPVse9jaGvqroysS", cost: 4},
+	"2y": {hash: "$2y$05$abcdefghijklmnopqrstuuchdlDj..Q5AhneqxzxAlJkC1o97jxTW", cost: 5},
+}
+
+func TestParseBcrypt(t *testing.T) {
+	for name, test := range parseBcryptTests {
+		t.Run(name, func(t *testing.T) {
+			credential, err := passhash.ParseBcrypt(test.hash)
+			if err != nil {
+				t.Fatal("Unable to parse bcrypt hash", err)
+			}
+			if credential.Kdf != passhash.Bcrypt {
+				t.Errorf("Unexpected Kdf: %v", credential.Kdf)
+			}
+			if cost := credential.WorkFactor.(*passhash.BcryptWorkFactor).Cost; cost != test.cost {
+				t.Errorf("Unexpected cost. %d != %d", cost, test.cost)
+			}
+			if matched, _ := credential.MatchesPasswordWithConfig(passhash.Config{Kdf: passhash.Bcrypt,
+				WorkFactor: &passhash.BcryptWorkFactor{Cost: test.cost}, AuditLogger: &passhash.DummyAuditLogger{},
+				ExpertOverride: true},
+				"wrongpassword"); matched {
+				t.Error("Wrong password matched imported bcrypt Credential")
+			}
+			matched, updated := credential.MatchesPassword(testPassword)
+			if !matched {
+				t.Error("Password did not match imported bcrypt Credential")
+			}
+			if !updated {
+				t.Error("Imported bcrypt Credential was not upgraded")
+			}
+			if !credential.MeetsConfig(passhash.DefaultConfig) {
+				t.Error("Imported bcrypt Credential was not upgraded to the DefaultConfig")
+			}
+		})
+	}
+}
+
+func TestParseBcryptError(t *testing.T) {
+	invalid := []string{
+		"",
+		"$2x$04$abcdefghijklmnopqrstuughE8Ev8uGFaUgY2cNEySvxngrb/Jzdm",
+		"$2b$",
+		"$2b$xx$abcdefghijklmnopqrstuughE8Ev8uGFaUgY2cNEySvxngrb/Jzdm",
+		"$scrypt$ln=10,r=8,p=1$c2FsdA$aGFzaA",
+	}
+	for _, hash := range invalid {
+		if _, err := passhash.ParseBcrypt(hash); err == nil {
+			t.Errorf("Parsed invalid bcrypt hash: %q", hash)
+		}
+	}
+}
+
+func TestParsePHCBcrypt(t *testing.T) {
+	credential, err := passhash.ParsePHC(parseBcryptTests["2b"].hash)
+	if err != nil {
+		t.Fatal("Unable to parse bcrypt hash", err)
+	}
+	if credential.Kdf != passhash.Bcrypt {
+		t.Errorf("Unexpected Kdf: %v", credential.Kdf)
+	}
+}
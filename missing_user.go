@@ -0,0 +1,73 @@
+package passhash
+
+import (
+	"fmt"
+	"sync"
+)
+
+// missingUserPassword is the password of the dummy Credentials used by VerifyMissingUser.
+// It doesn't need to be secret since the result of verifying a dummy Credential is always discarded.
+const missingUserPassword = "passhash missing user"
+
+// missingUserCredentials caches the dummy Credentials used by VerifyMissingUser by missingUserKey
+var missingUserCredentials sync.Map
+
+type missingUserKey struct {
+	kdf        Kdf
+	workFactor string
+	saltSize   int
+	keyLength  int
+	textSalt   bool
+}
+
+// VerifyMissingUser verifies the password against a dummy Credential using the Config's Kdf, WorkFactor, SaltSize,
+// and KeyLength, so that attempts to authenticate users that don't exist take as long as attempts using the wrong
+// password. This prevents attackers from enumerating users via timing. The dummy Credential is created once per set
+// of parameters and cached.
+func (c Config) VerifyMissingUser(password string) error {
+	credential, err := c.missingUserCredential()
+	if err != nil {
+		return err
+	}
+	return verifyMissingUser(credential, password)
+}
+
+// verifyMissingUser verifies the password against the dummy Credential, discarding the result
+func verifyMissingUser(credential *Credential, password string) error {
+	impl, err := getKdf(credential.Kdf)
+	if err != nil {
+		return err
+	}
+	_, err = impl.Verify(credential.WorkFactor, credential.Salt, credential.Hash, password)
+	return err
+}
+
+func (c Config) missingUserCredential() (*Credential, error) {
+	if c.WorkFactor == nil {
+		return nil, WorkFactorMismatchError{Kdf: c.Kdf, WorkFactor: c.WorkFactor}
+	}
+	params, err := c.WorkFactor.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	key := missingUserKey{kdf: c.Kdf, workFactor: fmt.Sprintf("%T%v", c.WorkFactor, params), saltSize: c.SaltSize,
+		keyLength: c.KeyLength, textSalt: c.TextSalt}
+	if credential, ok := missingUserCredentials.Load(key); ok {
+		return credential.(*Credential), nil
+	}
+	workFactor, err := cloneWorkFactor(c.Kdf, c.WorkFactor)
+	if err != nil {
+		return nil, err
+	}
+	salt, err := c.newSalt()
+	if err != nil {
+		return nil, err
+	}
+	hash, err := getPasswordHash(c.Kdf, workFactor, salt, c.KeyLength, missingUserPassword)
+	if err != nil {
+		return nil, err
+	}
+	credential, _ := missingUserCredentials.LoadOrStore(key, &Credential{Kdf: c.Kdf, WorkFactor: workFactor,
+		Salt: salt, Hash: hash})
+	return credential.(*Credential), nil
+}
@@ -0,0 +1,132 @@
+package passhash_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/dhui/passhash"
+)
+
+const testCountingKdf = passhash.Kdf(1002)
+
+// countingKdf is a sha256Kdf that counts the number of hashes and verifications
+type countingKdf struct {
+	sha256Kdf
+	hashes   *atomic.Int64
+	verifies *atomic.Int64
+}
+
+func (k countingKdf) Hash(workFactor passhash.WorkFactor, salt []byte, keyLength int, password string) ([]byte,
+	error) {
+	k.hashes.Add(1)
+	return k.sha256Kdf.Hash(workFactor, salt, keyLength, password)
+}
+
+func (k countingKdf) Verify(workFactor passhash.WorkFactor, salt, hash []byte, password string) (bool, error) {
+	k.verifies.Add(1)
+	return k.sha256Kdf.Verify(workFactor, salt, hash, password)
+}
+
+var testCountingKdfImpl = countingKdf{hashes: &atomic.Int64{}, verifies: &atomic.Int64{}}
+
+func init() {
+	passhash.RegisterKdf(testCountingKdf, testCountingKdfImpl)
+}
+
+func countingKdfConfig(iter int) passhash.Config {
+	return passhash.Config{Kdf: testCountingKdf, WorkFactor: &passhash.Pbkdf2WorkFactor{Iter: iter}, SaltSize: 16,
+		KeyLength: 32, AuditLogger: &passhash.DummyAuditLogger{}, Store: newMemoryCredentialStore()}
+}
+
+func TestVerifyMissingUserCachesDummyCredential(t *testing.T) {
+	config := countingKdfConfig(11)
+	hashes, verifies := testCountingKdfImpl.hashes.Load(), testCountingKdfImpl.verifies.Load()
+	for i := 0; i < 3; i++ {
+		if err := config.VerifyMissingUser(testPassword); err != nil {
+			t.Fatal("Unable to verify missing user", err)
+		}
+	}
+	if n := testCountingKdfImpl.hashes.Load() - hashes; n != 1 {
+		t.Errorf("Dummy credential not cached. Created %d dummy credentials", n)
+	}
+	if n := testCountingKdfImpl.verifies.Load() - verifies; n != 3 {
+		t.Errorf("Unexpected number of verifications. %d != 3", n)
+	}
+
+	config = countingKdfConfig(12)
+	if err := config.VerifyMissingUser(testPassword); err != nil {
+		t.Fatal("Unable to verify missing user", err)
+	}
+	if n := testCountingKdfImpl.hashes.Load() - hashes; n != 2 {
+		t.Errorf("Dummy credential reused for a different WorkFactor. Created %d dummy credentials", n)
+	}
+}
+
+func TestVerifyMissingUserErrors(t *testing.T) {
+	config := passhash.DefaultConfig
+	config.Kdf = passhash.Kdf(999999)
+	if err := config.VerifyMissingUser(testPassword); err == nil {
+		t.Error("Verified missing user with an unsupported Kdf")
+	}
+	config = passhash.DefaultConfig
+	config.WorkFactor = nil
+	var mismatchErr passhash.WorkFactorMismatchError
+	if err := config.VerifyMissingUser(testPassword); !errors.As(err, &mismatchErr) {
+		t.Error("Expected WorkFactorMismatchError. Got:", err)
+	}
+}
+
+func TestNewAuthenticatorCreatesDummyCredential(t *testing.T) {
+	hashes := testCountingKdfImpl.hashes.Load()
+	authenticator, err := passhash.NewAuthenticator(countingKdfConfig(16))
+	if err != nil {
+		t.Fatal("Unable to create Authenticator", err)
+	}
+	if n := testCountingKdfImpl.hashes.Load() - hashes; n != 1 {
+		t.Fatalf("Unexpected number of dummy credentials created by NewAuthenticator. %d != 1", n)
+	}
+	hashes, verifies := testCountingKdfImpl.hashes.Load(), testCountingKdfImpl.verifies.Load()
+	if _, err := authenticator.Login(context.Background(), passhash.UserID(1), testPassword,
+		passhash.EmptyIP); !errors.Is(err, passhash.ErrCredentialNotFound) {
+		t.Error("Expected ErrCredentialNotFound. Got:", err)
+	}
+	if n := testCountingKdfImpl.hashes.Load() - hashes; n != 0 {
+		t.Errorf("First login of an unknown user hashed %d passwords", n)
+	}
+	if n := testCountingKdfImpl.verifies.Load() - verifies; n != 1 {
+		t.Errorf("Unexpected number of verifications. %d != 1", n)
+	}
+}
+
+func TestAuthenticatorLoginUnknownUserVerifiesPassword(t *testing.T) {
+	ctx := context.Background()
+	authenticator, err := passhash.NewAuthenticator(countingKdfConfig(13))
+	if err != nil {
+		t.Fatal("Unable to create Authenticator", err)
+	}
+	userID := passhash.UserID(1)
+	if err := authenticator.Register(ctx, userID, testPassword); err != nil {
+		t.Fatal("Unable to register user", err)
+	}
+
+	verifies := testCountingKdfImpl.verifies.Load()
+	if _, err := authenticator.Login(ctx, userID, "wrong password", passhash.EmptyIP); !errors.Is(err,
+		passhash.ErrAuthenticationFailed) {
+		t.Error("Expected ErrAuthenticationFailed. Got:", err)
+	}
+	wrongPasswordVerifies := testCountingKdfImpl.verifies.Load() - verifies
+
+	verifies = testCountingKdfImpl.verifies.Load()
+	if _, err := authenticator.Login(ctx, passhash.UserID(2), "wrong password", passhash.EmptyIP); !errors.Is(err,
+		passhash.ErrCredentialNotFound) {
+		t.Error("Expected ErrCredentialNotFound. Got:", err)
+	}
+	unknownUserVerifies := testCountingKdfImpl.verifies.Load() - verifies
+
+	if wrongPasswordVerifies != 1 || unknownUserVerifies != wrongPasswordVerifies {
+		t.Errorf("Unknown user and wrong password logins don't do the same work. %d != %d", unknownUserVerifies,
+			wrongPasswordVerifies)
+	}
+}
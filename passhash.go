@@ -1,15 +1,5 @@
 package passhash
 
-import (
-	"crypto"
-	"errors"
-	"fmt"
-	"golang.org/x/crypto/bcrypt"
-	"golang.org/x/crypto/pbkdf2"
-	"golang.org/x/crypto/scrypt"
-	"golang.org/x/crypto/sha3"
-)
-
 // Kdf is a Key Derivation Function
 type Kdf uint
 
@@ -26,17 +16,40 @@ const (
 	Bcrypt
 	// Scrypt is the scrypt kdf
 	Scrypt
+	// Argon2id is the Argon2id kdf as recommended by RFC 9106
+	Argon2id
+	// Argon2i is the Argon2i kdf
+	Argon2i
+	// Md5Crypt is the legacy MD5-crypt ($1$) kdf. It may only be used to verify (and then upgrade) existing credentials
+	Md5Crypt
+	// Sha256Crypt is the legacy SHA-256-crypt ($5$) kdf. It may only be used to verify (and then upgrade) existing
+	// credentials
+	Sha256Crypt
+	// Sha512Crypt is the legacy SHA-512-crypt ($6$) kdf. It may only be used to verify (and then upgrade) existing
+	// credentials
+	Sha512Crypt
+	// LdapSsha is the legacy LDAP salted SHA-1 ({SSHA}) kdf. It may only be used to verify (and then upgrade) existing
+	// credentials
+	LdapSsha
+	// Pbkdf2Sha1 is the legacy PBKDF2 using SHA-1 as the HMAC (e.g. ASP.NET Identity v2). It may only be used to verify
+	// (and then upgrade) existing credentials
+	Pbkdf2Sha1
+	// Phpass is the legacy phpass ($P$ and $H$) kdf used by WordPress and others. It may only be used to verify (and
+	// then upgrade) existing credentials
+	Phpass
 )
 
 // DefaultWorkFactor provides the default WorkFactor for a specific Kdf. Do not modify unless you're an expert.
 // Note: DefaultWorkFactor returns a pointer so do not use Unmarshal w/ a WorkFactor from DefaultWorkFactor.
 // Use NewWorkFactorForKdf() instead.
-// TODO: Determine/tune DefaultWorkFactor (aim for 150+ms hash time on API server hardware)
+// Use Calibrate to tune a WorkFactor for your hardware (aim for 150+ms hash time on API server hardware)
 var DefaultWorkFactor = map[Kdf]WorkFactor{
-	Pbkdf2Sha256:   &Pbkdf2WorkFactor{Iter: 100000},
-	Pbkdf2Sha512:   &Pbkdf2WorkFactor{Iter: 100000},
-	Pbkdf2Sha3_256: &Pbkdf2WorkFactor{Iter: 100000},
-	Pbkdf2Sha3_512: &Pbkdf2WorkFactor{Iter: 100000},
+	// PBKDF2 - OWASP recommends 600000 iterations for HMAC-SHA-256 and 210000 iterations for HMAC-SHA-512
+	// https://cheatsheetseries.owasp.org/cheatsheets/Password_Storage_Cheat_Sheet.html#pbkdf2
+	Pbkdf2Sha256:   &Pbkdf2WorkFactor{Iter: 600000},
+	Pbkdf2Sha512:   &Pbkdf2WorkFactor{Iter: 210000},
+	Pbkdf2Sha3_256: &Pbkdf2WorkFactor{Iter: 600000},
+	Pbkdf2Sha3_512: &Pbkdf2WorkFactor{Iter: 210000},
 	Bcrypt:         &BcryptWorkFactor{Cost: 12}, // bcrypt.DefaultCost is 10 as of 2017-07-26
 
 	// Scrypt - n >= 16384, p = 1, r = 16 (output length = 32)
@@ -44,30 +57,67 @@ var DefaultWorkFactor = map[Kdf]WorkFactor{
 	// https://download.libsodium.org/doc/password_hashing/scrypt.html
 	// Scrypt: ScryptWorkFactor{N: 65536, R: 16, P: 1},
 	Scrypt: &ScryptWorkFactor{N: 32768, R: 16, P: 1},
+
+	// Argon2 - RFC 9106 second recommended option: t = 3, m = 64 MiB, p = 4
+	// https://www.rfc-editor.org/rfc/rfc9106.html#name-parameter-choice
+	Argon2id: &Argon2WorkFactor{Time: 3, MemoryKiB: 64 * 1024, Threads: 4},
+	Argon2i:  &Argon2WorkFactor{Time: 3, MemoryKiB: 64 * 1024, Threads: 4},
 }
 
 // NewWorkFactorForKdf returns an empty new WorkFactor for the given kdf
 func NewWorkFactorForKdf(kdf Kdf) (WorkFactor, error) {
-	switch kdf {
-	case Pbkdf2Sha256, Pbkdf2Sha512, Pbkdf2Sha3_256, Pbkdf2Sha3_512:
-		return &Pbkdf2WorkFactor{}, nil
-	case Bcrypt:
-		return &BcryptWorkFactor{}, nil
-	case Scrypt:
-		return &ScryptWorkFactor{}, nil
-	default:
-		return nil, fmt.Errorf("Unsupported kdf: %v", kdf)
+	impl, err := getKdf(kdf)
+	if err != nil {
+		return nil, err
+	}
+	return impl.NewWorkFactor(), nil
+}
+
+// DefaultSecurityFloors are the minimum parameters accepted by Config.Validate. Do not lower unless you're an expert.
+// The PBKDF2, bcrypt, and Argon2id floors, including Argon2id's equivalent settings, are the OWASP Password Storage
+// Cheat Sheet minimums. The SHA-3 PBKDF2 floors match the SHA-2 floors and the Argon2i floors match Argon2id's.
+// The scrypt floor is below OWASP's minimum (N = 2^17, r = 8, p = 1) so that DefaultWorkFactor[Scrypt] is accepted.
+// https://cheatsheetseries.owasp.org/cheatsheets/Password_Storage_Cheat_Sheet.html
+var DefaultSecurityFloors = SecurityFloors{
+	SaltSize:  16,
+	KeyLength: 16,
+	WorkFactor: map[Kdf]WorkFactor{
+		Pbkdf2Sha256:   &Pbkdf2WorkFactor{Iter: 600000},
+		Pbkdf2Sha512:   &Pbkdf2WorkFactor{Iter: 210000},
+		Pbkdf2Sha3_256: &Pbkdf2WorkFactor{Iter: 600000},
+		Pbkdf2Sha3_512: &Pbkdf2WorkFactor{Iter: 210000},
+		Bcrypt:         &BcryptWorkFactor{Cost: 10},
+		Scrypt:         &ScryptWorkFactor{N: 16384, R: 8, P: 1},
+		Argon2id:       &Argon2WorkFactor{Time: 2, MemoryKiB: 19456, Threads: 1},
+		Argon2i:        &Argon2WorkFactor{Time: 2, MemoryKiB: 19456, Threads: 1},
+	},
+	EquivalentWorkFactors: map[Kdf][]WorkFactor{
+		Argon2id: owaspArgon2Equivalents(),
+		Argon2i:  owaspArgon2Equivalents(),
+	},
+}
+
+// owaspArgon2Equivalents returns OWASP's Argon2id settings that trade memory for time
+func owaspArgon2Equivalents() []WorkFactor {
+	return []WorkFactor{
+		&Argon2WorkFactor{Time: 1, MemoryKiB: 47104, Threads: 1},
+		&Argon2WorkFactor{Time: 3, MemoryKiB: 12288, Threads: 1},
+		&Argon2WorkFactor{Time: 4, MemoryKiB: 9216, Threads: 1},
+		&Argon2WorkFactor{Time: 5, MemoryKiB: 7168, Threads: 1},
 	}
 }
 
-// DefaultConfig is a safe default configuration for managing credentials
+// DefaultConfig is a safe default configuration for managing credentials.
+// To make Argon2id the default (and auto-upgrade existing credentials to it via MatchesPassword), set the Kdf and
+// WorkFactor in init(). e.g. DefaultConfig.Kdf = Argon2id; DefaultConfig.WorkFactor = DefaultWorkFactor[Argon2id]
 var DefaultConfig = Config{
-	Kdf:         Scrypt,
-	WorkFactor:  DefaultWorkFactor[Scrypt],
-	SaltSize:    16,
-	KeyLength:   32,
-	AuditLogger: &DummyAuditLogger{},    // It is recommended that you replace the dummy AuditLogger to actually audit your credentials
-	Store:       DummyCredentialStore{}, // It is recommended that you replace the dummy CredentialStore to actually store credentials
+	Kdf:           Scrypt,
+	WorkFactor:    DefaultWorkFactor[Scrypt],
+	SaltSize:      16,
+	KeyLength:     32,
+	AuditLogger:   &DummyAuditLogger{},    // It is recommended that you replace the dummy AuditLogger to actually audit your credentials
+	Store:         DummyCredentialStore{}, // It is recommended that you replace the dummy CredentialStore to actually store credentials
+	UpgradePolicy: UpgradeIfWeaker,
 	PasswordPolicies: []PasswordPolicy{
 		AtLeastNRunes{N: 10},
 	},
@@ -80,31 +130,9 @@ func NewCredential(userID UserID, password string) (*Credential, error) {
 
 func getPasswordHash(kdf Kdf, workFactor WorkFactor, salt []byte, keyLength int, password string) ([]byte, error) {
 	// NB: Do not hash the password before running it through a KDF. Instead, rely on Go's libraries to provide the proper security
-	switch wf := workFactor.(type) {
-	case *Pbkdf2WorkFactor:
-		switch kdf {
-		case Pbkdf2Sha256:
-			return pbkdf2.Key([]byte(password), salt, wf.Iter, keyLength, crypto.SHA256.New), nil
-		case Pbkdf2Sha512:
-			return pbkdf2.Key([]byte(password), salt, wf.Iter, keyLength, crypto.SHA512.New), nil
-		case Pbkdf2Sha3_256:
-			return pbkdf2.Key([]byte(password), salt, wf.Iter, keyLength, sha3.New256), nil
-		case Pbkdf2Sha3_512:
-			return pbkdf2.Key([]byte(password), salt, wf.Iter, keyLength, sha3.New512), nil
-		default:
-			return []byte{}, errors.New("Pbkdf2WorkFactor can only be specified with the Pbkdf2 Kdf")
-		}
-	case *BcryptWorkFactor:
-		if kdf != Bcrypt {
-			return []byte{}, errors.New("BcryptWorkFactor can only be specified with the Bcrypt Kdf")
-		}
-		return bcrypt.GenerateFromPassword([]byte(password), wf.Cost)
-	case *ScryptWorkFactor:
-		if kdf != Scrypt {
-			return []byte{}, errors.New("ScryptWorkFactor can only be specified with the Scrypt Kdf")
-		}
-		return scrypt.Key([]byte(password), salt, wf.N, wf.R, wf.P, keyLength)
-	default:
-		return []byte{}, fmt.Errorf("Unsupported WorkFactor: %T", wf)
+	impl, err := getKdf(kdf)
+	if err != nil {
+		return []byte{}, err
 	}
+	return impl.Hash(workFactor, salt, keyLength, password)
 }
@@ -1,7 +1,6 @@
 package passhash
 
 import (
-	"errors"
 	"fmt"
 	"unicode/utf8"
 )
@@ -33,7 +32,7 @@ type NotCommonPasswordNaive struct {
 // PasswordAcceptable accepts passwords that are not common passwords
 func (pp NotCommonPasswordNaive) PasswordAcceptable(password string) error {
 	if pp.CommonPasswords[password] {
-		return errors.New("Password is a common password")
+		return ErrCommonPassword
 	}
 	return nil
 }
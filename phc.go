@@ -0,0 +1,182 @@
+package passhash
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// argon2Version is the only Argon2 version supported by golang.org/x/crypto/argon2 (0x13)
+const argon2Version = 19
+
+// phcIDs maps Kdfs to their PHC string format identifiers
+// https://github.com/P-H-C/phc-string-format/blob/master/phc-sf-spec.md
+var phcIDs = map[Kdf]string{
+	Pbkdf2Sha256:   "pbkdf2-sha256",
+	Pbkdf2Sha512:   "pbkdf2-sha512",
+	Pbkdf2Sha3_256: "pbkdf2-sha3-256",
+	Pbkdf2Sha3_512: "pbkdf2-sha3-512",
+	Scrypt:         "scrypt",
+	Argon2id:       "argon2id",
+	Argon2i:        "argon2i",
+}
+
+// phcB64 is the base64 encoding used by the PHC string format. e.g. standard base64 without padding
+var phcB64 = base64.RawStdEncoding
+
+// MarshalPHC encodes the Credential using the PHC string format.
+// e.g. $scrypt$ln=15,r=16,p=1$<salt>$<hash> or $argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>
+// bcrypt Credentials already store their hash in the Modular Crypt Format, which is returned as-is.
+// The UserID is not encoded.
+func (c *Credential) MarshalPHC() (string, error) {
+	if c.Kdf == Bcrypt {
+		if len(c.Hash) == 0 {
+			return "", errors.New("bcrypt Credential has an empty hash")
+		}
+		return string(c.Hash), nil
+	}
+	id, ok := phcIDs[c.Kdf]
+	if !ok {
+		return "", fmt.Errorf("Kdf %v does not support the PHC string format", c.Kdf)
+	}
+	if _, err := cloneWorkFactor(c.Kdf, c.WorkFactor); err != nil {
+		return "", err // Kdf and WorkFactor mismatch
+	}
+	var params string
+	switch wf := c.WorkFactor.(type) {
+	case *Pbkdf2WorkFactor:
+		params = fmt.Sprintf("i=%d", wf.Iter)
+	case *ScryptWorkFactor:
+		if wf.N < 2 || wf.N&(wf.N-1) != 0 {
+			return "", fmt.Errorf("scrypt N must be a power of 2 greater than 1: %d", wf.N)
+		}
+		params = fmt.Sprintf("ln=%d,r=%d,p=%d", bits.TrailingZeros(uint(wf.N)), wf.R, wf.P)
+	case *Argon2WorkFactor:
+		params = fmt.Sprintf("v=%d$m=%d,t=%d,p=%d", argon2Version, wf.MemoryKiB, wf.Time, wf.Threads)
+	default:
+		return "", fmt.Errorf("Unsupported WorkFactor: %T", c.WorkFactor)
+	}
+	return fmt.Sprintf("$%s$%s$%s$%s", id, params, phcB64.EncodeToString(c.Salt), phcB64.EncodeToString(c.Hash)), nil
+}
+
+// ParsePHC decodes a Credential from a string in the PHC string format. See MarshalPHC for the supported formats.
+// bcrypt hashes in the Modular Crypt Format are parsed using ParseBcrypt.
+// The UserID of the returned Credential is not set.
+func ParsePHC(s string) (*Credential, error) {
+	if isBcryptHash(s) {
+		return ParseBcrypt(s)
+	}
+	fields := strings.Split(s, "$")
+	if len(fields) < 5 || fields[0] != "" {
+		return nil, fmt.Errorf("Invalid PHC string: %q", s)
+	}
+	kdf, ok := kdfForPHCID(fields[1])
+	if !ok {
+		return nil, fmt.Errorf("Unsupported PHC identifier: %q", fields[1])
+	}
+	fields = fields[2:]
+	hasVersion := strings.HasPrefix(fields[0], "v=")
+	if hasVersion {
+		if kdf != Argon2id && kdf != Argon2i {
+			return nil, fmt.Errorf("Unexpected version for PHC identifier %q", phcIDs[kdf])
+		}
+		if fields[0] != fmt.Sprintf("v=%d", argon2Version) {
+			return nil, fmt.Errorf("Unsupported Argon2 version: %q", fields[0])
+		}
+		fields = fields[1:]
+	}
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("Invalid PHC string: %q", s)
+	}
+	params, err := parsePHCParams(fields[0])
+	if err != nil {
+		return nil, err
+	}
+	var workFactor WorkFactor
+	switch kdf {
+	case Pbkdf2Sha256, Pbkdf2Sha512, Pbkdf2Sha3_256, Pbkdf2Sha3_512:
+		wf := &Pbkdf2WorkFactor{}
+		err = params.assign(map[string]*int{"i": &wf.Iter})
+		workFactor = wf
+	case Scrypt:
+		wf := &ScryptWorkFactor{}
+		var ln int
+		err = params.assign(map[string]*int{"ln": &ln, "r": &wf.R, "p": &wf.P})
+		if err == nil && (ln < 1 || ln >= bits.UintSize-1) {
+			err = fmt.Errorf("Invalid scrypt ln: %d", ln)
+		}
+		wf.N = 1 << uint(ln)
+		workFactor = wf
+	case Argon2id, Argon2i:
+		if !hasVersion {
+			return nil, errors.New("Argon2 PHC string is missing its version")
+		}
+		wf := &Argon2WorkFactor{}
+		err = params.assign(map[string]*int{"m": &wf.MemoryKiB, "t": &wf.Time, "p": &wf.Threads})
+		workFactor = wf
+	}
+	if err != nil {
+		return nil, err
+	}
+	salt, err := phcB64.DecodeString(fields[1])
+	if err != nil {
+		return nil, fmt.Errorf("Invalid PHC salt: %w", err)
+	}
+	hash, err := phcB64.DecodeString(fields[2])
+	if err != nil {
+		return nil, fmt.Errorf("Invalid PHC hash: %w", err)
+	}
+	if len(hash) == 0 {
+		return nil, errors.New("PHC string is missing its hash")
+	}
+	return &Credential{Kdf: kdf, WorkFactor: workFactor, Salt: salt, Hash: hash}, nil
+}
+
+func kdfForPHCID(id string) (Kdf, bool) {
+	for kdf, phcID := range phcIDs {
+		if phcID == id {
+			return kdf, true
+		}
+	}
+	return 0, false
+}
+
+// phcParams are the parsed name=value parameters of a PHC string
+type phcParams map[string]int
+
+func parsePHCParams(s string) (phcParams, error) {
+	params := phcParams{}
+	for _, param := range strings.Split(s, ",") {
+		name, value, ok := strings.Cut(param, "=")
+		if !ok {
+			return nil, fmt.Errorf("Invalid PHC parameter: %q", param)
+		}
+		if _, dup := params[name]; dup {
+			return nil, fmt.Errorf("Duplicate PHC parameter: %q", name)
+		}
+		i, err := strconv.Atoi(value)
+		if err != nil || i < 0 {
+			return nil, fmt.Errorf("Invalid PHC parameter value: %q", param)
+		}
+		params[name] = i
+	}
+	return params, nil
+}
+
+// assign sets the destinations to their parameter values. All parameters must be present and known
+func (p phcParams) assign(dsts map[string]*int) error {
+	if len(p) != len(dsts) {
+		return fmt.Errorf("Expected %d PHC parameters but got %d", len(dsts), len(p))
+	}
+	for name, dst := range dsts {
+		v, ok := p[name]
+		if !ok {
+			return fmt.Errorf("Missing PHC parameter: %q", name)
+		}
+		*dst = v
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package passhash_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/dhui/passhash"
+)
+
+var phcRoundTripConfigs = map[string]passhash.Config{
+	"pbkdf2-sha256":   {Kdf: passhash.Pbkdf2Sha256, WorkFactor: &passhash.Pbkdf2WorkFactor{Iter: 1000}},
+	"pbkdf2-sha512":   {Kdf: passhash.Pbkdf2Sha512, WorkFactor: &passhash.Pbkdf2WorkFactor{Iter: 1000}},
+	"pbkdf2-sha3-256": {Kdf: passhash.Pbkdf2Sha3_256, WorkFactor: &passhash.Pbkdf2WorkFactor{Iter: 1000}},
+	"pbkdf2-sha3-512": {Kdf: passhash.Pbkdf2Sha3_512, WorkFactor: &passhash.Pbkdf2WorkFactor{Iter: 1000}},
+	"scrypt":          {Kdf: passhash.Scrypt, WorkFactor: &passhash.ScryptWorkFactor{N: 1024, R: 8, P: 1}},
+	"argon2id":        {Kdf: passhash.Argon2id, WorkFactor: &passhash.Argon2WorkFactor{Time: 1, MemoryKiB: 64, Threads: 2}},
+	"argon2i":         {Kdf: passhash.Argon2i, WorkFactor: &passhash.Argon2WorkFactor{Time: 1, MemoryKiB: 64, Threads: 2}},
+	"bcrypt":          {Kdf: passhash.Bcrypt, WorkFactor: &passhash.BcryptWorkFactor{Cost: 4}},
+}
+
+func TestPHCRoundTrip(t *testing.T) {
+	for name, config := range phcRoundTripConfigs {
+		t.Run(name, func(t *testing.T) {
+			config.SaltSize = 16
+			config.KeyLength = 32
+			config.AuditLogger = &passhash.DummyAuditLogger{}
+			config.ExpertOverride = true
+			credential, err := config.NewCredential(passhash.UserID(0), testPassword)
+			if err != nil {
+				t.Fatal("Unable to create new Credential", err)
+			}
+			phc, err := credential.MarshalPHC()
+			if err != nil {
+				t.Fatal("Unable to marshal Credential", err)
+			}
+			parsed, err := passhash.ParsePHC(phc)
+			if err != nil {
+				t.Fatalf("Unable to parse PHC string %q. %v", phc, err)
+			}
+			if parsed.Kdf != credential.Kdf {
+				t.Errorf("Kdf changed. %v != %v", parsed.Kdf, credential.Kdf)
+			}
+			if !passhash.WorkFactorsEqual(parsed.WorkFactor, credential.WorkFactor) {
+				t.Errorf("WorkFactor changed. %v != %v", parsed.WorkFactor, credential.WorkFactor)
+			}
+			if !bytes.Equal(parsed.Hash, credential.Hash) || (name != "bcrypt" && !bytes.Equal(parsed.Salt, credential.Salt)) {
+				t.Error("Salt or hash changed")
+			}
+			if matched, _ := parsed.MatchesPasswordWithConfig(config, testPassword); !matched {
+				t.Error("Password did not match parsed Credential")
+			}
+		})
+	}
+}
+
+// Hashes generated by other implementations
+var phcInteropTests = map[string]struct {
+	phc      string
+	password string
+}{
+	"pbkdf2-sha256 (Python hashlib)": {
+		phc:      "$pbkdf2-sha256$i=1000$c2FsdHNhbHRzYWx0c2FsdA$8nX7hwFEzIB8aPajJTYK8weHQc5Ngz0pFVAKvSu4jQA",
+		password: "password",
+	},
+	"scrypt (Python hashlib)": {
+		phc:      "$scrypt$ln=10,r=8,p=1$c2FsdHNhbHRzYWx0c2FsdA$BVMRKqdiVYikKAaPR1wucsKUKvw4TuPLkdEYtoSHas4",
+		password: "password",
+	},
+	"argon2i (reference implementation)": {
+		phc:      "$argon2i$v=19$m=65536,t=2,p=4$c29tZXNhbHQ$RdescudvJCsgt3ub+b+dWRWJTmaaJObG",
+		password: "password",
+	},
+}
+
+func TestParsePHCInterop(t *testing.T) {
+	for name, test := range phcInteropTests {
+		t.Run(name, func(t *testing.T) {
+			credential, err := passhash.ParsePHC(test.phc)
+			if err != nil {
+				t.Fatal("Unable to parse PHC string", err)
+			}
+			config := passhash.Config{Kdf: credential.Kdf, WorkFactor: credential.WorkFactor,
+				AuditLogger: &passhash.DummyAuditLogger{}, ExpertOverride: true}
+			if matched, _ := credential.MatchesPasswordWithConfig(config, test.password); !matched {
+				t.Error("Password did not match parsed Credential")
+			}
+			if matched, _ := credential.MatchesPasswordWithConfig(config, test.password+"extra"); matched {
+				t.Error("Wrong password matched parsed Credential")
+			}
+			phc, err := credential.MarshalPHC()
+			if err != nil {
+				t.Fatal("Unable to marshal Credential", err)
+			}
+			if phc != test.phc {
+				t.Errorf("PHC string did not round trip. %q != %q", phc, test.phc)
+			}
+		})
+	}
+}
+
+func TestParsePHCError(t *testing.T) {
+	invalid := []string{
+		"",
+		"scrypt$ln=10,r=8,p=1$c2FsdA$aGFzaA",
+		"$unknown$i=1$c2FsdA$aGFzaA",
+		"$pbkdf2-sha256$i=1$c2FsdA",
+		"$pbkdf2-sha256$i=1$c2FsdA$",
+		"$pbkdf2-sha256$i=x$c2FsdA$aGFzaA",
+		"$pbkdf2-sha256$i=-1$c2FsdA$aGFzaA",
+		"$pbkdf2-sha256$iter=1$c2FsdA$aGFzaA",
+		"$pbkdf2-sha256$i=1,i=2$c2FsdA$aGFzaA",
+		"$pbkdf2-sha256$i=1,r=2$c2FsdA$aGFzaA",
+		"$pbkdf2-sha256$v=19$i=1$c2FsdA$aGFzaA",
+		"$pbkdf2-sha256$i=1$!!!$aGFzaA",
+		"$pbkdf2-sha256$i=1$c2FsdA$!!!",
+		"$scrypt$ln=0,r=8,p=1$c2FsdA$aGFzaA",
+		"$scrypt$ln=10,r=8$c2FsdA$aGFzaA",
+		"$argon2id$m=64,t=1,p=1$c2FsdA$aGFzaA",
+		"$argon2id$v=16$m=64,t=1,p=1$c2FsdA$aGFzaA",
+		"$argon2id$v=19$m=64,t=1,p=1$c2FsdA$aGFzaA$extra",
+	}
+	for _, s := range invalid {
+		if _, err := passhash.ParsePHC(s); err == nil {
+			t.Errorf("Parsed invalid PHC string: %q", s)
+		}
+	}
+}
+
+func TestMarshalPHCError(t *testing.T) {
+	invalid := []passhash.Credential{
+		{Kdf: passhash.Kdf(999999), WorkFactor: &passhash.Pbkdf2WorkFactor{Iter: 1}},
+		{Kdf: passhash.Scrypt, WorkFactor: &passhash.ScryptWorkFactor{N: 1000, R: 8, P: 1}},
+		{Kdf: passhash.Scrypt, WorkFactor: &passhash.Pbkdf2WorkFactor{Iter: 1}},
+		{Kdf: passhash.Bcrypt, WorkFactor: &passhash.BcryptWorkFactor{Cost: 4}},
+	}
+	for _, credential := range invalid {
+		if phc, err := credential.MarshalPHC(); err == nil {
+			t.Errorf("Marshaled invalid Credential: %q", phc)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package passhash
+
+import (
+	"bufio"
+	"crypto/sha1" // nolint: gosec
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultPwnedPasswordsURL is the base URL of the Have I Been Pwned Pwned Passwords API
+	DefaultPwnedPasswordsURL = "https://api.pwnedpasswords.com"
+
+	pwnedPasswordsPrefixLen        = 5
+	defaultPwnedPasswordsTimeout   = 5 * time.Second
+	defaultPwnedPasswordsCacheTTL  = time.Hour
+	defaultPwnedPasswordsCacheSize = 1000
+	maxPwnedPasswordsResponseBytes = 4 * 1024 * 1024
+)
+
+// NotPwnedPasswordOptions configures a NotPwnedPassword PasswordPolicy
+type NotPwnedPasswordOptions struct {
+	BaseURL   string       // The base URL of the Pwned Passwords API. Defaults to DefaultPwnedPasswordsURL
+	Client    *http.Client // The HTTP client. Defaults to a client with a 5 second timeout
+	UserAgent string       // The User-Agent sent to the API. Defaults to passhash
+	// Threshold is the number of times a password must have appeared in breaches to be rejected. Defaults to 1
+	Threshold int
+	// AddPadding requests padded responses so that response sizes don't reveal the hash prefix
+	AddPadding bool
+	// FailOpen accepts passwords when the API is unavailable. By default, passwords are rejected with an error wrapping
+	// ErrPwnedPasswordsUnavailable
+	FailOpen  bool
+	CacheTTL  time.Duration    // How long responses are cached. Defaults to 1 hour
+	CacheSize int              // The number of hash prefixes to cache. Defaults to 1000. Negative disables caching
+	Now       func() time.Time // Returns the current time, used to expire cached responses. Defaults to time.Now
+}
+
+type pwnedPasswordsCacheEntry struct {
+	counts  map[string]int
+	expires time.Time
+}
+
+// NotPwnedPassword is a PasswordPolicy that rejects passwords that have appeared in data breaches according to the
+// Have I Been Pwned Pwned Passwords API. Only the first 5 hex characters of the password's SHA-1 are sent to the API
+// (k-anonymity).
+// The PasswordPolicy interface doesn't accept a context, so requests are bounded by the Client's timeout
+type NotPwnedPassword struct {
+	opts  NotPwnedPasswordOptions
+	mu    sync.Mutex
+	cache map[string]pwnedPasswordsCacheEntry
+}
+
+// NewNotPwnedPassword creates a NotPwnedPassword PasswordPolicy
+func NewNotPwnedPassword(opts NotPwnedPasswordOptions) *NotPwnedPassword {
+	if opts.BaseURL == "" {
+		opts.BaseURL = DefaultPwnedPasswordsURL
+	}
+	opts.BaseURL = strings.TrimSuffix(opts.BaseURL, "/")
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: defaultPwnedPasswordsTimeout}
+	}
+	if opts.UserAgent == "" {
+		opts.UserAgent = "passhash"
+	}
+	if opts.Threshold <= 0 {
+		opts.Threshold = 1
+	}
+	if opts.CacheTTL <= 0 {
+		opts.CacheTTL = defaultPwnedPasswordsCacheTTL
+	}
+	if opts.CacheSize == 0 {
+		opts.CacheSize = defaultPwnedPasswordsCacheSize
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return &NotPwnedPassword{opts: opts, cache: make(map[string]pwnedPasswordsCacheEntry)}
+}
+
+// PasswordAcceptable accepts passwords that have appeared in fewer than Threshold breaches
+func (pp *NotPwnedPassword) PasswordAcceptable(password string) error {
+	sum := sha1.Sum([]byte(password)) // nolint: gosec
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:pwnedPasswordsPrefixLen], hash[pwnedPasswordsPrefixLen:]
+	counts, err := pp.rangeCounts(prefix)
+	if err != nil {
+		if pp.opts.FailOpen {
+			return nil
+		}
+		return fmt.Errorf("%w: %v", ErrPwnedPasswordsUnavailable, err)
+	}
+	if count := counts[suffix]; count >= pp.opts.Threshold {
+		return fmt.Errorf("%w (%d occurrences)", ErrPwnedPassword, count)
+	}
+	return nil
+}
+
+// rangeCounts returns the breach counts of the hash suffixes with the prefix
+func (pp *NotPwnedPassword) rangeCounts(prefix string) (map[string]int, error) {
+	now := pp.opts.Now()
+	pp.mu.Lock()
+	entry, ok := pp.cache[prefix]
+	pp.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.counts, nil
+	}
+
+	counts, err := pp.fetchRange(prefix)
+	if err != nil {
+		return nil, err
+	}
+	if pp.opts.CacheSize > 0 {
+		pp.mu.Lock()
+		pp.evict(now)
+		pp.cache[prefix] = pwnedPasswordsCacheEntry{counts: counts, expires: now.Add(pp.opts.CacheTTL)}
+		pp.mu.Unlock()
+	}
+	return counts, nil
+}
+
+// evict deletes expired entries and the entries expiring soonest until there's room for another entry
+func (pp *NotPwnedPassword) evict(now time.Time) {
+	for prefix, entry := range pp.cache {
+		if !now.Before(entry.expires) {
+			delete(pp.cache, prefix)
+		}
+	}
+	for len(pp.cache) >= pp.opts.CacheSize {
+		var oldest string
+		for prefix, entry := range pp.cache {
+			if oldest == "" || entry.expires.Before(pp.cache[oldest].expires) {
+				oldest = prefix
+			}
+		}
+		delete(pp.cache, oldest)
+	}
+}
+
+func (pp *NotPwnedPassword) fetchRange(prefix string) (map[string]int, error) {
+	req, err := http.NewRequest(http.MethodGet, pp.opts.BaseURL+"/range/"+prefix, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", pp.opts.UserAgent)
+	if pp.opts.AddPadding {
+		req.Header.Set("Add-Padding", "true")
+	}
+	resp, err := pp.opts.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close() // nolint: errcheck
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Unexpected status: %s", resp.Status)
+	}
+	return parsePwnedPasswordsRange(io.LimitReader(resp.Body, maxPwnedPasswordsResponseBytes))
+}
+
+// parsePwnedPasswordsRange parses SUFFIX:COUNT lines. Padding entries have a count of 0 and are ignored
+func parsePwnedPasswordsRange(r io.Reader) (map[string]int, error) {
+	counts := make(map[string]int)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		suffix, countStr, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, errors.New("Malformed Pwned Passwords range line")
+		}
+		count, err := strconv.Atoi(countStr)
+		if err != nil {
+			return nil, fmt.Errorf("Malformed Pwned Passwords count: %v", err)
+		}
+		if count > 0 {
+			counts[strings.ToUpper(suffix)] = count
+		}
+	}
+	return counts, scanner.Err()
+}
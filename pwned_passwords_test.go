@@ -0,0 +1,142 @@
+package passhash_test
+
+import (
+	"crypto/sha1" // nolint: gosec
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dhui/passhash"
+)
+
+const pwnedPassword = "password"
+
+// pwnedPasswordsServer is a Pwned Passwords range API stand-in that has seen pwnedPassword 10 times
+type pwnedPasswordsServer struct {
+	*httptest.Server
+	requests atomic.Int64
+	status   int
+	padded   atomic.Bool
+}
+
+func newPwnedPasswordsServer(t *testing.T) *pwnedPasswordsServer {
+	t.Helper()
+	sum := sha1.Sum([]byte(pwnedPassword)) // nolint: gosec
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	s := &pwnedPasswordsServer{status: http.StatusOK}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests.Add(1)
+		if s.status != http.StatusOK {
+			w.WriteHeader(s.status)
+			return
+		}
+		prefix := strings.TrimPrefix(r.URL.Path, "/range/")
+		if len(prefix) != 5 {
+			t.Errorf("Unexpected range request: %s", r.URL.Path)
+		}
+		if r.Header.Get("User-Agent") == "" {
+			t.Error("Missing User-Agent")
+		}
+		fmt.Fprint(w, "0018A45C4D1DEF81644B54AB7F969B88D65:1\r\n")
+		if prefix == hash[:5] {
+			fmt.Fprintf(w, "%s:10\r\n", strings.ToLower(hash[5:]))
+		}
+		if r.Header.Get("Add-Padding") == "true" {
+			s.padded.Store(true)
+			// Padding entries have a count of 0
+			fmt.Fprintf(w, "%s:0\r\n", hash[5:])
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestNotPwnedPassword(t *testing.T) {
+	server := newPwnedPasswordsServer(t)
+	pp := passhash.NewNotPwnedPassword(passhash.NotPwnedPasswordOptions{BaseURL: server.URL + "/"})
+	if err := pp.PasswordAcceptable(pwnedPassword); !errors.Is(err, passhash.ErrPwnedPassword) {
+		t.Error("Expected ErrPwnedPassword. Got:", err)
+	}
+	if err := pp.PasswordAcceptable(testPassword); err != nil {
+		t.Error("Password that hasn't been pwned was rejected", err)
+	}
+}
+
+func TestNotPwnedPasswordThreshold(t *testing.T) {
+	server := newPwnedPasswordsServer(t)
+	for threshold, accepted := range map[int]bool{10: false, 11: true} {
+		pp := passhash.NewNotPwnedPassword(passhash.NotPwnedPasswordOptions{BaseURL: server.URL,
+			Threshold: threshold})
+		if err := pp.PasswordAcceptable(pwnedPassword); (err == nil) != accepted {
+			t.Errorf("Unexpected result with threshold %d: %v", threshold, err)
+		}
+	}
+}
+
+func TestNotPwnedPasswordPadding(t *testing.T) {
+	server := newPwnedPasswordsServer(t)
+	pp := passhash.NewNotPwnedPassword(passhash.NotPwnedPasswordOptions{BaseURL: server.URL, AddPadding: true,
+		Threshold: 11})
+	if err := pp.PasswordAcceptable(pwnedPassword); err != nil {
+		t.Error("Padding entry was counted", err)
+	}
+	if !server.padded.Load() {
+		t.Error("Padding wasn't requested")
+	}
+}
+
+func TestNotPwnedPasswordCache(t *testing.T) {
+	server := newPwnedPasswordsServer(t)
+	clock := newFakeClock()
+	pp := passhash.NewNotPwnedPassword(passhash.NotPwnedPasswordOptions{BaseURL: server.URL,
+		CacheTTL: time.Minute, Now: clock.Now})
+	for i := 0; i < 3; i++ {
+		if err := pp.PasswordAcceptable(pwnedPassword); !errors.Is(err, passhash.ErrPwnedPassword) {
+			t.Fatal("Expected ErrPwnedPassword. Got:", err)
+		}
+	}
+	if n := server.requests.Load(); n != 1 {
+		t.Errorf("Response not cached. %d requests", n)
+	}
+	clock.now = clock.now.Add(time.Minute)
+	if err := pp.PasswordAcceptable(pwnedPassword); !errors.Is(err, passhash.ErrPwnedPassword) {
+		t.Fatal("Expected ErrPwnedPassword. Got:", err)
+	}
+	if n := server.requests.Load(); n != 2 {
+		t.Errorf("Expired response used. %d requests", n)
+	}
+}
+
+func TestNotPwnedPasswordCacheDisabled(t *testing.T) {
+	server := newPwnedPasswordsServer(t)
+	pp := passhash.NewNotPwnedPassword(passhash.NotPwnedPasswordOptions{BaseURL: server.URL, CacheSize: -1})
+	for i := 0; i < 2; i++ {
+		_ = pp.PasswordAcceptable(pwnedPassword)
+	}
+	if n := server.requests.Load(); n != 2 {
+		t.Errorf("Response cached. %d requests", n)
+	}
+}
+
+func TestNotPwnedPasswordUnavailable(t *testing.T) {
+	server := newPwnedPasswordsServer(t)
+	server.status = http.StatusServiceUnavailable
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	for _, url := range []string{server.URL, closed.URL} {
+		pp := passhash.NewNotPwnedPassword(passhash.NotPwnedPasswordOptions{BaseURL: url})
+		if err := pp.PasswordAcceptable(testPassword); !errors.Is(err, passhash.ErrPwnedPasswordsUnavailable) {
+			t.Error("Expected ErrPwnedPasswordsUnavailable. Got:", err)
+		}
+		pp = passhash.NewNotPwnedPassword(passhash.NotPwnedPasswordOptions{BaseURL: url, FailOpen: true})
+		if err := pp.PasswordAcceptable(testPassword); err != nil {
+			t.Error("Failing open rejected password", err)
+		}
+	}
+}
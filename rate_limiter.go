@@ -0,0 +1,215 @@
+package passhash
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"net"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// RateLimiter limits password verifications before any hashing happens, to prevent attackers from using the cost of
+// the Kdf to DoS the server
+type RateLimiter interface {
+	// Acquire reserves capacity to verify a password from the IP. A RateLimitedError is returned if there isn't any
+	// capacity. Otherwise, release must be called once the verification is done
+	Acquire(ctx context.Context, ip net.IP) (release func(), err error)
+}
+
+func noopRelease() {}
+
+// acquireRateLimit acquires capacity from the Config's RateLimiter, if any
+func (c Config) acquireRateLimit(ctx context.Context, ip net.IP) (func(), error) {
+	if c.RateLimiter == nil {
+		return noopRelease, nil
+	}
+	return c.RateLimiter.Acquire(ctx, ip)
+}
+
+// defaultTokenBucketIPv6PrefixLen is the default IPv6 subnet sharing a bucket. A single client is usually assigned a
+// whole /64, so limiting individual IPv6 addresses is trivially bypassed
+const defaultTokenBucketIPv6PrefixLen = 64
+
+// DefaultTokenBucketLimiterMaxBuckets is the default maximum number of buckets kept by a TokenBucketLimiter
+const DefaultTokenBucketLimiterMaxBuckets = 100000
+
+// TokenBucketLimiterOptions configures a TokenBucketLimiter
+type TokenBucketLimiterOptions struct {
+	Interval      time.Duration // A token is added to each bucket every Interval. Required
+	Burst         int           // The number of tokens a bucket holds. Defaults to 1
+	IPv4PrefixLen int           // The IPv4 prefix length sharing a bucket. e.g. 24 for a /24. Defaults to 32
+	IPv6PrefixLen int           // The IPv6 prefix length sharing a bucket. Defaults to 64, a typical client subnet
+	// MaxBuckets is the maximum number of buckets kept. Defaults to DefaultTokenBucketLimiterMaxBuckets
+	MaxBuckets int
+	Now        func() time.Time // Returns the current time, used to refill buckets. Defaults to time.Now
+}
+
+type tokenBucket struct {
+	key    string
+	tokens float64
+	last   time.Time
+}
+
+// TokenBucketLimiter is a RateLimiter with a token bucket per IP or subnet. Each verification takes a token.
+// IPs that are neither IPv4 nor IPv6 (e.g. EmptyIP) share a bucket.
+// Full buckets are deleted. Once there are MaxBuckets buckets, the least recently used bucket is evicted to make room
+// for a new bucket, so memory usage is bounded even if an attacker rotates through many subnets. An evicted subnet
+// starts over with a full bucket, so size MaxBuckets well above the number of subnets expected to be limited at once.
+type TokenBucketLimiter struct {
+	mu      sync.Mutex
+	opts    TokenBucketLimiterOptions
+	buckets map[string]*list.Element
+	lru     *list.List // The buckets from most to least recently used
+}
+
+// NewTokenBucketLimiter creates a TokenBucketLimiter
+func NewTokenBucketLimiter(opts TokenBucketLimiterOptions) (*TokenBucketLimiter, error) {
+	if opts.Interval <= 0 {
+		return nil, errors.New("TokenBucketLimiter Interval must be positive")
+	}
+	if opts.MaxBuckets < 0 {
+		return nil, errors.New("TokenBucketLimiter MaxBuckets must not be negative")
+	}
+	if opts.IPv4PrefixLen < 0 || opts.IPv4PrefixLen > 8*net.IPv4len || opts.IPv6PrefixLen < 0 ||
+		opts.IPv6PrefixLen > 8*net.IPv6len {
+		return nil, errors.New("TokenBucketLimiter prefix length is out of range")
+	}
+	if opts.Burst <= 0 {
+		opts.Burst = 1
+	}
+	if opts.IPv4PrefixLen == 0 {
+		opts.IPv4PrefixLen = 8 * net.IPv4len
+	}
+	if opts.IPv6PrefixLen == 0 {
+		opts.IPv6PrefixLen = defaultTokenBucketIPv6PrefixLen
+	}
+	if opts.MaxBuckets == 0 {
+		opts.MaxBuckets = DefaultTokenBucketLimiterMaxBuckets
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return &TokenBucketLimiter{opts: opts, buckets: make(map[string]*list.Element), lru: list.New()}, nil
+}
+
+// bucketKey returns the subnet of the IP
+func (l *TokenBucketLimiter) bucketKey(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return string(ip4.Mask(net.CIDRMask(l.opts.IPv4PrefixLen, 8*net.IPv4len)))
+	}
+	if len(ip) == net.IPv6len {
+		return string(ip.Mask(net.CIDRMask(l.opts.IPv6PrefixLen, 8*net.IPv6len)))
+	}
+	return ""
+}
+
+// refillDuration is the time it takes for an empty bucket to be full
+func (l *TokenBucketLimiter) refillDuration() time.Duration {
+	return time.Duration(l.opts.Burst) * l.opts.Interval
+}
+
+// cleanup deletes the full buckets. Buckets are refilled when they're used, so the least recently used buckets are
+// the first to be full
+func (l *TokenBucketLimiter) cleanup(now time.Time) {
+	for e := l.lru.Back(); e != nil && now.Sub(e.Value.(*tokenBucket).last) >= l.refillDuration(); e = l.lru.Back() {
+		l.remove(e)
+	}
+}
+
+func (l *TokenBucketLimiter) remove(e *list.Element) {
+	delete(l.buckets, l.lru.Remove(e).(*tokenBucket).key)
+}
+
+// bucket returns the bucket for the key, creating a full bucket and evicting the least recently used bucket if
+// necessary
+func (l *TokenBucketLimiter) bucket(key string, now time.Time) *tokenBucket {
+	if e, ok := l.buckets[key]; ok {
+		l.lru.MoveToFront(e)
+		return e.Value.(*tokenBucket)
+	}
+	for len(l.buckets) >= l.opts.MaxBuckets {
+		l.remove(l.lru.Back())
+	}
+	bucket := &tokenBucket{key: key, tokens: float64(l.opts.Burst), last: now}
+	l.buckets[key] = l.lru.PushFront(bucket)
+	return bucket
+}
+
+// Acquire takes a token from the IP's bucket
+func (l *TokenBucketLimiter) Acquire(ctx context.Context, ip net.IP) (func(), error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.opts.Now()
+	l.cleanup(now)
+	bucket := l.bucket(l.bucketKey(ip), now)
+	if elapsed := now.Sub(bucket.last); elapsed > 0 {
+		bucket.tokens = min(float64(l.opts.Burst), bucket.tokens+float64(elapsed)/float64(l.opts.Interval))
+		bucket.last = now
+	}
+	if bucket.tokens < 1 {
+		retryAfter := time.Duration((1 - bucket.tokens) * float64(l.opts.Interval))
+		return nil, RateLimitedError{IP: ip, RetryAfter: retryAfter}
+	}
+	bucket.tokens--
+	return noopRelease, nil
+}
+
+// ConcurrencyLimiter is a RateLimiter that limits the number of concurrent password verifications across all IPs
+type ConcurrencyLimiter struct {
+	sem chan struct{}
+}
+
+// NewConcurrencyLimiter creates a ConcurrencyLimiter allowing limit concurrent verifications. A non-positive limit
+// defaults to GOMAXPROCS since Kdfs are CPU bound
+func NewConcurrencyLimiter(limit int) *ConcurrencyLimiter {
+	if limit <= 0 {
+		limit = runtime.GOMAXPROCS(0)
+	}
+	return &ConcurrencyLimiter{sem: make(chan struct{}, limit)}
+}
+
+// Acquire reserves one of the concurrent verifications without waiting
+func (l *ConcurrencyLimiter) Acquire(ctx context.Context, ip net.IP) (func(), error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	select {
+	case l.sem <- struct{}{}:
+		var once sync.Once
+		return func() { once.Do(func() { <-l.sem }) }, nil
+	default:
+		return nil, RateLimitedError{IP: ip}
+	}
+}
+
+type multiRateLimiter []RateLimiter
+
+// MultiRateLimiter creates a RateLimiter that acquires capacity from every RateLimiter in order.
+// e.g. a per IP TokenBucketLimiter, a per subnet TokenBucketLimiter, and a global ConcurrencyLimiter
+func MultiRateLimiter(limiters ...RateLimiter) RateLimiter {
+	return multiRateLimiter(limiters)
+}
+
+// Acquire acquires capacity from every RateLimiter, releasing any acquired capacity if one of them fails
+func (m multiRateLimiter) Acquire(ctx context.Context, ip net.IP) (func(), error) {
+	releases := make([]func(), 0, len(m))
+	release := func() {
+		for i := len(releases) - 1; i >= 0; i-- {
+			releases[i]()
+		}
+	}
+	for _, limiter := range m {
+		r, err := limiter.Acquire(ctx, ip)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		releases = append(releases, r)
+	}
+	return release, nil
+}
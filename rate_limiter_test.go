@@ -0,0 +1,220 @@
+package passhash_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/dhui/passhash"
+)
+
+func newTestTokenBucketLimiter(t *testing.T, opts passhash.TokenBucketLimiterOptions) (*passhash.TokenBucketLimiter,
+	*fakeClock) {
+	t.Helper()
+	clock := newFakeClock()
+	opts.Now = clock.Now
+	limiter, err := passhash.NewTokenBucketLimiter(opts)
+	if err != nil {
+		t.Fatal("Unable to create TokenBucketLimiter", err)
+	}
+	return limiter, clock
+}
+
+func acquire(t *testing.T, limiter passhash.RateLimiter, ip string) error {
+	t.Helper()
+	release, err := limiter.Acquire(context.Background(), net.ParseIP(ip))
+	if err == nil {
+		release()
+	}
+	return err
+}
+
+func TestNewTokenBucketLimiterInvalidOptions(t *testing.T) {
+	for _, opts := range []passhash.TokenBucketLimiterOptions{
+		{},
+		{Interval: time.Second, IPv4PrefixLen: 33},
+		{Interval: time.Second, IPv6PrefixLen: -1},
+		{Interval: time.Second, MaxBuckets: -1},
+	} {
+		if _, err := passhash.NewTokenBucketLimiter(opts); err == nil {
+			t.Errorf("Expected error for options %+v", opts)
+		}
+	}
+}
+
+func TestTokenBucketLimiter(t *testing.T) {
+	limiter, clock := newTestTokenBucketLimiter(t, passhash.TokenBucketLimiterOptions{Interval: time.Second,
+		Burst: 2})
+	for i := 0; i < 2; i++ {
+		if err := acquire(t, limiter, "192.0.2.1"); err != nil {
+			t.Fatal("Unable to acquire burst", err)
+		}
+	}
+	err := acquire(t, limiter, "192.0.2.1")
+	var limitedErr passhash.RateLimitedError
+	if !errors.Is(err, passhash.ErrRateLimited) || !errors.As(err, &limitedErr) || limitedErr.RetryAfter != time.Second {
+		t.Fatal("Expected RateLimitedError retrying after 1s. Got:", err)
+	}
+	if err := acquire(t, limiter, "192.0.2.2"); err != nil {
+		t.Error("Different IP is rate limited", err)
+	}
+
+	clock.now = clock.now.Add(500 * time.Millisecond)
+	if err := acquire(t, limiter, "192.0.2.1"); !errors.As(err, &limitedErr) ||
+		limitedErr.RetryAfter != 500*time.Millisecond {
+		t.Fatal("Expected RateLimitedError retrying after 500ms. Got:", err)
+	}
+	clock.now = clock.now.Add(500 * time.Millisecond)
+	if err := acquire(t, limiter, "192.0.2.1"); err != nil {
+		t.Error("Token not refilled", err)
+	}
+}
+
+func TestTokenBucketLimiterSubnets(t *testing.T) {
+	limiter, _ := newTestTokenBucketLimiter(t, passhash.TokenBucketLimiterOptions{Interval: time.Second,
+		IPv4PrefixLen: 24, IPv6PrefixLen: 64})
+	for _, ips := range [][2]string{
+		{"192.0.2.1", "192.0.2.200"},
+		{"::ffff:198.51.100.1", "198.51.100.2"},
+		{"2001:db8::1", "2001:db8::ffff:1"},
+		{"", "not an ip"},
+	} {
+		if err := acquire(t, limiter, ips[0]); err != nil {
+			t.Fatalf("Unable to acquire for %s: %v", ips[0], err)
+		}
+		if err := acquire(t, limiter, ips[1]); !errors.Is(err, passhash.ErrRateLimited) {
+			t.Errorf("Expected %s to share a bucket with %s. Got: %v", ips[1], ips[0], err)
+		}
+	}
+	if err := acquire(t, limiter, "192.0.3.1"); err != nil {
+		t.Error("Different subnet is rate limited", err)
+	}
+	if err := acquire(t, limiter, "2001:db8:0:1::1"); err != nil {
+		t.Error("Different subnet is rate limited", err)
+	}
+}
+
+func TestTokenBucketLimiterDefaultPrefixLens(t *testing.T) {
+	limiter, _ := newTestTokenBucketLimiter(t, passhash.TokenBucketLimiterOptions{Interval: time.Second})
+	for _, ip := range []string{"192.0.2.1", "192.0.2.2", "2001:db8::1"} {
+		if err := acquire(t, limiter, ip); err != nil {
+			t.Fatalf("Unable to acquire for %s: %v", ip, err)
+		}
+	}
+	if err := acquire(t, limiter, "2001:db8::ffff:2"); !errors.Is(err, passhash.ErrRateLimited) {
+		t.Error("Expected IPv6 addresses in the same /64 to share a bucket. Got:", err)
+	}
+}
+
+func TestTokenBucketLimiterMaxBuckets(t *testing.T) {
+	limiter, clock := newTestTokenBucketLimiter(t, passhash.TokenBucketLimiterOptions{Interval: time.Second,
+		MaxBuckets: 2})
+	for _, step := range []struct {
+		ip      string
+		limited bool
+	}{
+		{"192.0.2.1", false},
+		{"192.0.2.2", false},
+		{"192.0.2.1", true},
+		{"192.0.2.3", false}, // Evicts 192.0.2.2, the least recently used bucket
+		{"192.0.2.1", true},
+		{"192.0.2.2", false}, // Evicts 192.0.2.3
+		{"192.0.2.3", false}, // Evicts 192.0.2.1
+		{"192.0.2.1", false},
+	} {
+		if err := acquire(t, limiter, step.ip); errors.Is(err, passhash.ErrRateLimited) != step.limited {
+			t.Fatalf("Unexpected result for %s. Limited: %v. Got: %v", step.ip, step.limited, err)
+		}
+		clock.now = clock.now.Add(time.Millisecond)
+	}
+}
+
+func TestTokenBucketLimiterContextDone(t *testing.T) {
+	limiter, _ := newTestTokenBucketLimiter(t, passhash.TokenBucketLimiterOptions{Interval: time.Second})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := limiter.Acquire(ctx, net.ParseIP("192.0.2.1")); !errors.Is(err, context.Canceled) {
+		t.Error("Expected context.Canceled. Got:", err)
+	}
+}
+
+func TestConcurrencyLimiter(t *testing.T) {
+	limiter := passhash.NewConcurrencyLimiter(2)
+	ctx := context.Background()
+	release1, err := limiter.Acquire(ctx, net.ParseIP("192.0.2.1"))
+	if err != nil {
+		t.Fatal("Unable to acquire", err)
+	}
+	release2, err := limiter.Acquire(ctx, net.ParseIP("192.0.2.2"))
+	if err != nil {
+		t.Fatal("Unable to acquire", err)
+	}
+	if _, err := limiter.Acquire(ctx, net.ParseIP("192.0.2.3")); !errors.Is(err, passhash.ErrRateLimited) {
+		t.Fatal("Expected ErrRateLimited. Got:", err)
+	}
+	release1()
+	release1()
+	if _, err := limiter.Acquire(ctx, net.ParseIP("192.0.2.3")); err != nil {
+		t.Error("Unable to acquire after release", err)
+	}
+	if _, err := limiter.Acquire(ctx, net.ParseIP("192.0.2.4")); !errors.Is(err, passhash.ErrRateLimited) {
+		t.Error("Releasing twice freed two slots. Got:", err)
+	}
+	release2()
+}
+
+func TestMultiRateLimiterReleasesOnFailure(t *testing.T) {
+	concurrency := passhash.NewConcurrencyLimiter(1)
+	perIP, _ := newTestTokenBucketLimiter(t, passhash.TokenBucketLimiterOptions{Interval: time.Second})
+	limiter := passhash.MultiRateLimiter(concurrency, perIP)
+	if err := acquire(t, limiter, "192.0.2.1"); err != nil {
+		t.Fatal("Unable to acquire", err)
+	}
+	if err := acquire(t, limiter, "192.0.2.1"); !errors.Is(err, passhash.ErrRateLimited) {
+		t.Fatal("Expected ErrRateLimited. Got:", err)
+	}
+	if err := acquire(t, concurrency, "192.0.2.1"); err != nil {
+		t.Error("Concurrency slot not released after rate limiting", err)
+	}
+}
+
+func TestVerifyRateLimited(t *testing.T) {
+	config := countingKdfConfig(15)
+	credential, err := config.NewCredential(passhash.UserID(1), testPassword)
+	if err != nil {
+		t.Fatal("Unable to create credential", err)
+	}
+	config.RateLimiter, _ = newTestTokenBucketLimiter(t, passhash.TokenBucketLimiterOptions{Interval: time.Minute})
+	ip := passhash.WithIP(net.ParseIP("192.0.2.1"))
+	if result, err := credential.Verify(context.Background(), config, testPassword, ip); err != nil || !result.Matched {
+		t.Fatalf("Unexpected result %+v. Error: %v", result, err)
+	}
+	verifies := testCountingKdfImpl.verifies.Load()
+	if _, err := credential.Verify(context.Background(), config, testPassword, ip); !errors.Is(err,
+		passhash.ErrRateLimited) {
+		t.Error("Expected ErrRateLimited. Got:", err)
+	}
+	if n := testCountingKdfImpl.verifies.Load() - verifies; n != 0 {
+		t.Errorf("Rate limited verification verified %d passwords", n)
+	}
+}
+
+func TestAuthenticatorLoginUnknownUserRateLimited(t *testing.T) {
+	config := countingKdfConfig(15)
+	config.RateLimiter = passhash.NewConcurrencyLimiter(1)
+	authenticator, err := passhash.NewAuthenticator(config)
+	if err != nil {
+		t.Fatal("Unable to create Authenticator", err)
+	}
+	release, err := config.RateLimiter.Acquire(context.Background(), passhash.EmptyIP)
+	if err != nil {
+		t.Fatal("Unable to acquire", err)
+	}
+	defer release()
+	if _, err := authenticator.Login(context.Background(), passhash.UserID(1), testPassword,
+		passhash.EmptyIP); !errors.Is(err, passhash.ErrRateLimited) {
+		t.Error("Expected ErrRateLimited. Got:", err)
+	}
+}
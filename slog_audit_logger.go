@@ -0,0 +1,112 @@
+package passhash
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"net"
+	"slices"
+)
+
+// DefaultSlogAuditLevels are the levels used by a SlogAuditLogger when SlogAuditLoggerOptions.Levels is nil
+var DefaultSlogAuditLevels = map[AuditType]slog.Level{
+	AuthnFailed:               slog.LevelWarn,
+	PasswordPolicyRejected:    slog.LevelWarn,
+	PasswordUnchangedRejected: slog.LevelWarn,
+	AccountLocked:             slog.LevelWarn,
+}
+
+// SlogAuditLoggerOptions configures a SlogAuditLogger. The zero value uses sane defaults
+type SlogAuditLoggerOptions struct {
+	// Levels are the levels used to log each AuditType. nil uses DefaultSlogAuditLevels
+	Levels map[AuditType]slog.Level
+	// DefaultLevel is the level used to log AuditTypes missing from Levels. Defaults to slog.LevelInfo
+	DefaultLevel slog.Level
+	// Message is the message of each record. Defaults to "passhash audit"
+	Message string
+	// Reader is a companion AuditLogger that backs LastN and LastNWithTypes. Every log is also logged to the Reader.
+	// If nil, LastN and LastNWithTypes are unsupported and always return no logs.
+	Reader AuditLogger
+}
+
+// SlogAuditLogger is an AuditLogger that emits each log as a structured log/slog record with the attributes user_id,
+// audit_type, and ip, plus reason, request_id, user_agent, client_id, and attributes when available.
+// The record's time is the time of the log
+type SlogAuditLogger struct {
+	logger *slog.Logger
+	opts   SlogAuditLoggerOptions
+}
+
+// NewSlogAuditLogger creates a SlogAuditLogger that logs to the logger. A nil logger uses slog.Default()
+func NewSlogAuditLogger(logger *slog.Logger, opts SlogAuditLoggerOptions) *SlogAuditLogger {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	if opts.Levels == nil {
+		opts.Levels = DefaultSlogAuditLevels
+	}
+	if opts.Message == "" {
+		opts.Message = "passhash audit"
+	}
+	return &SlogAuditLogger{logger: logger, opts: opts}
+}
+
+// Log logs the audit log as a slog record
+func (al *SlogAuditLogger) Log(userID UserID, at AuditType, ip net.IP) {
+	ctx := context.Background()
+	al.LogEvent(ctx, newAuditEvent(ctx, userID, at, ip, ""))
+}
+
+// LogEvent logs the audit event as a slog record
+func (al *SlogAuditLogger) LogEvent(ctx context.Context, event AuditEvent) {
+	if al.opts.Reader != nil {
+		NewContextAuditLogger(al.opts.Reader).LogEvent(ctx, event)
+	}
+	level, ok := al.opts.Levels[event.Type]
+	if !ok {
+		level = al.opts.DefaultLevel
+	}
+	handler := al.logger.Handler()
+	if !handler.Enabled(ctx, level) {
+		return
+	}
+	r := slog.NewRecord(event.Time, level, al.opts.Message, 0)
+	r.AddAttrs(slog.Uint64("user_id", uint64(event.UserID)), slog.String("audit_type", event.Type.String()))
+	if len(event.IP) > 0 {
+		r.AddAttrs(slog.String("ip", event.IP.String()))
+	}
+	for _, attr := range []struct{ key, value string }{
+		{"reason", string(event.Reason)},
+		{"request_id", event.RequestID},
+		{"user_agent", event.UserAgent},
+		{"client_id", event.ClientID},
+	} {
+		if attr.value != "" {
+			r.AddAttrs(slog.String(attr.key, attr.value))
+		}
+	}
+	if len(event.Attributes) > 0 {
+		attrs := make([]any, 0, len(event.Attributes))
+		for _, k := range slices.Sorted(maps.Keys(event.Attributes)) {
+			attrs = append(attrs, slog.String(k, event.Attributes[k]))
+		}
+		r.AddAttrs(slog.Group("attributes", attrs...))
+	}
+	_ = handler.Handle(ctx, r)
+}
+
+// LastN gets the last N logs for a user from the Reader, if any
+func (al *SlogAuditLogger) LastN(userID UserID, n int) []Log {
+	if al.opts.Reader == nil {
+		return []Log{}
+	}
+	return al.opts.Reader.LastN(userID, n)
+}
+
+// LastNWithTypes gets the last N logs for a user with the specified types from the Reader, if any
+func (al *SlogAuditLogger) LastNWithTypes(userID UserID, n int, auditTypes ...AuditType) []Log {
+	if al.opts.Reader == nil {
+		return []Log{}
+	}
+	return al.opts.Reader.LastNWithTypes(userID, n, auditTypes...)
+}
@@ -0,0 +1,158 @@
+package passhash_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/dhui/passhash"
+)
+
+func newTestSlogAuditLogger(opts passhash.SlogAuditLoggerOptions) (*passhash.SlogAuditLogger, *bytes.Buffer) {
+	buf := &bytes.Buffer{}
+	logger := slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	return passhash.NewSlogAuditLogger(logger, opts), buf
+}
+
+func slogRecords(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		record := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatal("Unable to parse slog record", err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestAuditTypeString(t *testing.T) {
+	if s := passhash.AuthnFailed.String(); s != "authn_failed" {
+		t.Errorf("Unexpected AuditType name. %s != authn_failed", s)
+	}
+	if s := passhash.PasswordUnchangedRejected.String(); s != "password_unchanged_rejected" {
+		t.Errorf("Unexpected AuditType name. %s != password_unchanged_rejected", s)
+	}
+	if s := passhash.AuditType(1000).String(); s != "AuditType(1000)" {
+		t.Errorf("Unexpected AuditType name. %s != AuditType(1000)", s)
+	}
+}
+
+func TestSlogAuditLoggerLog(t *testing.T) {
+	al, buf := newTestSlogAuditLogger(passhash.SlogAuditLoggerOptions{})
+	al.Log(passhash.UserID(7), passhash.AuthnSucceeded, net.ParseIP("192.0.2.1"))
+	al.Log(passhash.UserID(7), passhash.AuthnFailed, passhash.EmptyIP)
+
+	records := slogRecords(t, buf)
+	if len(records) != 2 {
+		t.Fatalf("Unexpected number of records. %d != 2", len(records))
+	}
+	expected := map[string]interface{}{"level": "INFO", "msg": "passhash audit", "user_id": float64(7),
+		"audit_type": "authn_succeeded", "ip": "192.0.2.1"}
+	for k, v := range expected {
+		if records[0][k] != v {
+			t.Errorf("Unexpected %s. %v != %v", k, records[0][k], v)
+		}
+	}
+	if _, ok := records[0]["time"]; !ok {
+		t.Error("Record missing time")
+	}
+	if records[1]["level"] != "WARN" || records[1]["audit_type"] != "authn_failed" {
+		t.Error("Unexpected record", records[1])
+	}
+	if _, ok := records[1]["ip"]; ok {
+		t.Error("Record has an empty IP", records[1])
+	}
+}
+
+func TestSlogAuditLoggerLogEvent(t *testing.T) {
+	al, buf := newTestSlogAuditLogger(passhash.SlogAuditLoggerOptions{})
+	config := passhash.DefaultConfig
+	config.AuditLogger = al
+	credential, err := config.NewCredential(passhash.UserID(7), testPassword)
+	if err != nil {
+		t.Fatal("Unable to create new Credential", err)
+	}
+	buf.Reset()
+	ctx := passhash.WithRequestID(context.Background(), "request-1")
+	ctx = passhash.WithAuditAttributes(ctx, map[string]string{"tenant": "acme"})
+	if _, err := credential.Verify(ctx, config, "wrong password"); err != nil {
+		t.Fatal("Unable to verify password", err)
+	}
+
+	records := slogRecords(t, buf)
+	if len(records) != 1 {
+		t.Fatalf("Unexpected number of records. %d != 1", len(records))
+	}
+	record := records[0]
+	if record["reason"] != string(passhash.ReasonWrongPassword) || record["request_id"] != "request-1" {
+		t.Error("Record missing event metadata", record)
+	}
+	if attributes, ok := record["attributes"].(map[string]interface{}); !ok || attributes["tenant"] != "acme" {
+		t.Error("Record missing attributes", record)
+	}
+	if _, ok := record["user_agent"]; ok {
+		t.Error("Record has an empty user agent", record)
+	}
+}
+
+func TestSlogAuditLoggerLevels(t *testing.T) {
+	al, buf := newTestSlogAuditLogger(passhash.SlogAuditLoggerOptions{
+		Levels:       map[passhash.AuditType]slog.Level{passhash.UpgradedKdf: slog.LevelError},
+		DefaultLevel: slog.LevelDebug,
+		Message:      "audit",
+	})
+	al.Log(passhash.UserID(7), passhash.UpgradedKdf, passhash.EmptyIP)
+	al.Log(passhash.UserID(7), passhash.AuthnFailed, passhash.EmptyIP)
+
+	records := slogRecords(t, buf)
+	if len(records) != 2 {
+		t.Fatalf("Unexpected number of records. %d != 2", len(records))
+	}
+	if records[0]["level"] != "ERROR" || records[1]["level"] != "DEBUG" || records[0]["msg"] != "audit" {
+		t.Error("Unexpected records", records)
+	}
+}
+
+func TestSlogAuditLoggerDisabledLevel(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	reader := &passhash.MemoryAuditLogger{}
+	al := passhash.NewSlogAuditLogger(logger, passhash.SlogAuditLoggerOptions{Reader: reader})
+	al.Log(passhash.UserID(7), passhash.AuthnSucceeded, passhash.EmptyIP)
+	if buf.Len() != 0 {
+		t.Error("Logged record below the handler's level", buf.String())
+	}
+	if l := len(al.LastN(passhash.UserID(7), 10)); l != 1 {
+		t.Errorf("Log not forwarded to Reader. Have %d logs instead of 1", l)
+	}
+}
+
+func TestSlogAuditLoggerReader(t *testing.T) {
+	userID := passhash.UserID(7)
+	al, _ := newTestSlogAuditLogger(passhash.SlogAuditLoggerOptions{})
+	n := setupAuditLoggerTestData(userID, al)
+	if l := len(al.LastN(userID, n)); l != 0 {
+		t.Errorf("SlogAuditLogger without a Reader has %d logs", l)
+	}
+	if l := len(al.LastNWithTypes(userID, n, passhash.AuthnFailed)); l != 0 {
+		t.Errorf("SlogAuditLogger without a Reader has %d logs", l)
+	}
+
+	al, _ = newTestSlogAuditLogger(passhash.SlogAuditLoggerOptions{Reader: &passhash.MemoryAuditLogger{}})
+	n = setupAuditLoggerTestData(userID, al)
+	if l := len(al.LastN(userID, n)); l != n {
+		t.Errorf("Did not retrieve expected number of logs. Have %d logs instead of %d", l, n)
+	}
+	if l := len(al.LastNWithTypes(userID, n, passhash.AuthnFailed)); l != n/3 {
+		t.Errorf("Did not retrieve expected number of logs. Have %d logs instead of %d", l, n/3)
+	}
+}
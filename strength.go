@@ -0,0 +1,303 @@
+package passhash
+
+import (
+	"math"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	// StrengthGuessesPerSecond is the guess rate used to estimate Strength.CrackTime. It models an offline attack
+	// against a slow Kdf
+	StrengthGuessesPerSecond = 1e4
+	// MaxStrengthScore is the highest Strength.Score
+	MaxStrengthScore = 4
+
+	// maxStrengthRunes is the number of runes of a password that are analyzed
+	maxStrengthRunes = 100
+	// minGuessesBeforeGrowingSequence discourages splitting a password into more matches
+	minGuessesBeforeGrowingSequence = 1e4
+	minSubmatchGuessesSingleChar    = 10
+	minSubmatchGuessesMultiChar     = 50
+	bruteforceCardinality           = 10
+)
+
+// scoreThresholds are the guesses needed for each Strength.Score above 0
+var scoreThresholds = []float64{1e3 + 5, 1e6 + 5, 1e8 + 5, 1e10 + 5}
+
+// StrengthMatch is a guessable pattern in a password. Pattern is one of dictionary, spatial (a keyboard walk),
+// sequence, repeat, date, or bruteforce
+type StrengthMatch struct {
+	Pattern string
+	Token   string  // The matched part of the password
+	Guesses float64 // The estimated number of guesses needed to guess the token
+
+	i, j      int // The rune indexes of the token
+	rank      int
+	userInput bool
+	reversed  bool
+	l33t      bool
+	graph     string
+	turns     int
+	base      string
+	year      bool
+}
+
+// StrengthFeedback explains why a password is weak and how to improve it
+type StrengthFeedback struct {
+	Warning     string
+	Suggestions []string
+}
+
+// Strength is the estimated strength of a password
+type Strength struct {
+	Guesses   float64       // The estimated number of guesses needed to guess the password
+	Score     int           // From 0 (too guessable) to MaxStrengthScore (very unguessable)
+	CrackTime time.Duration // The estimated time to guess the password at StrengthGuessesPerSecond
+	Sequence  []StrengthMatch
+	Feedback  StrengthFeedback
+}
+
+// EstimateStrength estimates the number of guesses needed to crack a password, in the style of zxcvbn. The password is
+// split into the most guessable sequence of dictionary words (from the common password list and userInputs),
+// keyboard walks (qwerty, azerty, and dvorak), sequences, repeats, dates, l33t substitutions, and bruteforced
+// characters. userInputs are words an attacker may know about the user. e.g. their name or email address.
+// Only the first 100 runes of the password are analyzed
+func EstimateStrength(password string, userInputs ...string) Strength {
+	inputs := make(map[string]int, len(userInputs))
+	for i, input := range userInputs {
+		if input = strings.ToLower(input); input != "" {
+			if _, ok := inputs[input]; !ok {
+				inputs[input] = i + 1
+			}
+		}
+	}
+	runes := []rune(password)
+	if len(runes) > maxStrengthRunes {
+		runes = runes[:maxStrengthRunes]
+	}
+	return estimateStrength(runes, inputs, time.Now())
+}
+
+func estimateStrength(password []rune, userInputs map[string]int, now time.Time) Strength {
+	m := &strengthMatcher{password: password, lower: []rune(strings.ToLower(string(password))),
+		userInputs: userInputs, now: now}
+	if len(m.lower) != len(password) {
+		m.lower = make([]rune, len(password))
+		for i, r := range password {
+			m.lower[i] = unicode.ToLower(r)
+		}
+	}
+	guesses, sequence := m.mostGuessableSequence(m.matches())
+	s := Strength{Guesses: guesses, Sequence: sequence}
+	for s.Score < MaxStrengthScore && guesses >= scoreThresholds[s.Score] {
+		s.Score++
+	}
+	if seconds := guesses / StrengthGuessesPerSecond; seconds < math.MaxInt64/float64(time.Second) {
+		s.CrackTime = time.Duration(seconds * float64(time.Second))
+	} else {
+		s.CrackTime = math.MaxInt64
+	}
+	s.Feedback = strengthFeedback(s.Score, sequence)
+	return s
+}
+
+func factorial(n int) float64 {
+	result := 1.0
+	for i := 2; i <= n; i++ {
+		result *= float64(i)
+	}
+	return result
+}
+
+// mostGuessableSequence finds the sequence of non-overlapping matches covering the password that minimizes the
+// number of guesses. Gaps are filled with bruteforce matches
+func (m *strengthMatcher) mostGuessableSequence(matches []StrengthMatch) (float64, []StrengthMatch) {
+	n := len(m.password)
+	if n == 0 {
+		return 1, nil
+	}
+	byEnd := make([][]StrengthMatch, n)
+	for _, match := range matches {
+		if match.j-match.i+1 < n {
+			minGuesses := float64(minSubmatchGuessesMultiChar)
+			if match.i == match.j {
+				minGuesses = minSubmatchGuessesSingleChar
+			}
+			match.Guesses = math.Max(match.Guesses, minGuesses)
+		}
+		byEnd[match.j] = append(byEnd[match.j], match)
+	}
+
+	// For each end position k and sequence length l, the best last match, product of guesses, and total guesses
+	type candidate struct {
+		match StrengthMatch
+		pi    float64
+		g     float64
+	}
+	optimal := make([]map[int]candidate, n)
+	for k := range optimal {
+		optimal[k] = make(map[int]candidate)
+	}
+	update := func(match StrengthMatch, l int) {
+		k := match.j
+		pi := match.Guesses
+		if l > 1 {
+			pi *= optimal[match.i-1][l-1].pi
+		}
+		g := factorial(l)*pi + math.Pow(minGuessesBeforeGrowingSequence, float64(l-1))
+		for otherL, other := range optimal[k] {
+			if otherL <= l && other.g <= g {
+				return
+			}
+		}
+		optimal[k][l] = candidate{match: match, pi: pi, g: g}
+	}
+	bruteforce := func(i, j int) StrengthMatch {
+		guesses := math.Pow(bruteforceCardinality, float64(j-i+1))
+		if j-i+1 < n {
+			minGuesses := float64(minSubmatchGuessesMultiChar + 1)
+			if i == j {
+				minGuesses = minSubmatchGuessesSingleChar + 1
+			}
+			guesses = math.Max(guesses, minGuesses)
+		}
+		return m.newMatch("bruteforce", i, j, guesses)
+	}
+
+	for k := 0; k < n; k++ {
+		for _, match := range byEnd[k] {
+			if match.i == 0 {
+				update(match, 1)
+				continue
+			}
+			for l := range optimal[match.i-1] {
+				update(match, l+1)
+			}
+		}
+		update(bruteforce(0, k), 1)
+		for i := 1; i <= k; i++ {
+			for l, last := range optimal[i-1] {
+				if last.match.Pattern != "bruteforce" {
+					update(bruteforce(i, k), l+1)
+				}
+			}
+		}
+	}
+
+	bestL, best := 0, candidate{g: math.Inf(1)}
+	for l, c := range optimal[n-1] {
+		if c.g < best.g || (c.g == best.g && l < bestL) {
+			bestL, best = l, c
+		}
+	}
+	sequence := make([]StrengthMatch, bestL)
+	for k, l := n-1, bestL; l > 0; l-- {
+		match := optimal[k][l].match
+		sequence[l-1] = match
+		k = match.i - 1
+	}
+	return best.g, sequence
+}
+
+const defaultStrengthSuggestion = "Add another word or two; uncommon words are better"
+
+func strengthFeedback(score int, sequence []StrengthMatch) StrengthFeedback {
+	if len(sequence) == 0 {
+		return StrengthFeedback{Suggestions: []string{"Use a few words, avoid common phrases",
+			"No need for symbols, digits, or uppercase letters"}}
+	}
+	if score > 2 {
+		return StrengthFeedback{}
+	}
+	longest := sequence[0]
+	for _, match := range sequence[1:] {
+		if len(match.Token) > len(longest.Token) {
+			longest = match
+		}
+	}
+	feedback := matchFeedback(longest, len(sequence) == 1)
+	feedback.Suggestions = append([]string{defaultStrengthSuggestion}, feedback.Suggestions...)
+	return feedback
+}
+
+func matchFeedback(match StrengthMatch, soleMatch bool) StrengthFeedback {
+	switch match.Pattern {
+	case "dictionary":
+		return dictionaryFeedback(match, soleMatch)
+	case "spatial":
+		warning := "Short keyboard patterns are easy to guess"
+		if match.turns == 1 {
+			warning = "Straight rows of keys are easy to guess"
+		}
+		return StrengthFeedback{Warning: warning, Suggestions: []string{"Use a longer keyboard pattern with more turns"}}
+	case "repeat":
+		warning := `Repeats like "aaa" are easy to guess`
+		if len([]rune(match.base)) > 1 {
+			warning = `Repeats like "abcabcabc" are only slightly harder to guess than "abc"`
+		}
+		return StrengthFeedback{Warning: warning, Suggestions: []string{"Avoid repeated words and characters"}}
+	case "sequence":
+		return StrengthFeedback{Warning: "Sequences like abc or 6543 are easy to guess",
+			Suggestions: []string{"Avoid sequences"}}
+	case "date":
+		if match.year {
+			return StrengthFeedback{Warning: "Recent years are easy to guess",
+				Suggestions: []string{"Avoid recent years", "Avoid years that are associated with you"}}
+		}
+		return StrengthFeedback{Warning: "Dates are often easy to guess",
+			Suggestions: []string{"Avoid dates and years that are associated with you"}}
+	}
+	return StrengthFeedback{}
+}
+
+func dictionaryFeedback(match StrengthMatch, soleMatch bool) StrengthFeedback {
+	var feedback StrengthFeedback
+	switch {
+	case match.userInput:
+		feedback.Warning = "Avoid using personal information"
+	case soleMatch && !match.l33t && !match.reversed:
+		switch {
+		case match.rank <= 10:
+			feedback.Warning = "This is a top-10 common password"
+		case match.rank <= 100:
+			feedback.Warning = "This is a top-100 common password"
+		default:
+			feedback.Warning = "This is a very common password"
+		}
+	case match.Guesses <= 1e4:
+		feedback.Warning = "This is similar to a commonly used password"
+	}
+	token := []rune(match.Token)
+	rest := string(token[1:])
+	switch {
+	case unicode.IsUpper(token[0]) && rest == strings.ToLower(rest):
+		feedback.Suggestions = append(feedback.Suggestions, "Capitalization doesn't help very much")
+	case match.Token != strings.ToLower(match.Token) && match.Token == strings.ToUpper(match.Token):
+		feedback.Suggestions = append(feedback.Suggestions, "All-uppercase is almost as easy to guess as all-lowercase")
+	}
+	if match.reversed {
+		feedback.Suggestions = append(feedback.Suggestions, "Reversed words aren't much harder to guess")
+	}
+	if match.l33t {
+		feedback.Suggestions = append(feedback.Suggestions,
+			"Predictable substitutions like '@' instead of 'a' don't help very much")
+	}
+	return feedback
+}
+
+// MinimumStrength is a PasswordPolicy that ensures that the password's estimated Strength has at least the minimum
+// Score. See EstimateStrength
+type MinimumStrength struct {
+	Score int // The minimum Score from 0 to MaxStrengthScore. 3 is recommended
+}
+
+// PasswordAcceptable accepts passwords whose estimated Strength has at least the minimum Score. A WeakPasswordError
+// explaining why the password is weak is returned otherwise
+func (pp MinimumStrength) PasswordAcceptable(password string) error {
+	if strength := EstimateStrength(password); strength.Score < pp.Score {
+		return WeakPasswordError{Strength: strength, MinimumScore: pp.Score}
+	}
+	return nil
+}
@@ -0,0 +1,465 @@
+package passhash
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	minDictionaryMatchLen = 4
+	maxDictionaryMatchLen = 32
+	minSpatialMatchLen    = 3
+	minSequenceMatchLen   = 3
+	maxSequenceDelta      = 5
+	minYearSpace          = 20
+	minDateYear           = 1000
+	maxDateYear           = 2050
+)
+
+// keyboardLayout describes a keyboard's rows of unshifted and shifted keys. Each row is offset by the horizontal
+// position of its first key, in key widths, to model the stagger between rows
+type keyboardLayout struct {
+	rows    [4]string
+	shifted [4]string
+	offsets [4]float64
+}
+
+var keyboardLayouts = map[string]keyboardLayout{
+	"qwerty": {
+		rows:    [4]string{"`1234567890-=", "qwertyuiop[]\\", "asdfghjkl;'", "zxcvbnm,./"},
+		shifted: [4]string{"~!@#$%^&*()_+", "QWERTYUIOP{}|", "ASDFGHJKL:\"", "ZXCVBNM<>?"},
+		offsets: [4]float64{0, 1.5, 1.75, 2.25},
+	},
+	"azerty": {
+		rows:    [4]string{"²&é\"'(-è_çà)=", "azertyuiop^$", "qsdfghjklmù*", "<wxcvbn,;:!"},
+		shifted: [4]string{"²1234567890°+", "AZERTYUIOP¨£", "QSDFGHJKLM%µ", ">WXCVBN?./§"},
+		offsets: [4]float64{0, 1.5, 1.75, 1.25},
+	},
+	"dvorak": {
+		rows:    [4]string{"`1234567890[]", "',.pyfgcrl/=\\", "aoeuidhtns-", ";qjkxbmwvz"},
+		shifted: [4]string{"~!@#$%^&*(){}", "\"<>PYFGCRL?+|", "AOEUIDHTNS_", ":QJKXBMWVZ"},
+		offsets: [4]float64{0, 1.5, 1.75, 2.25},
+	},
+}
+
+type keyPosition struct {
+	row int
+	x   float64
+}
+
+// keyboardGraph is the adjacency of the keys of a keyboardLayout
+type keyboardGraph struct {
+	name      string
+	positions map[rune]keyPosition
+	shifted   map[rune]bool
+	keys      int     // The number of keys
+	degree    float64 // The average number of neighbors of a key
+}
+
+func newKeyboardGraph(name string, layout keyboardLayout) *keyboardGraph {
+	g := &keyboardGraph{name: name, positions: make(map[rune]keyPosition), shifted: make(map[rune]bool)}
+	var positions []keyPosition
+	for row := range layout.rows {
+		shifted := []rune(layout.shifted[row])
+		for col, r := range []rune(layout.rows[row]) {
+			pos := keyPosition{row: row, x: layout.offsets[row] + float64(col)}
+			positions = append(positions, pos)
+			if _, ok := g.positions[r]; !ok {
+				g.positions[r] = pos
+			}
+			if _, ok := g.positions[shifted[col]]; !ok {
+				g.positions[shifted[col]] = pos
+				g.shifted[shifted[col]] = shifted[col] != r
+			}
+		}
+	}
+	neighbors := 0
+	for _, a := range positions {
+		for _, b := range positions {
+			if _, ok := keyDirection(a, b); ok {
+				neighbors++
+			}
+		}
+	}
+	g.keys = len(positions)
+	g.degree = float64(neighbors) / float64(len(positions))
+	return g
+}
+
+// keyDirection returns the direction from key a to key b if they're adjacent
+func keyDirection(a, b keyPosition) (int, bool) {
+	dr, dx := b.row-a.row, b.x-a.x
+	if (dr == 0 && math.Abs(dx) == 1) || (math.Abs(float64(dr)) == 1 && math.Abs(dx) < 1) {
+		sign := 0
+		if dx > 0 {
+			sign = 1
+		}
+		return (dr+1)*2 + sign, true
+	}
+	return 0, false
+}
+
+var keyboardGraphs = func() []*keyboardGraph {
+	graphs := make([]*keyboardGraph, 0, len(keyboardLayouts))
+	for _, name := range []string{"qwerty", "azerty", "dvorak"} {
+		graphs = append(graphs, newKeyboardGraph(name, keyboardLayouts[name]))
+	}
+	return graphs
+}()
+
+// binomial returns n choose k
+func binomial(n, k int) float64 {
+	if k > n {
+		return 0
+	}
+	result := 1.0
+	for i := 1; i <= k; i++ {
+		result *= float64(n-k+i) / float64(i)
+	}
+	return result
+}
+
+// variations returns the number of ways a and b occurrences of two alternatives can be arranged, with at least one
+// of the less common alternative
+func variations(a, b int) float64 {
+	if a == 0 || b == 0 {
+		return 2
+	}
+	sum := 0.0
+	for i := 1; i <= min(a, b); i++ {
+		sum += binomial(a+b, i)
+	}
+	return sum
+}
+
+func uppercaseVariations(token []rune) float64 {
+	upper, lower := 0, 0
+	for _, r := range token {
+		if unicode.IsUpper(r) {
+			upper++
+		} else if unicode.IsLower(r) {
+			lower++
+		}
+	}
+	if upper == 0 {
+		return 1
+	}
+	first, last := unicode.IsUpper(token[0]), unicode.IsUpper(token[len(token)-1])
+	if lower == 0 || (upper == 1 && (first || last)) {
+		return 2
+	}
+	return variations(upper, lower)
+}
+
+func l33tVariations(token, word []rune) float64 {
+	result := 1.0
+	seen := make(map[rune]bool)
+	for i, r := range token {
+		r = unicode.ToLower(r)
+		if r == word[i] || seen[r] {
+			continue
+		}
+		seen[r] = true
+		subbed, unsubbed := 0, 0
+		for _, c := range token {
+			switch unicode.ToLower(c) {
+			case r:
+				subbed++
+			case word[i]:
+				unsubbed++
+			}
+		}
+		result *= variations(subbed, unsubbed)
+	}
+	return result
+}
+
+type strengthMatcher struct {
+	password   []rune
+	lower      []rune
+	userInputs map[string]int
+	now        time.Time
+}
+
+func (m *strengthMatcher) newMatch(pattern string, i, j int, guesses float64) StrengthMatch {
+	return StrengthMatch{Pattern: pattern, Token: string(m.password[i : j+1]), Guesses: guesses, i: i, j: j}
+}
+
+func (m *strengthMatcher) matches() []StrengthMatch {
+	var matches []StrengthMatch
+	matches = append(matches, m.dictionaryMatches()...)
+	matches = append(matches, m.spatialMatches()...)
+	matches = append(matches, m.sequenceMatches()...)
+	matches = append(matches, m.repeatMatches()...)
+	matches = append(matches, m.yearMatches()...)
+	matches = append(matches, m.dateMatches()...)
+	return matches
+}
+
+// lookup returns the rank of a word in the user inputs or the common password list
+func (m *strengthMatcher) lookup(word string) (int, bool, bool) {
+	if rank, ok := m.userInputs[word]; ok {
+		return rank, true, true
+	}
+	rank, ok := loadCommonPasswords().folded[word]
+	return rank + 1, false, ok
+}
+
+func reverseRunes(runes []rune) []rune {
+	reversed := make([]rune, len(runes))
+	for i, r := range runes {
+		reversed[len(runes)-1-i] = r
+	}
+	return reversed
+}
+
+// dictionaryCandidate is a form of a token that's looked up in the dictionaries
+type dictionaryCandidate struct {
+	word     []rune
+	reversed bool
+	l33t     bool
+}
+
+func (m *strengthMatcher) dictionaryMatches() []StrengthMatch {
+	var matches []StrengthMatch
+	for i := range m.lower {
+		for j := i + minDictionaryMatchLen - 1; j < min(len(m.lower), i+maxDictionaryMatchLen); j++ {
+			token := m.password[i : j+1]
+			word := m.lower[i : j+1]
+			candidates := []dictionaryCandidate{{word: word}, {word: reverseRunes(word), reversed: true}}
+			for _, r := range leetReplacers {
+				if unleeted := []rune(r.Replace(string(word))); string(unleeted) != string(word) {
+					candidates = append(candidates, dictionaryCandidate{word: unleeted, l33t: true})
+				}
+			}
+			for _, c := range candidates {
+				rank, userInput, ok := m.lookup(string(c.word))
+				if !ok || (c.reversed && string(c.word) == string(word)) {
+					continue
+				}
+				guesses := float64(rank) * uppercaseVariations(token)
+				if c.reversed {
+					guesses *= 2
+				}
+				if c.l33t {
+					guesses *= l33tVariations(word, c.word)
+				}
+				match := m.newMatch("dictionary", i, j, guesses)
+				match.rank, match.userInput, match.reversed, match.l33t = rank, userInput, c.reversed, c.l33t
+				matches = append(matches, match)
+			}
+		}
+	}
+	return matches
+}
+
+func (m *strengthMatcher) spatialMatches() []StrengthMatch {
+	var matches []StrengthMatch
+	for _, g := range keyboardGraphs {
+		for i := 0; i < len(m.password); {
+			j, turns, shifted, lastDir := i, 0, 0, -1
+			if g.shifted[m.password[i]] {
+				shifted++
+			}
+			for ; j+1 < len(m.password); j++ {
+				a, aok := g.positions[m.password[j]]
+				b, bok := g.positions[m.password[j+1]]
+				if !aok || !bok {
+					break
+				}
+				dir, ok := keyDirection(a, b)
+				if !ok {
+					break
+				}
+				if dir != lastDir {
+					turns++
+					lastDir = dir
+				}
+				if g.shifted[m.password[j+1]] {
+					shifted++
+				}
+			}
+			if length := j - i + 1; length >= minSpatialMatchLen {
+				guesses := 0.0
+				for l := 2; l <= length; l++ {
+					for t := 1; t <= min(turns, l-1); t++ {
+						guesses += binomial(l-1, t-1) * float64(g.keys) * math.Pow(g.degree, float64(t))
+					}
+				}
+				if shifted > 0 {
+					guesses *= variations(shifted, length-shifted)
+				}
+				match := m.newMatch("spatial", i, j, guesses)
+				match.graph, match.turns = g.name, turns
+				matches = append(matches, match)
+			}
+			i = j + 1
+		}
+	}
+	return matches
+}
+
+func (m *strengthMatcher) sequenceMatches() []StrengthMatch {
+	var matches []StrengthMatch
+	for i := 0; i+minSequenceMatchLen <= len(m.password); {
+		delta := m.password[i+1] - m.password[i]
+		j := i + 1
+		for j+1 < len(m.password) && m.password[j+1]-m.password[j] == delta {
+			j++
+		}
+		if delta != 0 && math.Abs(float64(delta)) <= maxSequenceDelta && j-i+1 >= minSequenceMatchLen {
+			base := 26.0
+			switch first := m.password[i]; {
+			case strings.ContainsRune("aAzZ019", first):
+				base = 4
+			case unicode.IsDigit(first):
+				base = 10
+			}
+			if delta < 0 {
+				base *= 2
+			}
+			matches = append(matches, m.newMatch("sequence", i, j, base*float64(j-i+1)))
+			i = j
+		} else {
+			i++
+		}
+	}
+	return matches
+}
+
+func (m *strengthMatcher) repeatMatches() []StrengthMatch {
+	var matches []StrengthMatch
+	for i := 0; i < len(m.password); {
+		bestUnit, bestCount := 0, 0
+		for unit := 1; i+2*unit <= len(m.password); unit++ {
+			count := 1
+			for i+(count+1)*unit <= len(m.password) &&
+				string(m.password[i+count*unit:i+(count+1)*unit]) == string(m.password[i:i+unit]) {
+				count++
+			}
+			if count > 1 && count*unit > bestCount*bestUnit {
+				bestUnit, bestCount = unit, count
+			}
+		}
+		if bestCount < 2 || bestUnit*bestCount < 3 {
+			i++
+			continue
+		}
+		base := string(m.password[i : i+bestUnit])
+		baseGuesses := estimateStrength([]rune(base), nil, m.now).Guesses
+		j := i + bestUnit*bestCount - 1
+		match := m.newMatch("repeat", i, j, baseGuesses*float64(bestCount))
+		match.base = base
+		matches = append(matches, match)
+		i = j + 1
+	}
+	return matches
+}
+
+func (m *strengthMatcher) yearSpace(year int) float64 {
+	return math.Max(math.Abs(float64(year-m.now.Year())), minYearSpace)
+}
+
+func (m *strengthMatcher) yearMatches() []StrengthMatch {
+	var matches []StrengthMatch
+	for i := 0; i+4 <= len(m.password); i++ {
+		year, err := strconv.Atoi(string(m.password[i : i+4]))
+		if err != nil || year < 1900 || year > 2099 || !isDigits(m.password[i:i+4]) {
+			continue
+		}
+		match := m.newMatch("date", i, i+3, m.yearSpace(year))
+		match.year = true
+		matches = append(matches, match)
+	}
+	return matches
+}
+
+func isDigits(runes []rune) bool {
+	for _, r := range runes {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// dateSplits are the positions that split dates without separators into day, month, and year, by date length
+var dateSplits = map[int][][2]int{
+	4: {{1, 2}, {2, 3}},
+	5: {{1, 3}, {2, 3}},
+	6: {{1, 2}, {2, 4}, {4, 5}},
+	7: {{1, 3}, {2, 3}, {4, 5}, {4, 6}},
+	8: {{2, 4}, {4, 6}},
+}
+
+// dateYear returns the year of day, month, and year parts in any common order
+func dateYear(parts [3]int) (int, bool) {
+	for _, order := range [][3]int{{2, 0, 1}, {0, 1, 2}} {
+		year, a, b := parts[order[0]], parts[order[1]], parts[order[2]]
+		if year < 100 {
+			if year > 50 {
+				year += 1900
+			} else {
+				year += 2000
+			}
+		}
+		if year < minDateYear || year > maxDateYear {
+			continue
+		}
+		if (a >= 1 && a <= 31 && b >= 1 && b <= 12) || (a >= 1 && a <= 12 && b >= 1 && b <= 31) {
+			return year, true
+		}
+	}
+	return 0, false
+}
+
+func (m *strengthMatcher) dateMatches() []StrengthMatch {
+	var matches []StrengthMatch
+	for i := range m.password {
+		for j := i + 3; j < min(len(m.password), i+10); j++ {
+			token := m.password[i : j+1]
+			var candidates [][3]int
+			separator := false
+			if isDigits(token) {
+				for _, split := range dateSplits[len(token)] {
+					a, _ := strconv.Atoi(string(token[:split[0]]))
+					b, _ := strconv.Atoi(string(token[split[0]:split[1]]))
+					c, _ := strconv.Atoi(string(token[split[1]:]))
+					candidates = append(candidates, [3]int{a, b, c})
+				}
+			} else if parts := strings.FieldsFunc(string(token), func(r rune) bool {
+				return strings.ContainsRune("/\\_.- ", r)
+			}); len(parts) == 3 && len(token) >= 6 {
+				separator = true
+				var candidate [3]int
+				valid := true
+				for k, part := range parts {
+					n, err := strconv.Atoi(part)
+					valid = valid && err == nil && len(part) <= 4 && isDigits([]rune(part))
+					candidate[k] = n
+				}
+				if valid && isDigits(token[:1]) && isDigits(token[len(token)-1:]) {
+					candidates = append(candidates, candidate)
+				}
+			}
+			bestYear, found := 0, false
+			for _, candidate := range candidates {
+				if year, ok := dateYear(candidate); ok && (!found || m.yearSpace(year) < m.yearSpace(bestYear)) {
+					bestYear, found = year, true
+				}
+			}
+			if !found {
+				continue
+			}
+			guesses := m.yearSpace(bestYear) * 365
+			if separator {
+				guesses *= 4
+			}
+			matches = append(matches, m.newMatch("date", i, j, guesses))
+		}
+	}
+	return matches
+}
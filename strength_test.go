@@ -0,0 +1,132 @@
+package passhash_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/dhui/passhash"
+)
+
+func strengthPatterns(s passhash.Strength) string {
+	patterns := make([]string, 0, len(s.Sequence))
+	for _, match := range s.Sequence {
+		patterns = append(patterns, match.Pattern+":"+match.Token)
+	}
+	return strings.Join(patterns, " ")
+}
+
+func TestEstimateStrengthPatterns(t *testing.T) {
+	for password, expected := range map[string]string{
+		"password":     "dictionary:password",
+		"p4ssw0rd":     "dictionary:p4ssw0rd",
+		"drowssap":     "dictionary:drowssap",
+		"qwertgfdsa":   "spatial:qwertgfdsa",
+		"aoeuidhtns":   "spatial:aoeuidhtns",
+		"wxcvbn,;:":    "spatial:wxcvbn,;:",
+		"lmnopqrs":     "sequence:lmnopqrs",
+		"97531":        "sequence:97531",
+		"zzzzzzzz":     "repeat:zzzzzzzz",
+		"xkcdxkcdxkcd": "repeat:xkcdxkcdxkcd",
+		"1987":         "date:1987",
+		"31-12-1987":   "date:31-12-1987",
+		"06121987":     "date:06121987",
+	} {
+		if patterns := strengthPatterns(passhash.EstimateStrength(password)); patterns != expected {
+			t.Errorf("Unexpected patterns for %q. %s != %s", password, patterns, expected)
+		}
+	}
+}
+
+func TestEstimateStrengthScores(t *testing.T) {
+	for password, expected := range map[string]int{
+		"":                       0,
+		"password":               0,
+		"qwerty1":                0,
+		"Tr0ub4dor":              3,
+		"x7#Kq!v9Lm2$":           4,
+		"correct horse battery!": 4,
+	} {
+		if s := passhash.EstimateStrength(password); s.Score != expected {
+			t.Errorf("Unexpected score for %q. %d != %d (%s)", password, s.Score, expected, strengthPatterns(s))
+		}
+	}
+}
+
+func TestEstimateStrengthUserInputs(t *testing.T) {
+	without := passhash.EstimateStrength("gopher1987")
+	with := passhash.EstimateStrength("gopher1987", "Gopher", "gopher@example.com")
+	if with.Guesses >= without.Guesses {
+		t.Errorf("User inputs didn't reduce guesses. %v >= %v", with.Guesses, without.Guesses)
+	}
+	if with.Feedback.Warning != "Avoid using personal information" {
+		t.Errorf("Unexpected warning: %q", with.Feedback.Warning)
+	}
+}
+
+func TestEstimateStrengthCrackTime(t *testing.T) {
+	s := passhash.EstimateStrength("x7#Kq!v9")
+	if expected := s.Guesses / passhash.StrengthGuessesPerSecond; s.CrackTime.Seconds() != expected {
+		t.Errorf("Unexpected crack time. %v != %vs", s.CrackTime, expected)
+	}
+	if s := passhash.EstimateStrength(strings.Repeat("x7#Kq!v9", 20)); s.CrackTime <= 0 {
+		t.Error("Crack time overflowed", s.CrackTime)
+	}
+}
+
+func TestEstimateStrengthFeedback(t *testing.T) {
+	for password, warning := range map[string]string{
+		"password":   "This is a top-10 common password",
+		"P@ssw0rd":   "This is similar to a commonly used password",
+		"qwertgfdsa": "Short keyboard patterns are easy to guess",
+		"zzzzzzzz":   `Repeats like "aaa" are easy to guess`,
+		"lmnopqrs":   "Sequences like abc or 6543 are easy to guess",
+		"31-12-1987": "Dates are often easy to guess",
+	} {
+		feedback := passhash.EstimateStrength(password).Feedback
+		if feedback.Warning != warning {
+			t.Errorf("Unexpected warning for %q. %q != %q", password, feedback.Warning, warning)
+		}
+		if len(feedback.Suggestions) == 0 {
+			t.Errorf("No suggestions for %q", password)
+		}
+	}
+	if feedback := passhash.EstimateStrength("x7#Kq!v9Lm2$").Feedback; feedback.Warning != "" ||
+		len(feedback.Suggestions) != 0 {
+		t.Errorf("Feedback for a strong password: %+v", feedback)
+	}
+}
+
+func TestMinimumStrength(t *testing.T) {
+	pp := passhash.MinimumStrength{Score: 3}
+	if err := pp.PasswordAcceptable("x7#Kq!v9Lm2$"); err != nil {
+		t.Error("Strong password was rejected", err)
+	}
+	err := pp.PasswordAcceptable("Password")
+	var weakErr passhash.WeakPasswordError
+	if !errors.Is(err, passhash.ErrWeakPassword) || !errors.As(err, &weakErr) {
+		t.Fatal("Expected WeakPasswordError. Got:", err)
+	}
+	if weakErr.MinimumScore != 3 || weakErr.Strength.Score != 0 {
+		t.Errorf("Unexpected WeakPasswordError: %+v", weakErr)
+	}
+	expected := "Password is too weak (score 0 of 4, minimum 3). This is a top-10 common password. " +
+		"Add another word or two; uncommon words are better. Capitalization doesn't help very much"
+	if err.Error() != expected {
+		t.Errorf("Unexpected error message. %s != %s", err.Error(), expected)
+	}
+}
+
+func TestMinimumStrengthPasswordPoliciesNotMet(t *testing.T) {
+	config := passhash.DefaultConfig
+	config.PasswordPolicies = []passhash.PasswordPolicy{passhash.AtLeastNRunes{N: 4},
+		passhash.MinimumStrength{Score: 3}}
+	_, err := config.NewCredential(passhash.UserID(1), "qwerty123")
+	var weakErr passhash.WeakPasswordError
+	if !errors.As(err, &weakErr) {
+		t.Fatal("Expected WeakPasswordError to be unwrapped from the PasswordPoliciesNotMet. Got:", err)
+	}
+	if weakErr.Strength.Feedback.Warning == "" {
+		t.Error("WeakPasswordError doesn't explain why the password is weak")
+	}
+}
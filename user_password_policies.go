@@ -0,0 +1,207 @@
+package passhash
+
+import (
+	"context"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	defaultNotUserInfoMaxDistance = 2
+	defaultNotUserInfoMinLength   = 3
+)
+
+// UserAttributes are values that an attacker may know about a user, and that shouldn't be used in their password
+type UserAttributes struct {
+	Username    string
+	Email       string
+	DisplayName string
+	AppName     string   // The name of the application or service
+	Other       []string // Any other values. e.g. the user's birthday, company, or a user ID that's shown to users
+}
+
+// userAttribute is a named value of the UserAttributes
+type userAttribute struct {
+	name  string
+	value string
+	word  bool // The value is a single word of a longer attribute, so it's only matched as a whole word
+}
+
+// values returns the lowercase values of the user's attributes, including the local part of the email and each word of
+// the display and app names
+func (a UserAttributes) values() []userAttribute {
+	attributes := []userAttribute{{name: "username", value: a.Username}, {name: "email", value: a.Email},
+		{name: "display name", value: a.DisplayName}, {name: "app name", value: a.AppName}}
+	if local, _, ok := strings.Cut(a.Email, "@"); ok {
+		attributes = append(attributes, userAttribute{name: "email", value: local})
+	}
+	for _, word := range strings.Fields(a.DisplayName) {
+		attributes = append(attributes, userAttribute{name: "display name", value: word, word: true})
+	}
+	for _, word := range strings.Fields(a.AppName) {
+		attributes = append(attributes, userAttribute{name: "app name", value: word, word: true})
+	}
+	for _, other := range a.Other {
+		attributes = append(attributes, userAttribute{name: "other attribute", value: other})
+	}
+	values := attributes[:0]
+	for _, attribute := range attributes {
+		if attribute.value = strings.ToLower(strings.TrimSpace(attribute.value)); attribute.value != "" {
+			values = append(values, attribute)
+		}
+	}
+	return values
+}
+
+// inputs returns the values of the user's attributes
+func (a UserAttributes) inputs() []string {
+	values := a.values()
+	inputs := make([]string, 0, len(values))
+	for _, attribute := range values {
+		inputs = append(inputs, attribute.value)
+	}
+	return inputs
+}
+
+type userAttributesContextKey struct{}
+
+// WithUserAttributes returns a copy of the context with the user's attributes for UserPasswordPolicies. e.g. pass the
+// context to Authenticator.Register or Authenticator.ChangePassword
+func WithUserAttributes(ctx context.Context, attributes UserAttributes) context.Context {
+	return context.WithValue(ctx, userAttributesContextKey{}, attributes)
+}
+
+func userAttributesFromContext(ctx context.Context) UserAttributes {
+	attributes, _ := ctx.Value(userAttributesContextKey{}).(UserAttributes)
+	return attributes
+}
+
+// UserPasswordPolicy is a PasswordPolicy that also considers who the password belongs to. The Config calls
+// UserPasswordAcceptable instead of PasswordAcceptable with the UserID and the UserAttributes from the context (see
+// WithUserAttributes) or Config.NewCredentialWithAttributes. PasswordPolicies that don't implement UserPasswordPolicy
+// are still checked with PasswordAcceptable
+type UserPasswordPolicy interface {
+	PasswordPolicy
+	UserPasswordAcceptable(ctx context.Context, userID UserID, attributes UserAttributes, password string) error
+}
+
+// checkPasswordPolicies checks the password against the Config's PasswordPolicies
+func (c Config) checkPasswordPolicies(ctx context.Context, userID UserID, password string) error {
+	attributes := userAttributesFromContext(ctx)
+	passwordPolicyFailures := PasswordPoliciesNotMet{}
+	for _, pp := range c.PasswordPolicies {
+		var err error
+		if upp, ok := pp.(UserPasswordPolicy); ok {
+			err = upp.UserPasswordAcceptable(ctx, userID, attributes, password)
+		} else {
+			err = pp.PasswordAcceptable(password)
+		}
+		if err != nil {
+			passwordPolicyFailures.UnMetPasswordPolicies = append(passwordPolicyFailures.UnMetPasswordPolicies,
+				PasswordPolicyError{PasswordPolicy: pp, Err: err})
+		}
+	}
+	if len(passwordPolicyFailures.UnMetPasswordPolicies) > 0 {
+		return passwordPolicyFailures
+	}
+	return nil
+}
+
+// NotUserInfo is a UserPasswordPolicy that rejects passwords containing, or within a small edit distance of, the
+// user's attributes. Leetspeak substitutions are undone before checking. e.g. "alice2024" and "@l1ce" are rejected for
+// the username alice. The words of the display and app names are only matched as whole words, i.e. not next to other
+// letters, so "planning" is accepted for the display name Ann Lee. The user ID isn't checked unless it's one of the
+// UserAttributes
+type NotUserInfo struct {
+	MaxDistance int // The maximum Levenshtein distance of a rejected password. Defaults to 2
+	MinLength   int // Attribute values shorter than MinLength runes are ignored. Defaults to 3
+}
+
+// PasswordAcceptable accepts all passwords since there's no user information to check
+func (pp NotUserInfo) PasswordAcceptable(string) error {
+	return nil
+}
+
+// UserPasswordAcceptable accepts passwords that don't contain and aren't similar to the user's attributes
+func (pp NotUserInfo) UserPasswordAcceptable(_ context.Context, _ UserID, attributes UserAttributes,
+	password string) error {
+	maxDistance, minLength := pp.MaxDistance, pp.MinLength
+	if maxDistance <= 0 {
+		maxDistance = defaultNotUserInfoMaxDistance
+	}
+	if minLength <= 0 {
+		minLength = defaultNotUserInfoMinLength
+	}
+	lower := strings.ToLower(password)
+	forms := []string{lower}
+	for _, r := range leetReplacers {
+		forms = append(forms, r.Replace(lower))
+	}
+	for _, attribute := range attributes.values() {
+		if utf8.RuneCountInString(attribute.value) < minLength {
+			continue
+		}
+		for _, form := range forms {
+			if attribute.word && containsWord(form, attribute.value) {
+				return UserInfoPasswordError{Attribute: attribute.name}
+			}
+			if !attribute.word && (strings.Contains(form, attribute.value) ||
+				levenshtein(form, attribute.value) <= maxDistance) {
+				return UserInfoPasswordError{Attribute: attribute.name}
+			}
+		}
+	}
+	return nil
+}
+
+// containsWord determines if s contains the word with no letters immediately before or after it
+func containsWord(s, word string) bool {
+	for i := 0; i <= len(s)-len(word); {
+		j := strings.Index(s[i:], word)
+		if j < 0 {
+			return false
+		}
+		start, end := i+j, i+j+len(word)
+		before, _ := utf8.DecodeLastRuneInString(s[:start])
+		after, _ := utf8.DecodeRuneInString(s[end:])
+		if !unicode.IsLetter(before) && !unicode.IsLetter(after) {
+			return true
+		}
+		_, size := utf8.DecodeRuneInString(s[start:])
+		i = start + size
+	}
+	return false
+}
+
+// UserPasswordAcceptable accepts passwords whose estimated Strength has at least the minimum Score, treating the
+// user's attributes as words an attacker knows
+func (pp MinimumStrength) UserPasswordAcceptable(_ context.Context, _ UserID, attributes UserAttributes,
+	password string) error {
+	if strength := EstimateStrength(password, attributes.inputs()...); strength.Score < pp.Score {
+		return WeakPasswordError{Strength: strength, MinimumScore: pp.Score}
+	}
+	return nil
+}
+
+// levenshtein returns the edit distance between a and b
+func levenshtein(a, b string) int {
+	ar, br := []rune(a), []rune(b)
+	prev := make([]int, len(br)+1)
+	curr := make([]int, len(br)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ar); i++ {
+		curr[0] = i
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(br)]
+}
@@ -0,0 +1,153 @@
+package passhash_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/dhui/passhash"
+)
+
+var testUserAttributes = passhash.UserAttributes{
+	Username:    "alice",
+	Email:       "wonderland.fan@example.com",
+	DisplayName: "Alice Liddell",
+	AppName:     "Looking Glass",
+	Other:       []string{"cheshire"},
+}
+
+func TestNotUserInfoRejected(t *testing.T) {
+	for password, attribute := range map[string]string{
+		"alice2024":        "username",
+		"@l1ce":            "username",
+		"alicee":           "username",
+		"xWonderland.Fan1": "email",
+		"liddell!!":        "display name",
+		"glass-house":      "app name",
+		"ch3sh1r3cat":      "other attribute",
+	} {
+		err := passhash.NotUserInfo{}.UserPasswordAcceptable(context.Background(), passhash.UserID(12345),
+			testUserAttributes, password)
+		var uiErr passhash.UserInfoPasswordError
+		if !errors.Is(err, passhash.ErrPasswordContainsUserInfo) || !errors.As(err, &uiErr) {
+			t.Errorf("Password %q containing user info was accepted: %v", password, err)
+			continue
+		}
+		if uiErr.Attribute != attribute {
+			t.Errorf("Unexpected attribute for %q. %s != %s", password, uiErr.Attribute, attribute)
+		}
+	}
+}
+
+func TestNotUserInfoAccepted(t *testing.T) {
+	pp := passhash.NotUserInfo{}
+	for _, password := range []string{testPassword, "correct horse battery staple", "x7#Kq!v9"} {
+		if err := pp.UserPasswordAcceptable(context.Background(), passhash.UserID(12345), testUserAttributes,
+			password); err != nil {
+			t.Errorf("Password %q was rejected: %v", password, err)
+		}
+	}
+	if err := pp.PasswordAcceptable("alice"); err != nil {
+		t.Error("Password was rejected without user info", err)
+	}
+}
+
+func TestNotUserInfoWords(t *testing.T) {
+	for password, attributes := range map[string]passhash.UserAttributes{
+		"planning-ahead":  {DisplayName: "Ann Lee"},
+		"fleet-footed":    {DisplayName: "Ann Lee"},
+		"happy-go-lucky":  {AppName: "My App"},
+		"x7#Kq!v9-100abc": {},
+	} {
+		if err := (passhash.NotUserInfo{}).UserPasswordAcceptable(context.Background(), passhash.UserID(100),
+			attributes, password); err != nil {
+			t.Errorf("Password %q was rejected for %+v: %v", password, attributes, err)
+		}
+	}
+	for password, attributes := range map[string]passhash.UserAttributes{
+		"ann-2024!":       {DisplayName: "Ann Lee"},
+		"lee4ever":        {DisplayName: "Ann Lee"},
+		"my-app-password": {AppName: "My App"},
+		"x7#Kq!v9-100abc": {Other: []string{"100"}},
+	} {
+		if err := (passhash.NotUserInfo{}).UserPasswordAcceptable(context.Background(), passhash.UserID(100),
+			attributes, password); !errors.Is(err, passhash.ErrPasswordContainsUserInfo) {
+			t.Errorf("Password %q was accepted for %+v: %v", password, attributes, err)
+		}
+	}
+}
+
+func TestNotUserInfoOptions(t *testing.T) {
+	attributes := passhash.UserAttributes{Username: "bob"}
+	if err := (passhash.NotUserInfo{MinLength: 4}).UserPasswordAcceptable(context.Background(), passhash.UserID(1),
+		attributes, "bob12345"); err != nil {
+		t.Error("Attribute shorter than MinLength was checked", err)
+	}
+	attributes.Username = "robert"
+	if err := (passhash.NotUserInfo{}).UserPasswordAcceptable(context.Background(), passhash.UserID(1), attributes,
+		"roberta"); err == nil {
+		t.Error("Password within the default MaxDistance was accepted")
+	}
+	if err := (passhash.NotUserInfo{MaxDistance: 1}).UserPasswordAcceptable(context.Background(), passhash.UserID(1),
+		attributes, "rebort"); err != nil {
+		t.Error("Password outside of MaxDistance was rejected", err)
+	}
+}
+
+func TestNewCredentialWithAttributes(t *testing.T) {
+	config := passhash.DefaultConfig
+	config.PasswordPolicies = []passhash.PasswordPolicy{passhash.AtLeastNRunes{N: 8}, passhash.NotUserInfo{}}
+	if _, err := config.NewCredentialWithAttributes(passhash.UserID(1), testPassword, testUserAttributes); err != nil {
+		t.Fatal("Unable to create Credential", err)
+	}
+	if _, err := config.NewCredential(passhash.UserID(1), "alice2024"); err != nil {
+		t.Error("Password was rejected without user attributes", err)
+	}
+	_, err := config.NewCredentialWithAttributes(passhash.UserID(1), "alice", testUserAttributes)
+	var policiesErr passhash.PasswordPoliciesNotMet
+	if !errors.As(err, &policiesErr) || len(policiesErr.UnMetPasswordPolicies) != 2 {
+		t.Fatal("Expected both PasswordPolicies to be unmet. Got:", err)
+	}
+	var uiErr passhash.UserInfoPasswordError
+	if !errors.As(err, &uiErr) || uiErr.Attribute != "username" {
+		t.Error("Expected UserInfoPasswordError to be unwrapped from the PasswordPoliciesNotMet. Got:", err)
+	}
+}
+
+func TestAuthenticatorUserAttributes(t *testing.T) {
+	authenticator, _, _ := newTestAuthenticator(t)
+	config := authenticator.Config()
+	config.PasswordPolicies = []passhash.PasswordPolicy{passhash.NotUserInfo{}}
+	authenticator, err := passhash.NewAuthenticator(config)
+	if err != nil {
+		t.Fatal("Unable to create Authenticator", err)
+	}
+	ctx := passhash.WithUserAttributes(context.Background(), testUserAttributes)
+	if err := authenticator.Register(ctx, passhash.UserID(1), "Alice123!"); !errors.Is(err,
+		passhash.ErrPasswordContainsUserInfo) {
+		t.Fatal("Expected ErrPasswordContainsUserInfo. Got:", err)
+	}
+	if err := authenticator.Register(ctx, passhash.UserID(1), testPassword); err != nil {
+		t.Fatal("Unable to register", err)
+	}
+	if err := authenticator.ChangePassword(ctx, passhash.UserID(1), testPassword, "liddell-2024",
+		nil); !errors.Is(err, passhash.ErrPasswordContainsUserInfo) {
+		t.Error("Expected ErrPasswordContainsUserInfo. Got:", err)
+	}
+}
+
+func TestMinimumStrengthUserAttributes(t *testing.T) {
+	pp := passhash.MinimumStrength{Score: 3}
+	password := "cheshire1865"
+	if err := pp.PasswordAcceptable(password); err != nil {
+		t.Fatal("Password was rejected without user attributes", err)
+	}
+	err := pp.UserPasswordAcceptable(context.Background(), passhash.UserID(1), testUserAttributes, password)
+	var weakErr passhash.WeakPasswordError
+	if !errors.As(err, &weakErr) {
+		t.Fatal("Expected WeakPasswordError. Got:", err)
+	}
+	if weakErr.Strength.Feedback.Warning != "Avoid using personal information" {
+		t.Errorf("Unexpected warning: %q", weakErr.Strength.Feedback.Warning)
+	}
+}